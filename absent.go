@@ -0,0 +1,204 @@
+package xcel
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter"
+)
+
+// absentType is the CEL type of absent values.
+var absentType = types.NewOpaqueType("xcel.absent")
+
+// absent is the value of a dyn field, such as an interface field, which is
+// nil or reached through a nil object. has() is false for its fields, so
+// presence tests compose through it, while selecting its fields is an
+// error. Use has() rather than comparing with null to test for it.
+type absent struct {
+	field string
+
+	// typ is the CEL type of the field, if it is known.
+	typ *types.Type
+}
+
+// ConvertToNative implements the ref.Val interface.
+func (a absent) ConvertToNative(typeDesc reflect.Type) (any, error) {
+	return nil, fmt.Errorf("xcel: field '%s' is not set", a.field)
+}
+
+// ConvertToType implements the ref.Val interface.
+func (a absent) ConvertToType(typeValue ref.Type) ref.Val {
+	if typeValue == types.TypeType {
+		return absentType
+	}
+	return types.NewErr("xcel: field '%s' is not set", a.field)
+}
+
+// Equal implements the ref.Val interface.
+func (a absent) Equal(other ref.Val) ref.Val {
+	_, ok := other.(absent)
+	return types.Bool(ok)
+}
+
+// Type implements the ref.Val interface.
+func (a absent) Type() ref.Type {
+	return absentType
+}
+
+// Value implements the ref.Val interface.
+func (a absent) Value() any {
+	return nil
+}
+
+// Get implements the traits.Indexer interface.
+func (a absent) Get(index ref.Val) ref.Val {
+	return types.NewErr("xcel: field '%s' is not set", a.field)
+}
+
+// IsSet implements the traits.FieldTester interface.
+func (a absent) IsSet(field ref.Val) ref.Val {
+	return types.False
+}
+
+// absentField returns the value of a field of the given Go type which is
+// reached through a nil object: nested objects are nil objects, so has() is
+// false for their fields, dyn fields are absent, and anything else is an
+// error.
+func absentField(name string, ft reflect.Type, rt reflect.Type, wrap func(any) ref.Val) (any, error) {
+	switch {
+	case ft == rt:
+		return wrap(reflect.Zero(rt).Interface()), nil
+	case ft.Kind() == reflect.Pointer && ft.Elem().Kind() == reflect.Struct && !isScalarStructType(ft):
+		return reflect.Zero(ft).Interface(), nil
+	case ft.Kind() == reflect.Interface:
+		return absent{field: name}, nil
+	}
+	return nil, fmt.Errorf("xcel: field '%s' is not set", name)
+}
+
+// WithAbsentValues makes the unset fields derived with NewFields, other than
+// nested objects, evaluate to an absent value instead of their zero value or
+// an error, and makes a registry's ProgramOptions include AbsentSemantics.
+// Programs evaluating objects with absent values should be created with
+// AbsentSemantics.
+func WithAbsentValues() Option {
+	return option("WithAbsentValues", fieldScope, func(o *options) {
+		o.absentValues = true
+	})
+}
+
+// AbsentSemantics returns the CEL program option giving absent values (see
+// WithAbsentValues) non-strict semantics, unlike CEL's standard semantics
+// where using an unset field is an error that propagates through the rest of
+// the expression:
+//
+//   - Comparisons (==, !=, <, <=, >, >=) involving an absent value are false,
+//     so obj.updated_at > obj.created_at is false when updated_at is unset,
+//     and so are both obj.name == 'x' and obj.name != 'x'.
+//   - An absent bool field is false, so it is falsy with &&, ||, ! and the
+//     conditional operator. Note that !(obj.a == obj.b) is therefore true
+//     when either field is unset, while obj.a != obj.b is false.
+//
+// Any other use of an absent value, such as calling a function with it, is
+// an error as before, and has() is unaffected.
+func AbsentSemantics() cel.ProgramOption {
+	return cel.CustomDecorator(decorateAbsent)
+}
+
+// decorateAbsent implements AbsentSemantics for the comparisons and field
+// selections of a program.
+func decorateAbsent(i interpreter.Interpretable) (interpreter.Interpretable, error) {
+	switch i := i.(type) {
+	case *absentAttribute:
+		return i, nil
+	case interpreter.InterpretableAttribute:
+		return &absentAttribute{InterpretableAttribute: i}, nil
+	case interpreter.InterpretableCall:
+		switch i.Function() {
+		case operators.Equals, operators.NotEquals,
+			operators.Less, operators.LessEquals, operators.Greater, operators.GreaterEquals:
+			if len(i.Args()) == 2 {
+				return &absentComparison{InterpretableCall: i}, nil
+			}
+		}
+	}
+	return i, nil
+}
+
+// absentAttribute evaluates absent bool fields as false.
+type absentAttribute struct {
+	interpreter.InterpretableAttribute
+}
+
+// Eval implements the interpreter.Interpretable interface.
+func (a *absentAttribute) Eval(ctx interpreter.Activation) ref.Val {
+	v := evalOperand(a, ctx)
+	if v, ok := v.(absent); ok && v.typ == types.BoolType {
+		return types.False
+	}
+	return v
+}
+
+// absentComparison evaluates comparisons involving absent values as false,
+// and other comparisons with the overloads of the wrapped call.
+type absentComparison struct {
+	interpreter.InterpretableCall
+}
+
+// Eval implements the interpreter.Interpretable interface. Absent values
+// are the values of field selections, so only the operands which are
+// attributes are evaluated ahead of the wrapped call, which is given their
+// values so they are evaluated once.
+func (c *absentComparison) Eval(ctx interpreter.Activation) ref.Val {
+	operands := &operandActivation{Activation: ctx}
+	for i, arg := range c.Args() {
+		a, ok := arg.(*absentAttribute)
+		if !ok {
+			continue
+		}
+		v := evalOperand(a, ctx)
+		if _, ok := v.(absent); ok {
+			return types.False
+		}
+		operands.attrs[i], operands.vals[i] = a, v
+	}
+	return c.InterpretableCall.Eval(operands)
+}
+
+// operandActivation resolves names with the activation it wraps, and holds
+// the values of the attribute operands of a comparison evaluated by
+// absentComparison.
+type operandActivation struct {
+	interpreter.Activation
+
+	attrs [2]*absentAttribute
+	vals  [2]ref.Val
+}
+
+// UnknownAttributePatterns implements the interpreter.PartialActivation
+// interface, so the unknowns of a partial activation still apply to the
+// operands evaluated by the wrapped call.
+func (o *operandActivation) UnknownAttributePatterns() []*interpreter.AttributePattern {
+	if p, ok := o.Activation.(interpreter.PartialActivation); ok {
+		return p.UnknownAttributePatterns()
+	}
+	return nil
+}
+
+// evalOperand evaluates the attribute operand of a comparison, without
+// evaluating absent bool fields as false, or returns its value if the
+// comparison has already evaluated it.
+func evalOperand(a *absentAttribute, ctx interpreter.Activation) ref.Val {
+	if o, ok := ctx.(*operandActivation); ok {
+		for i, attr := range o.attrs {
+			if attr == a {
+				return o.vals[i]
+			}
+		}
+	}
+	return a.InterpretableAttribute.Eval(ctx)
+}
@@ -0,0 +1,223 @@
+package xcel_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter"
+	"github.com/picatz/xcel"
+)
+
+type Record struct {
+	Name      string `cel:",omitempty"`
+	Archived  bool   `cel:",omitempty"`
+	CreatedAt time.Time
+	UpdatedAt *time.Time
+	Owner     *Record
+}
+
+func TestAbsentValues(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	updated := created.Add(time.Hour)
+
+	reg := xcel.NewRegistry(xcel.WithAbsentValues())
+
+	if err := xcel.RegisterAll(reg, []any{&Record{}}); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	_, typ := xcel.NewObject(&Record{})
+
+	reg.Variable("obj", typ)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	unset := &Record{CreatedAt: created}
+	set := &Record{Name: "x", Archived: true, CreatedAt: created, UpdatedAt: &updated}
+
+	tests := []struct {
+		expr   string
+		record *Record
+		want   bool
+	}{
+		{"obj.updated_at > obj.created_at", set, true},
+		{"obj.updated_at > obj.created_at", unset, false},
+		{"obj.updated_at <= obj.created_at", unset, false},
+		{"obj.created_at < obj.updated_at", unset, false},
+		{"obj.name == 'x'", unset, false},
+		{"obj.name != 'x'", unset, false},
+		{"obj.name == obj.name", unset, false},
+		{"!(obj.name == 'x')", unset, true},
+		// Absent bool fields are falsy.
+		{"obj.archived", unset, false},
+		{"!obj.archived", unset, true},
+		{"obj.archived || obj.created_at < obj.updated_at", unset, false},
+		{"obj.archived || obj.name != 'x'", unset, false},
+		{"!obj.archived && obj.created_at == timestamp('2024-01-01T00:00:00Z')", unset, true},
+		{"obj.archived ? false : true", unset, true},
+		{"obj.archived == false", unset, false},
+		{"obj.archived && obj.name == 'x'", set, true},
+		// Presence tests are unaffected.
+		{"has(obj.updated_at)", unset, false},
+		{"has(obj.owner.name)", unset, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			ast, iss := env.Compile(test.expr)
+			if iss.Err() != nil {
+				t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+			}
+
+			prg, err := env.Program(ast, reg.ProgramOptions()...)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			out, _, err := prg.Eval(map[string]any{"obj": test.record})
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
+
+func TestAbsentValuesErrors(t *testing.T) {
+	reg := xcel.NewRegistry(xcel.WithAbsentValues())
+
+	if err := xcel.RegisterAll(reg, []any{&Record{}}); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	_, typ := xcel.NewObject(&Record{})
+
+	reg.Variable("obj", typ)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	for _, expr := range []string{
+		"obj.name.startsWith('x')",
+		"size(obj.name) == 0",
+	} {
+		ast, iss := env.Compile(expr)
+		if iss.Err() != nil {
+			t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+		}
+
+		prg, err := env.Program(ast, reg.ProgramOptions()...)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		if out, _, err := prg.Eval(map[string]any{"obj": &Record{}}); err == nil {
+			t.Fatalf("expected an error for %q but got '%v'", expr, out)
+		}
+	}
+}
+
+// countingCall counts the evaluations of the call it wraps.
+type countingCall struct {
+	interpreter.InterpretableCall
+	n *int
+}
+
+func (c *countingCall) Eval(ctx interpreter.Activation) ref.Val {
+	*c.n++
+	return c.InterpretableCall.Eval(ctx)
+}
+
+// countingActivation counts the resolutions of a variable.
+type countingActivation struct {
+	interpreter.Activation
+	name string
+	n    *int
+}
+
+func (a *countingActivation) ResolveName(name string) (any, bool) {
+	if name == a.name {
+		*a.n++
+	}
+	return a.Activation.ResolveName(name)
+}
+
+func TestAbsentValuesWrappedComparisons(t *testing.T) {
+	reg := xcel.NewRegistry(xcel.WithAbsentValues())
+
+	if err := xcel.RegisterAll(reg, []any{&Record{}}); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	_, typ := xcel.NewObject(&Record{})
+
+	reg.Variable("obj", typ)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("obj.name < 'y'")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	var calls int
+	counting := cel.CustomDecorator(func(i interpreter.Interpretable) (interpreter.Interpretable, error) {
+		if call, ok := i.(interpreter.InterpretableCall); ok && call.Function() == operators.Less {
+			return &countingCall{InterpretableCall: call, n: &calls}, nil
+		}
+		return i, nil
+	})
+
+	prg, err := env.Program(ast, append([]cel.ProgramOption{counting}, reg.ProgramOptions()...)...)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	for _, test := range []struct {
+		record *Record
+		want   bool
+		calls  int
+	}{
+		{&Record{Name: "x"}, true, 1},
+		{&Record{Name: "z"}, false, 2},
+		{&Record{}, false, 2},
+	} {
+		vars, err := interpreter.NewActivation(map[string]any{"obj": test.record})
+		if err != nil {
+			t.Fatalf("failed to create activation: %v", err)
+		}
+
+		var resolved int
+		out, _, err := prg.Eval(&countingActivation{Activation: vars, name: "obj", n: &resolved})
+		if err != nil {
+			t.Fatalf("failed to evaluate program for %q: %v", test.record.Name, err)
+		}
+
+		if out != types.Bool(test.want) {
+			t.Fatalf("expected '%v' for %q but got '%v'", test.want, test.record.Name, out)
+		}
+
+		if calls != test.calls {
+			t.Fatalf("expected %d evaluations of the wrapped call for %q, got %d", test.calls, test.record.Name, calls)
+		}
+
+		if resolved != 1 {
+			t.Fatalf("expected obj.name to be evaluated once for %q, got %d", test.record.Name, resolved)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package xcel
+
+import (
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// walkExpr calls fn for the expression and each of its subexpressions,
+// parents before their children.
+func walkExpr(e *exprpb.Expr, fn func(*exprpb.Expr)) {
+	if e == nil {
+		return
+	}
+
+	fn(e)
+
+	switch k := e.GetExprKind().(type) {
+	case *exprpb.Expr_SelectExpr:
+		walkExpr(k.SelectExpr.GetOperand(), fn)
+	case *exprpb.Expr_CallExpr:
+		walkExpr(k.CallExpr.GetTarget(), fn)
+		for _, arg := range k.CallExpr.GetArgs() {
+			walkExpr(arg, fn)
+		}
+	case *exprpb.Expr_ListExpr:
+		for _, elem := range k.ListExpr.GetElements() {
+			walkExpr(elem, fn)
+		}
+	case *exprpb.Expr_StructExpr:
+		for _, entry := range k.StructExpr.GetEntries() {
+			walkExpr(entry.GetMapKey(), fn)
+			walkExpr(entry.GetValue(), fn)
+		}
+	case *exprpb.Expr_ComprehensionExpr:
+		walkExpr(k.ComprehensionExpr.GetIterRange(), fn)
+		walkExpr(k.ComprehensionExpr.GetAccuInit(), fn)
+		walkExpr(k.ComprehensionExpr.GetLoopCondition(), fn)
+		walkExpr(k.ComprehensionExpr.GetLoopStep(), fn)
+		walkExpr(k.ComprehensionExpr.GetResult(), fn)
+	}
+}
@@ -0,0 +1,88 @@
+package xcel
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+
+	"github.com/google/cel-go/common/types"
+)
+
+// Reflect types of the arbitrary precision number types.
+var (
+	bigIntType   = reflect.TypeOf(big.Int{})
+	bigFloatType = reflect.TypeOf(big.Float{})
+)
+
+// isBigType reports whether the type is big.Int or big.Float, or a pointer
+// to either.
+func isBigType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t == bigIntType || t == bigFloatType
+}
+
+// bigType returns the CEL type of a big.Int or big.Float type: int, double,
+// or string with WithBigNumberStrings.
+func bigType(t reflect.Type, strings bool) *types.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case strings:
+		return types.StringType
+	case t == bigIntType:
+		return types.IntType
+	}
+	return types.DoubleType
+}
+
+// WithBigNumberStrings makes big.Int and big.Float fields derived with
+// NewFields strings of their exact decimal form, instead of int and double
+// values which are an error when the value is out of their range.
+func WithBigNumberStrings() Option {
+	return option("WithBigNumberStrings", fieldScope, func(o *options) {
+		o.bigNumberStrings = true
+	})
+}
+
+// bigValue converts a big.Int or big.Float value to a CEL int or double, or
+// to its decimal form if strings is true. Integers which don't fit in an
+// int64 and floats beyond the range of a float64 are errors rather than
+// being truncated; floats within range are rounded to the nearest float64.
+func bigValue(v reflect.Value, strings bool) (any, error) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return types.NullValue, nil
+		}
+		v = v.Elem()
+	}
+	if !v.CanAddr() {
+		p := reflect.New(v.Type()).Elem()
+		p.Set(v)
+		v = p
+	}
+
+	switch n := v.Addr().Interface().(type) {
+	case *big.Int:
+		if strings {
+			return n.String(), nil
+		}
+		if !n.IsInt64() {
+			return nil, fmt.Errorf("xcel: big.Int value %s overflows int", n)
+		}
+		return n.Int64(), nil
+	case *big.Float:
+		if strings {
+			return n.Text('g', -1), nil
+		}
+		f, _ := n.Float64()
+		if math.IsInf(f, 0) && !n.IsInf() {
+			return nil, fmt.Errorf("xcel: big.Float value %s overflows double", n.Text('g', -1))
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("xcel: unsupported number type '%s'", v.Type())
+}
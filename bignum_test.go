@@ -0,0 +1,61 @@
+package xcel_test
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+type Transfer struct {
+	Amount *big.Int
+	Fee    big.Int
+	Rate   *big.Float
+}
+
+func TestFieldsBigNumbers(t *testing.T) {
+	// 2^53 + 1 is not representable as a float64.
+	amount := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 53), big.NewInt(1))
+
+	transfer := &Transfer{
+		Amount: amount,
+		Fee:    *big.NewInt(25),
+		Rate:   big.NewFloat(0.25),
+	}
+
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+
+	tests := []struct {
+		expr     string
+		transfer *Transfer
+		opts     []xcel.Option
+		want     bool
+	}{
+		{"obj.amount > 1000000", transfer, nil, true},
+		{"obj.amount == 9007199254740993 && obj.amount != 9007199254740992", transfer, nil, true},
+		{"obj.fee == 25 && obj.rate == 0.25", transfer, nil, true},
+		{"has(obj.amount) || has(obj.rate)", &Transfer{}, nil, false},
+		{"obj.amount == '123456789012345678901234567890'", &Transfer{Amount: huge}, []xcel.Option{xcel.WithBigNumberStrings()}, true},
+		{"obj.rate == '0.25' && obj.fee == '25'", transfer, []xcel.Option{xcel.WithBigNumberStrings()}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.transfer, test.expr, test.opts...)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+
+	_, err := evalFields(t, &Transfer{Amount: huge}, "obj.amount > 0")
+	if err == nil || !strings.Contains(err.Error(), "overflows int") {
+		t.Fatalf("expected an overflow error, got: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package xcel
+
+import (
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// Clock returns the current time for time-dependent functions, so they can
+// be evaluated deterministically, such as with a fixed time in tests.
+type Clock func() time.Time
+
+// WithClock sets the clock of a registry, which defaults to time.Now. It is
+// returned by Registry.Clock, and consulted by the functions declared by
+// TimeFunctions, which Registry.EnvOptions includes.
+func WithClock(clock Clock) Option {
+	return option("WithClock", registryScope, func(o *options) {
+		o.clock = clock
+	})
+}
+
+// Clock returns the registry's clock (see WithClock), for functions which
+// depend on the current time, such as member functions declared with
+// MemberFunctions, so they are as deterministic as the registry's own.
+func (r *Registry) Clock() Clock {
+	if r.opts.clock == nil {
+		return time.Now
+	}
+	return r.opts.clock
+}
+
+// TimeFunctions returns a CEL environment option declaring functions which
+// depend on the current time according to the clock, or time.Now if it is
+// nil, such as reg.Clock(). Registry.EnvOptions already includes them with
+// the registry's clock:
+//
+//	timestamp.age() -> duration  // the time elapsed since the timestamp
+//
+// Since they depend on the current time, expressions using them should not
+// be constant folded (see FoldConstants) when their arguments are constant.
+func TimeFunctions(clock Clock) cel.EnvOption {
+	if clock == nil {
+		clock = time.Now
+	}
+
+	return cel.Function("age",
+		cel.MemberOverload("xcel_timestamp_age", []*types.Type{types.TimestampType}, types.DurationType,
+			cel.UnaryBinding(func(v ref.Val) ref.Val {
+				ts, ok := v.(types.Timestamp)
+				if !ok {
+					return types.MaybeNoSuchOverloadErr(v)
+				}
+				return types.Duration{Duration: clock().Sub(ts.Time)}
+			}),
+		),
+	)
+}
@@ -0,0 +1,121 @@
+package xcel_test
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/picatz/xcel"
+)
+
+func TestClock(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	reg := xcel.NewRegistry(xcel.WithClock(func() time.Time { return now }))
+
+	if err := xcel.RegisterAll(reg, []any{&Record{}}); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	_, typ := xcel.NewObject(&Record{})
+
+	reg.Variable("obj", typ)
+
+	// A member function using the registry's clock.
+	expired := xcel.Method{
+		Name:     "expired",
+		Receiver: typ,
+		Result:   types.BoolType,
+		Impl: func(args ...ref.Val) ref.Val {
+			r := args[0].(*xcel.Object[any]).Raw.(*Record)
+			return types.Bool(r.UpdatedAt != nil && reg.Clock()().Sub(*r.UpdatedAt) > 7*24*time.Hour)
+		},
+	}
+
+	env, err := cel.NewEnv(append(reg.EnvOptions(), xcel.MemberFunctions(expired))...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	updated := now.Add(-8 * 24 * time.Hour)
+	record := &Record{CreatedAt: now.Add(-36 * time.Hour), UpdatedAt: &updated}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"obj.created_at.age() == duration('36h')", true},
+		{"obj.created_at.age() > duration('24h')", true},
+		{"timestamp('2024-06-01T11:00:00Z').age() == duration('1h')", true},
+		{"obj.expired()", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			ast, iss := env.Compile(test.expr)
+			if iss.Err() != nil {
+				t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			out, _, err := prg.Eval(map[string]any{"obj": reg.Adapter.NativeToValue(record)})
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
+
+// TestClockNotBypassed guards against time-dependent functions using the
+// wall clock instead of the registry's clock.
+func TestClockNotBypassed(t *testing.T) {
+	allowed := map[string]bool{
+		// The default clock.
+		"clock.go": true,
+		// Measures the elapsed time of an evaluation.
+		"ruleset.go": true,
+	}
+
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatalf("failed to list files: %v", err)
+	}
+
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") || allowed[file] {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", file, err)
+		}
+
+		ast.Inspect(f, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "time" && sel.Sel.Name == "Now" {
+				t.Errorf("%s: use the registry's clock instead of time.Now", fset.Position(sel.Pos()))
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package xcel
+
+import (
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// xcel is built against cel-go v0.18. The xcel_celgo017 build tag swaps
+// the code using APIs introduced in v0.18, which live in *_celgo018.go
+// files, for the fallbacks in *_celgo017.go files, so the package compiles
+// against v0.17 with FoldConstants and Template.Specialize returning
+// ErrOptimizerUnsupported:
+//
+//	go get github.com/google/cel-go@v0.17.7
+//	go test -tags xcel_celgo017 ./...
+//
+// The assertions below check that TypeProvider and TypeAdapter implement
+// the provider and adapter contracts xcel relies on for either version.
+
+// structProvider is the part of the CEL type provider contract implemented
+// by TypeProvider.
+type structProvider interface {
+	EnumValue(enumName string) ref.Val
+	FindIdent(identName string) (ref.Val, bool)
+	FindStructType(structType string) (*types.Type, bool)
+	FindStructFieldType(structType, fieldName string) (*types.FieldType, bool)
+	NewValue(structType string, fields map[string]ref.Val) ref.Val
+}
+
+// valueAdapter is the CEL type adapter contract implemented by TypeAdapter.
+type valueAdapter interface {
+	NativeToValue(value any) ref.Val
+}
+
+var (
+	_ structProvider = &TypeProvider{}
+	_ valueAdapter   = TypeAdapter{}
+)
@@ -0,0 +1,131 @@
+package xcel
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// ComputedField is a virtual field whose value is derived from other fields
+// of the same object, such as a full_image field combining the registry,
+// repo, and tag fields of an image.
+type ComputedField struct {
+	// Type is the CEL type of the computed value.
+	Type *types.Type
+
+	// From are the names of the fields the value is computed from. The
+	// computed field is only set when all of them are set.
+	From []string
+
+	// GetFrom returns the computed value for the object.
+	GetFrom ref.FieldGetter
+}
+
+// RegisterComputedField adds the computed field to the fields of the named
+// type, which must already be registered with the type adapter and type
+// provider, such as with RegisterObject. Its getter is always called with
+// the object wrapping the Go value, even when the Go value itself is used
+// as a variable. The fields it is computed from are reported in its place
+// by ReferencedFields, and are listed in the type provider's Schema.
+func RegisterComputedField(ta TypeAdapter, tp *TypeProvider, typeName, name string, field ComputedField) error {
+	if tp.Frozen() {
+		return fmt.Errorf("%w: cannot register computed field '%s' on '%s'", ErrFrozen, name, typeName)
+	}
+
+	fields, ok := tp.StructFieldTypes[typeName]
+	if !ok {
+		return fmt.Errorf("xcel: type '%s' is not registered", typeName)
+	}
+	if _, ok := fields[name]; ok {
+		return fmt.Errorf("xcel: field '%s' is already registered on '%s'", name, typeName)
+	}
+
+	from := make([]*types.FieldType, 0, len(field.From))
+	for _, dep := range field.From {
+		f, ok := fields[dep]
+		if !ok {
+			return fmt.Errorf("xcel: computed field '%s' on '%s' depends on unknown field '%s'", name, typeName, dep)
+		}
+		from = append(from, f)
+	}
+
+	fields[name] = &types.FieldType{
+		Type: field.Type,
+		IsSet: ref.FieldTester(func(target any) bool {
+			for _, f := range from {
+				if !f.IsSet(target) {
+					return false
+				}
+			}
+			return true
+		}),
+		GetFrom: ref.FieldGetter(func(target any) (any, error) {
+			if _, ok := target.(ref.Val); !ok {
+				target = ta.NativeToValue(target)
+			}
+			return field.GetFrom(target)
+		}),
+	}
+
+	if tp.computed == nil {
+		tp.computed = map[string]map[string][]string{}
+	}
+	if tp.computed[typeName] == nil {
+		tp.computed[typeName] = map[string][]string{}
+	}
+	tp.computed[typeName][name] = append([]string(nil), field.From...)
+
+	return nil
+}
+
+// ReferencedFields returns the sorted names of the fields selected by the
+// checked AST for each registered type name, including fields only tested
+// with has(). Computed fields are reported as the fields they are computed
+// from, so callers know which fields need to be populated for evaluation.
+func ReferencedFields(tp *TypeProvider, ast *cel.Ast) (map[string][]string, error) {
+	checked, err := cel.AstToCheckedExpr(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := map[string]map[string]bool{}
+
+	var add func(typeName, name string)
+	add = func(typeName, name string) {
+		if deps, ok := tp.computed[typeName][name]; ok {
+			for _, dep := range deps {
+				add(typeName, dep)
+			}
+			return
+		}
+		if refs[typeName] == nil {
+			refs[typeName] = map[string]bool{}
+		}
+		refs[typeName][name] = true
+	}
+
+	walkExpr(checked.GetExpr(), func(e *exprpb.Expr) {
+		sel := e.GetSelectExpr()
+		if sel == nil {
+			return
+		}
+		typeName := checked.GetTypeMap()[sel.GetOperand().GetId()].GetMessageType()
+		if _, ok := tp.StructFieldTypes[typeName][sel.GetField()]; ok {
+			add(typeName, sel.GetField())
+		}
+	})
+
+	result := make(map[string][]string, len(refs))
+	for typeName, names := range refs {
+		for name := range names {
+			result[typeName] = append(result[typeName], name)
+		}
+		sort.Strings(result[typeName])
+	}
+
+	return result, nil
+}
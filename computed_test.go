@@ -0,0 +1,143 @@
+package xcel_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+type Container struct {
+	Registry    string `cel:",omitempty"`
+	Repo        string `cel:",omitempty"`
+	Tag         string `cel:",omitempty"`
+	Privileged  bool
+	HostPID     bool
+	HostNetwork bool
+}
+
+func newContainerEnv(t *testing.T) (*xcel.Registry, *cel.Env, string) {
+	t.Helper()
+
+	reg := xcel.NewRegistry()
+
+	obj, typ := xcel.NewObject(&Container{})
+
+	xcel.RegisterObject(reg.Adapter, reg.Provider, obj, typ, xcel.NewFields(obj))
+
+	err := xcel.RegisterComputedField(reg.Adapter, reg.Provider, typ.TypeName(), "full_image", xcel.ComputedField{
+		Type: types.StringType,
+		From: []string{"registry", "repo", "tag"},
+		GetFrom: func(target any) (any, error) {
+			c := target.(*xcel.Object[*Container]).Raw
+			return c.Registry + "/" + c.Repo + ":" + c.Tag, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to register computed field: %v", err)
+	}
+
+	err = xcel.RegisterComputedField(reg.Adapter, reg.Provider, typ.TypeName(), "is_privileged", xcel.ComputedField{
+		Type: types.BoolType,
+		From: []string{"privileged", "host_pid", "host_network"},
+		GetFrom: func(target any) (any, error) {
+			c := target.(*xcel.Object[*Container]).Raw
+			return c.Privileged || c.HostPID || c.HostNetwork, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to register computed field: %v", err)
+	}
+
+	reg.Variable("container", typ)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	return reg, env, typ.TypeName()
+}
+
+func TestComputedField(t *testing.T) {
+	_, env, _ := newContainerEnv(t)
+
+	ast, iss := env.Compile("has(container.full_image) ? container.full_image == 'docker.io/library/nginx:1.25' : container.is_privileged")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	tests := []struct {
+		container *Container
+		want      bool
+	}{
+		{&Container{Registry: "docker.io", Repo: "library/nginx", Tag: "1.25"}, true},
+		{&Container{Registry: "docker.io", Repo: "library/nginx", Tag: "1.24"}, false},
+		{&Container{Registry: "docker.io", Repo: "library/nginx", HostPID: true}, true},
+		{&Container{Registry: "docker.io", Repo: "library/nginx"}, false},
+	}
+
+	for _, test := range tests {
+		out, _, err := prg.Eval(map[string]any{"container": test.container})
+		if err != nil {
+			t.Fatalf("failed to evaluate program for %+v: %v", test.container, err)
+		}
+
+		if out != types.Bool(test.want) {
+			t.Fatalf("expected '%v' but got '%v' for %+v", test.want, out, test.container)
+		}
+	}
+}
+
+func TestComputedFieldErrors(t *testing.T) {
+	reg, _, typeName := newContainerEnv(t)
+
+	for _, test := range []struct {
+		typeName, name string
+		from           []string
+	}{
+		{"*xcel_test.Missing", "x", nil},
+		{typeName, "full_image", nil},
+		{typeName, "x", []string{"digest"}},
+	} {
+		err := xcel.RegisterComputedField(reg.Adapter, reg.Provider, test.typeName, test.name, xcel.ComputedField{Type: types.StringType, From: test.from})
+		if err == nil {
+			t.Fatalf("expected an error for %+v", test)
+		}
+	}
+}
+
+func TestReferencedFields(t *testing.T) {
+	reg, env, typeName := newContainerEnv(t)
+
+	ast, iss := env.Compile("container.full_image.startsWith('docker.io/') || has(container.is_privileged) || container.privileged")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	refs, err := xcel.ReferencedFields(reg.Provider, ast)
+	if err != nil {
+		t.Fatalf("failed to find referenced fields: %v", err)
+	}
+
+	want := map[string][]string{
+		typeName: {"host_network", "host_pid", "privileged", "registry", "repo", "tag"},
+	}
+
+	if !reflect.DeepEqual(refs, want) {
+		t.Fatalf("expected %v but got %v", want, refs)
+	}
+
+	schema := reg.Provider.Schema()
+	if !strings.Contains(schema, "\tfield full_image string computed from registry, repo, tag\n") {
+		t.Fatalf("expected the computed field in the schema but got:\n%s", schema)
+	}
+}
@@ -0,0 +1,283 @@
+package xcel
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// RegisterConversion returns a CEL environment option declaring a function
+// converting objects of type A into objects of type B, such as
+// as_event_v2(EventV1) -> EventV2, named "as_" followed by the snake_case
+// name of B. Both types must be struct pointer types already registered
+// with the type provider, with fields derived by NewFields using the same
+// options as opts.
+//
+// Each field of B is copied from the field of A with the same name when
+// both have the same CEL type and Go types which convert to each other
+// without loss, and is otherwise left unset. The overrides compute fields of B by name
+// from the A value instead, where returning nil leaves the field unset.
+// Fields of B which also exist on A with an incompatible type, such as a
+// narrower integer or float, an integer of the other signedness, or an
+// array copied from a slice, and overrides naming unknown fields of B, are
+// reported as an error, so a conversion never drops a field or narrows a
+// value silently. Override values which do not fit the Go type of their
+// field are an evaluation error.
+func RegisterConversion[A, B any](tp *TypeProvider, overrides map[string]func(A) any, opts ...Option) (cel.EnvOption, error) {
+	var zeroA A
+	var zeroB B
+
+	typA, typB := objectTypeOf(zeroA), objectTypeOf(zeroB)
+
+	fieldsA, ok := tp.StructFieldTypes[typA.TypeName()]
+	if !ok {
+		return nil, fmt.Errorf("xcel: type '%s' is not registered", typA)
+	}
+	fieldsB, ok := tp.StructFieldTypes[typB.TypeName()]
+	if !ok {
+		return nil, fmt.Errorf("xcel: type '%s' is not registered", typB)
+	}
+
+	o := newOptions(opts...)
+	if err := o.check("RegisterConversion", fieldScope); err != nil {
+		return nil, err
+	}
+
+	pathsA, err := conversionPaths(reflect.TypeOf(zeroA), fieldsA, o)
+	if err != nil {
+		return nil, err
+	}
+	pathsB, err := conversionPaths(reflect.TypeOf(zeroB), fieldsB, o)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for name := range overrides {
+		if _, ok := pathsB[name]; !ok {
+			problems = append(problems, fmt.Sprintf("override for unknown field '%s'", name))
+		}
+	}
+
+	var copies []conversionCopy
+	for _, name := range sortedFieldNames(fieldsB) {
+		dst, ok := pathsB[name]
+		if !ok {
+			continue
+		}
+		if _, ok := overrides[name]; ok {
+			continue
+		}
+		src, ok := pathsA[name]
+		if !ok {
+			continue
+		}
+		if !fieldsA[name].Type.IsExactType(fieldsB[name].Type) || !src.typ.ConvertibleTo(dst.typ) {
+			problems = append(problems, fmt.Sprintf("field '%s' of type '%s' cannot be converted to '%s'", name, fieldsA[name].Type, fieldsB[name].Type))
+			continue
+		}
+		if lossyConversion(src.typ, dst.typ) {
+			problems = append(problems, fmt.Sprintf("field '%s' of Go type '%s' cannot be converted to '%s' without loss", name, src.typ, dst.typ))
+			continue
+		}
+		copies = append(copies, conversionCopy{src: src, dst: dst})
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("xcel: cannot convert '%s' to '%s': %s", typA, typB, strings.Join(problems, ", "))
+	}
+
+	convert := func(a A) (B, error) {
+		var b B
+
+		va, err := structValue(a)
+		if err != nil {
+			return b, err
+		}
+
+		vb := reflect.New(reflect.TypeOf(zeroB).Elem())
+		for _, c := range copies {
+			fv, err := getNestedField(va, c.src.path, nil)
+			if err == errNilField || err == nil && !presenceIsSet(fv) {
+				continue
+			}
+			if err != nil {
+				return b, err
+			}
+			setNestedField(vb.Elem(), c.dst.path, fv.Convert(c.dst.typ))
+		}
+
+		for name, fn := range overrides {
+			v := fn(a)
+			if v == nil {
+				continue
+			}
+			dst := pathsB[name]
+			fv, err := conversionValue(v, dst.typ)
+			if err != nil {
+				return b, fmt.Errorf("xcel: override for field '%s': %w", name, err)
+			}
+			setNestedField(vb.Elem(), dst.path, fv)
+		}
+
+		return vb.Interface().(B), nil
+	}
+
+	name := "as_" + ToSnakeCase(friendlyTypeName(zeroB))
+
+	return cel.Function(name,
+		cel.Overload(fmt.Sprintf("xcel_%s_%s", name, ToSnakeCase(friendlyTypeName(zeroA))),
+			[]*types.Type{typA},
+			typB,
+			cel.UnaryBinding(func(v ref.Val) ref.Val {
+				target := v.Value()
+				if r, ok := target.(rawValuer); ok {
+					target = r.rawValue()
+				}
+				a, ok := target.(A)
+				if !ok {
+					return types.NewErr("xcel: cannot convert '%T' to '%s'", target, typB)
+				}
+				b, err := convert(a)
+				if err != nil {
+					return types.WrapErr(err)
+				}
+				return &Object[B]{Raw: b, fields: fieldsB, opts: o}
+			}),
+		),
+	), nil
+}
+
+// conversionField is the path to a field of a registered object type.
+type conversionField struct {
+	path []fieldStep
+	typ  reflect.Type
+}
+
+// conversionCopy copies a field of one object type to another.
+type conversionCopy struct {
+	src, dst conversionField
+}
+
+// conversionPaths returns the paths to the registered fields of the struct
+// pointer type by name, resolved the same way as NewFields names them.
+// Fields reached through embedded interfaces are not included, since their
+// path depends on the value.
+func conversionPaths(rt reflect.Type, fields map[string]*types.FieldType, o *options) (map[string]conversionField, error) {
+	if rt == nil || rt.Kind() != reflect.Pointer || rt.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("xcel: unsupported conversion type '%s', expected a struct pointer", rt)
+	}
+
+	paths := map[string]conversionField{}
+	for _, pf := range promotedFields(rt, reflect.Value{}, o.impls) {
+		sf := pf.StructField
+		if !sf.IsExported() || sf.Anonymous && isStructType(sf.Type) {
+			continue
+		}
+
+		goPath := make([]string, len(pf.path))
+		dynamic := false
+		for i, step := range pf.path {
+			goPath[i] = step.name
+			dynamic = dynamic || step.dynamic
+		}
+		if dynamic {
+			continue
+		}
+
+		name := o.fieldName(goPath, sf)
+		if _, ok := fields[name]; ok {
+			paths[name] = conversionField{path: pf.path, typ: sf.Type}
+		}
+	}
+	return paths, nil
+}
+
+// setNestedField sets the field at the path of the struct value, allocating
+// any nil embedded struct pointers along the way.
+func setNestedField(v reflect.Value, path []fieldStep, fv reflect.Value) {
+	for i, step := range path {
+		if i > 0 {
+			if v.Kind() == reflect.Pointer {
+				if v.IsNil() {
+					v.Set(reflect.New(v.Type().Elem()))
+				}
+				v = v.Elem()
+			}
+		}
+		v = v.Field(step.index)
+	}
+	v.Set(fv)
+}
+
+// conversionValue returns the value returned by a conversion override as a
+// value of the Go type of the field it sets.
+func conversionValue(v any, rt reflect.Type) (reflect.Value, error) {
+	if val, ok := v.(ref.Val); ok {
+		native, err := val.ConvertToNative(rt)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v = native
+	}
+
+	fv := reflect.ValueOf(v)
+	if !fv.Type().ConvertibleTo(rt) {
+		return reflect.Value{}, fmt.Errorf("cannot use '%T' as '%s'", v, rt)
+	}
+	if lossyConversion(fv.Type(), rt) && !fitsType(fv, rt) {
+		return reflect.Value{}, fmt.Errorf("value '%v' overflows '%s'", v, rt)
+	}
+	return fv.Convert(rt), nil
+}
+
+// lossyConversion reports whether converting values of type src to type dst
+// can change them: a narrower integer or float, an integer of the other
+// signedness, or an array from a slice which may be of another length.
+func lossyConversion(src, dst reflect.Type) bool {
+	if src.Kind() == reflect.Slice && dst.Kind() == reflect.Array {
+		return true
+	}
+	sk, dk := numberKind(src.Kind()), numberKind(dst.Kind())
+	if sk == 0 || dk == 0 {
+		return false
+	}
+	return sk != dk || dst.Size() < src.Size()
+}
+
+// fitsType reports whether converting the value to the type, which
+// lossyConversion reports may change it, leaves it unchanged. Floats only
+// need to be in range, since rounding a float to a narrower one is expected.
+func fitsType(fv reflect.Value, rt reflect.Type) bool {
+	if fv.Kind() == reflect.Slice && rt.Kind() == reflect.Array {
+		return fv.Len() == rt.Len()
+	}
+	if fv.CanFloat() && numberKind(rt.Kind()) == reflect.Float64 {
+		return !reflect.Zero(rt).OverflowFloat(fv.Float())
+	}
+	cv := fv.Convert(rt)
+	if fv.CanInt() && fv.Int() < 0 && cv.CanUint() || fv.CanUint() && cv.CanInt() && cv.Int() < 0 {
+		return false
+	}
+	return cv.Convert(fv.Type()).Interface() == fv.Interface()
+}
+
+// numberKind returns reflect.Int, reflect.Uint, or reflect.Float64 for the
+// signed integer, unsigned integer, and float kinds, and otherwise zero.
+func numberKind(k reflect.Kind) reflect.Kind {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.Int
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return reflect.Uint
+	case reflect.Float32, reflect.Float64:
+		return reflect.Float64
+	}
+	return 0
+}
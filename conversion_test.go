@@ -0,0 +1,161 @@
+package xcel_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+type EventV1 struct {
+	User   string
+	Port   uint32
+	Source string
+	Tags   []string
+}
+
+type EventV2 struct {
+	User     string
+	Port     uint64
+	Origin   string
+	Tags     []string
+	Severity int
+}
+
+type EventV3 struct {
+	User int
+}
+
+type EventV4 struct {
+	Port uint8
+}
+
+func TestRegisterConversion(t *testing.T) {
+	reg := xcel.NewRegistry()
+
+	if err := xcel.RegisterAll(reg, []any{&EventV1{}, &EventV2{}, &EventV3{}}); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	conv, err := xcel.RegisterConversion[*EventV1, *EventV2](reg.Provider, map[string]func(*EventV1) any{
+		"origin": func(e *EventV1) any {
+			if e.Source == "" {
+				return nil
+			}
+			return "v1:" + e.Source
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to register conversion: %v", err)
+	}
+
+	_, v1Type := xcel.NewObject(&EventV1{})
+
+	env, err := cel.NewEnv(append(reg.EnvOptions(), conv, cel.Variable("obj", v1Type))...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	tests := []struct {
+		expr string
+		obj  *EventV1
+		want bool
+	}{
+		{"as_event_v2(obj).user == 'root'", &EventV1{User: "root"}, true},
+		{"as_event_v2(obj).port == 22u", &EventV1{Port: 22}, true},
+		{"as_event_v2(obj).origin == 'v1:sshd'", &EventV1{Source: "sshd"}, true},
+		{"as_event_v2(obj).origin == ''", &EventV1{}, true},
+		{"'a' in as_event_v2(obj).tags", &EventV1{Tags: []string{"a"}}, true},
+		{"has(as_event_v2(obj).tags)", &EventV1{}, false},
+		{"has(as_event_v2(obj).severity)", &EventV1{User: "root"}, true},
+		{"as_event_v2(obj).severity == 0", &EventV1{}, true},
+	}
+
+	for _, test := range tests {
+		ast, iss := env.Compile(test.expr)
+		if iss.Err() != nil {
+			t.Fatalf("failed to compile %q: %v", test.expr, iss.Err())
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		out, _, err := prg.Eval(map[string]any{"obj": test.obj})
+		if err != nil {
+			t.Fatalf("failed to evaluate %q: %v", test.expr, err)
+		}
+
+		if out != types.Bool(test.want) {
+			t.Fatalf("expected '%v' but got '%v' for %q", test.want, out, test.expr)
+		}
+	}
+}
+
+func TestRegisterConversionErrors(t *testing.T) {
+	reg := xcel.NewRegistry()
+
+	if err := xcel.RegisterAll(reg, []any{&EventV1{}, &EventV3{}, &EventV4{}}); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	_, err := xcel.RegisterConversion[*EventV1, *EventV3](reg.Provider, nil)
+	if err == nil || !strings.Contains(err.Error(), "field 'user' of type 'string' cannot be converted to 'int'") {
+		t.Fatalf("expected an incompatible field error, got: %v", err)
+	}
+
+	_, err = xcel.RegisterConversion[*EventV1, *EventV3](reg.Provider, map[string]func(*EventV1) any{
+		"user":  func(e *EventV1) any { return len(e.User) },
+		"owner": func(e *EventV1) any { return e.User },
+	})
+	if err == nil || !strings.Contains(err.Error(), "override for unknown field 'owner'") {
+		t.Fatalf("expected an unknown field error, got: %v", err)
+	}
+
+	_, err = xcel.RegisterConversion[*EventV1, *EventV2](reg.Provider, nil)
+	if err == nil || !strings.Contains(err.Error(), "is not registered") {
+		t.Fatalf("expected an unregistered type error, got: %v", err)
+	}
+
+	_, err = xcel.RegisterConversion[*EventV1, *EventV4](reg.Provider, nil)
+	if err == nil || !strings.Contains(err.Error(), "field 'port' of Go type 'uint32' cannot be converted to 'uint8' without loss") {
+		t.Fatalf("expected a lossy field error, got: %v", err)
+	}
+
+	conv, err := xcel.RegisterConversion[*EventV1, *EventV4](reg.Provider, map[string]func(*EventV1) any{
+		"port": func(e *EventV1) any { return e.Port },
+	})
+	if err != nil {
+		t.Fatalf("failed to register conversion: %v", err)
+	}
+
+	_, v1Type := xcel.NewObject(&EventV1{})
+
+	env, err := cel.NewEnv(append(reg.EnvOptions(), conv, cel.Variable("obj", v1Type))...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("as_event_v4(obj).port == 22u")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	out, _, err := prg.Eval(map[string]any{"obj": &EventV1{Port: 22}})
+	if err != nil || out != types.True {
+		t.Fatalf("expected true, got: %v, %v", out, err)
+	}
+
+	_, _, err = prg.Eval(map[string]any{"obj": &EventV1{Port: 300}})
+	if err == nil || !strings.Contains(err.Error(), "value '300' overflows 'uint8'") {
+		t.Fatalf("expected an overflow error, got: %v", err)
+	}
+}
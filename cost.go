@@ -0,0 +1,84 @@
+package xcel
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types/ref"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// EvalResult is the result of an evaluation with cost tracking.
+type EvalResult struct {
+	// Value is the result of the evaluation.
+	Value ref.Val
+
+	// Cost is the actual cost of the evaluation as tracked by CEL, plus the
+	// weights of the fields selected during the evaluation.
+	Cost uint64
+
+	// FieldCosts is the cost contributed by each weighted field name.
+	FieldCosts map[string]uint64
+}
+
+// ProgramOptions returns the CEL program options for the registry, such as
+// the options required for cost tracking (see WithCostTracking) and for
+// absent values (see WithAbsentValues).
+func (r *Registry) ProgramOptions() []cel.ProgramOption {
+	var prgOpts []cel.ProgramOption
+	if r.opts.absentValues {
+		prgOpts = append(prgOpts, AbsentSemantics())
+	}
+	if r.opts.costTracking {
+		prgOpts = append(prgOpts, cel.CostTracking(nil))
+		if len(r.opts.fieldCosts) > 0 {
+			prgOpts = append(prgOpts, cel.EvalOptions(cel.OptTrackState))
+		}
+	}
+	return prgOpts
+}
+
+// EvalCost evaluates the program, which must be created from the checked
+// AST with the registry's ProgramOptions, and returns the result with the
+// actual cost of the evaluation.
+//
+// A weighted field contributes its weight once for each selection of it
+// in the expression that was evaluated, regardless of how many times the
+// selection was evaluated within a comprehension.
+func (r *Registry) EvalCost(ast *cel.Ast, prg cel.Program, vars map[string]any) (*EvalResult, error) {
+	if !r.opts.costTracking {
+		return nil, fmt.Errorf("xcel: cost tracking is not enabled for the registry")
+	}
+
+	out, det, err := r.Eval(prg, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &EvalResult{Value: out}
+
+	if cost := det.ActualCost(); cost != nil {
+		result.Cost = *cost
+	}
+
+	if len(r.opts.fieldCosts) > 0 {
+		result.FieldCosts = map[string]uint64{}
+
+		walkExpr(ast.Expr(), func(e *exprpb.Expr) {
+			sel := e.GetSelectExpr()
+			if sel == nil || sel.GetTestOnly() {
+				return
+			}
+			weight, ok := r.opts.fieldCosts[sel.GetField()]
+			if !ok {
+				return
+			}
+			if _, evaluated := det.State().Value(e.GetId()); evaluated {
+				result.FieldCosts[sel.GetField()] += weight
+				result.Cost += weight
+			}
+		})
+	}
+
+	return result, nil
+}
@@ -0,0 +1,135 @@
+package xcel_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+const exampleExpr = "obj.name == 'test' && obj.age > 0 && ('test' in obj.tags) && obj.parent.name == 'root' && obj.pressure > 1.0"
+
+func newCostExample(tb testing.TB, opts ...xcel.Option) (*xcel.Registry, *cel.Ast, map[string]any) {
+	tb.Helper()
+
+	reg := xcel.NewRegistry(opts...)
+
+	ex := &Example{
+		Name: "test",
+		Age:  1,
+		Tags: []string{"test"},
+		Parent: &Example{
+			Name: "root",
+			Age:  -1,
+		},
+		Pressure: 1.5,
+	}
+
+	obj, typ := xcel.NewObject(ex)
+
+	xcel.RegisterObject(reg.Adapter, reg.Provider, obj, typ, xcel.NewFields(obj))
+
+	reg.Variable("obj", typ)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		tb.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile(exampleExpr)
+	if iss.Err() != nil {
+		tb.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	return reg, ast, map[string]any{"obj": obj}
+}
+
+func newCostProgram(tb testing.TB, reg *xcel.Registry, ast *cel.Ast) cel.Program {
+	tb.Helper()
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		tb.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	prg, err := env.Program(ast, reg.ProgramOptions()...)
+	if err != nil {
+		tb.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	return prg
+}
+
+func TestRegistryEvalCost(t *testing.T) {
+	reg, ast, vars := newCostExample(t, xcel.WithCostTracking(map[string]uint64{
+		"name": 10,
+		"tags": 5,
+	}))
+
+	prg := newCostProgram(t, reg, ast)
+
+	result, err := reg.EvalCost(ast, prg, vars)
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if result.Value != types.True {
+		t.Fatalf("expected 'true' but got '%v'", result.Value)
+	}
+
+	if fmt.Sprint(result.FieldCosts) != "map[name:20 tags:5]" {
+		t.Fatalf("unexpected field costs: %v", result.FieldCosts)
+	}
+
+	if result.Cost <= 25 {
+		t.Fatalf("expected field weights to be included in the cost, got %d", result.Cost)
+	}
+
+	untracked, ast, vars := newCostExample(t)
+	if _, err := untracked.EvalCost(ast, newCostProgram(t, untracked, ast), vars); err == nil {
+		t.Fatal("expected error when cost tracking is not enabled")
+	}
+}
+
+func BenchmarkRegistryEvalCost(b *testing.B) {
+	b.Run("disabled", func(b *testing.B) {
+		reg, ast, vars := newCostExample(b)
+		prg := newCostProgram(b, reg, ast)
+
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if _, _, err := reg.Eval(prg, vars); err != nil {
+				b.Fatalf("failed to evaluate program: %v", err)
+			}
+		}
+	})
+
+	b.Run("enabled", func(b *testing.B) {
+		reg, ast, vars := newCostExample(b, xcel.WithCostTracking(nil))
+		prg := newCostProgram(b, reg, ast)
+
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if _, err := reg.EvalCost(ast, prg, vars); err != nil {
+				b.Fatalf("failed to evaluate program: %v", err)
+			}
+		}
+	})
+
+	b.Run("field weights", func(b *testing.B) {
+		reg, ast, vars := newCostExample(b, xcel.WithCostTracking(map[string]uint64{"name": 10}))
+		prg := newCostProgram(b, reg, ast)
+
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if _, err := reg.EvalCost(ast, prg, vars); err != nil {
+				b.Fatalf("failed to evaluate program: %v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,52 @@
+// Package xcel exposes Go values to CEL expressions as objects, with their
+// fields derived from the Go types by NewFields.
+//
+// # Field names
+//
+// Fields are named by the name of their cel tag, such as
+// `cel:"container_id"`, or else by the name mappers given with
+// WithNameMapper and DefaultNameMapper. Like Go selectors, a field hides
+// the deeper fields promoted with the same name, and fields of the same
+// depth with the same name are an error, see NewFieldsE. Fields tagged
+// with `cel:"-"` are left out, along with the nested objects they refer
+// to and the fields promoted from them.
+//
+// # Presence
+//
+// A field is set, as tested by has(), unless it is a nil pointer, slice,
+// map, interface, func, or chan, or it is empty and its cel tag has the
+// omitempty option, such as `cel:",omitempty"`. See PresenceFromJSONTags,
+// WithPresence, and WithPresenceFunc for other presence policies.
+//
+// Numeric fields can treat sentinel values as unset with the setif option:
+// `cel:",setif=gt0"`, `cel:",setif=gte0"`, or `cel:",setif=nonzero"`.
+// Fields are unset when they equal the value of the unsetif option, such
+// as `cel:"age,unsetif=-1"`, and fields with the nonzero option are unset
+// when they are the zero value of their type. Unset fields evaluate to the
+// value of the default option, such as `cel:",nonzero,default=30s"`, while
+// has() is still false. Options which do not parse for the field's type
+// are an error.
+//
+// # Types
+//
+// Struct fields, struct pointers, and the elements and values of slices
+// and maps of them are nested objects, each of its own object type, which
+// RegisterObject registers along with the object. Nil struct pointers are
+// nil objects, so has() is false for their fields. The fields of embedded
+// structs and struct pointers are promoted, and fields promoted from more
+// than one embedded struct at the same depth are ambiguous and left out.
+//
+// Maps with string, integer, or bool keys are CEL maps, and pointers to
+// values other than structs have the type of the value they point to.
+// Arrays are lists, and byte arrays are bytes. Network addresses and
+// url.URL values are strings, see WithURLObjects, and errors are strings
+// of their message. Interface fields are dyn values converted for their
+// dynamic type when they are accessed, see WithImplementations.
+// json.RawMessage fields are bytes unless they are tagged with
+// `cel:",json"`, see WithParsedJSON. Fields of generated protobuf message
+// types have the message's proto type, see RegisterProtoType.
+//
+// Fields of kinds CEL has no type for, such as funcs and chans, are
+// skipped unless a type mapper maps them, see WithTypeMapper and
+// WithSkippedFields.
+package xcel
@@ -0,0 +1,99 @@
+package xcel
+
+import (
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// DomainFunctions returns a CEL environment option declaring DNS name
+// matching functions:
+//
+//	domain_suffix(string, string) -> bool  // the name is the domain or one of its subdomains
+//	registered_domain(string) -> string    // the registrable domain of the name, or ""
+//
+// Names are compared label by label, ignoring case and a trailing dot, so
+// "login.Example.com." has the domain suffix "example.com" but
+// "evilexample.com" does not. Internationalized names are compared as given,
+// so they should be normalized to the same form (A-labels or U-labels)
+// beforehand.
+//
+// The registrable domain is one label more than the longest matching public
+// suffix from the given list, such as "co.uk". Without a matching suffix,
+// the top-level label is used as the public suffix.
+func DomainFunctions(publicSuffixes ...string) cel.EnvOption {
+	suffixes := make(map[string]struct{}, len(publicSuffixes))
+	for _, suffix := range publicSuffixes {
+		suffixes[normalizeDomain(suffix)] = struct{}{}
+	}
+
+	return cel.Lib(library{
+		cel.Function("domain_suffix",
+			cel.Overload("domain_suffix_string_string", []*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+				cel.BinaryBinding(func(lhs, rhs ref.Val) ref.Val {
+					name, ok := lhs.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(lhs)
+					}
+					domain, ok := rhs.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(rhs)
+					}
+					return types.Bool(HasDomainSuffix(string(name), string(domain)))
+				}),
+			),
+		),
+		cel.Function("registered_domain",
+			cel.Overload("registered_domain_string", []*cel.Type{cel.StringType}, cel.StringType,
+				cel.UnaryBinding(func(arg ref.Val) ref.Val {
+					name, ok := arg.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(arg)
+					}
+					return types.String(registeredDomain(string(name), suffixes))
+				}),
+			),
+		),
+	})
+}
+
+// HasDomainSuffix returns true if the DNS name is the domain or one of its
+// subdomains, comparing labels case insensitively and ignoring trailing dots.
+func HasDomainSuffix(name, domain string) bool {
+	name, domain = normalizeDomain(name), normalizeDomain(domain)
+	if domain == "" {
+		return false
+	}
+	return name == domain || strings.HasSuffix(name, "."+domain)
+}
+
+// registeredDomain returns the registrable domain of the DNS name using the
+// given normalized public suffixes, or "" if the name is a public suffix.
+func registeredDomain(name string, suffixes map[string]struct{}) string {
+	labels := strings.Split(normalizeDomain(name), ".")
+	if len(labels) < 2 || labels[0] == "" {
+		return ""
+	}
+
+	// Default to the top-level label, then find the longest listed suffix.
+	suffixLen := 1
+	for i := 0; i < len(labels)-1; i++ {
+		if _, ok := suffixes[strings.Join(labels[i:], ".")]; ok {
+			suffixLen = len(labels) - i
+			break
+		}
+	}
+
+	if suffixLen >= len(labels) {
+		return ""
+	}
+
+	return strings.Join(labels[len(labels)-suffixLen-1:], ".")
+}
+
+// normalizeDomain lower cases the DNS name and removes any trailing dot.
+func normalizeDomain(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
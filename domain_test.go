@@ -0,0 +1,51 @@
+package xcel_test
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/picatz/xcel"
+)
+
+func TestDomainFunctions(t *testing.T) {
+	env, err := cel.NewEnv(xcel.DomainFunctions("co.uk", "github.io"))
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	tests := map[string]ref.Val{
+		`domain_suffix('example.com', 'example.com')`:          types.True,
+		`domain_suffix('login.Example.COM.', 'example.com')`:   types.True,
+		`domain_suffix('evilexample.com', 'example.com')`:      types.False,
+		`domain_suffix('example.com.evil.net', 'example.com')`: types.False,
+		`domain_suffix('example.com', '')`:                     types.False,
+		`registered_domain('a.b.example.com')`:                 types.String("example.com"),
+		`registered_domain('www.bbc.co.uk.')`:                  types.String("bbc.co.uk"),
+		`registered_domain('picatz.github.io')`:                types.String("picatz.github.io"),
+		`registered_domain('co.uk')`:                           types.String(""),
+		`registered_domain('localhost')`:                       types.String(""),
+	}
+
+	for expr, want := range tests {
+		ast, iss := env.Compile(expr)
+		if iss.Err() != nil {
+			t.Fatalf("failed to compile %q: %v", expr, iss.Err())
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		out, _, err := prg.Eval(map[string]any{})
+		if err != nil {
+			t.Fatalf("failed to evaluate %q: %v", expr, err)
+		}
+
+		if out.Equal(want) != types.True {
+			t.Errorf("expected %v for %q but got '%v'", want, expr, out)
+		}
+	}
+}
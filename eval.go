@@ -0,0 +1,69 @@
+package xcel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// ErrEvalTimeout is returned by EvalWithDeadline when an evaluation is
+// interrupted because its deadline was exceeded.
+var ErrEvalTimeout = errors.New("xcel: evaluation deadline exceeded")
+
+// InterruptCheckFrequency is the number of comprehension iterations between
+// cancellation checks used by Interruptible.
+const InterruptCheckFrequency = 100
+
+// Interruptible returns the CEL program option required for evaluations with
+// EvalWithDeadline to be interrupted, checking for cancellation every
+// InterruptCheckFrequency comprehension iterations.
+func Interruptible() cel.ProgramOption {
+	return cel.InterruptCheckFrequency(InterruptCheckFrequency)
+}
+
+// EvalWithDeadline evaluates the program with the given variables, which are
+// either a map[string]any or an interpreter.Activation, until the context is
+// done. Use WithEvalTimeout to bound the evaluation by a timeout in addition
+// to the context's own deadline.
+//
+// The program must be created with the Interruptible option (or another
+// non-zero cel.InterruptCheckFrequency) for long running comprehensions to
+// be interrupted. Cancellation is checked between comprehension iterations,
+// so a single slow field getter or function call is not interrupted.
+//
+// If the deadline is exceeded, the returned error wraps ErrEvalTimeout, and if
+// the context is canceled, it wraps context.Canceled.
+func EvalWithDeadline(ctx context.Context, prg cel.Program, vars any, opts ...Option) (ref.Val, *cel.EvalDetails, error) {
+	o := newOptions(opts...)
+	if err := o.check("EvalWithDeadline", evalScope); err != nil {
+		return nil, nil, err
+	}
+
+	if o.evalTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.evalTimeout)
+		defer cancel()
+	}
+
+	out, det, err := prg.ContextEval(ctx, vars)
+	if err != nil {
+		switch ctxErr := ctx.Err(); {
+		case errors.Is(ctxErr, context.DeadlineExceeded):
+			return nil, det, fmt.Errorf("%w: %v", ErrEvalTimeout, err)
+		case ctxErr != nil:
+			return nil, det, fmt.Errorf("%w: %v", ctxErr, err)
+		}
+	}
+	return out, det, err
+}
+
+// WithEvalTimeout bounds evaluations with EvalWithDeadline by the timeout.
+func WithEvalTimeout(d time.Duration) Option {
+	return option("WithEvalTimeout", evalScope, func(o *options) {
+		o.evalTimeout = d
+	})
+}
@@ -0,0 +1,73 @@
+package xcel_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+func TestEvalWithDeadline(t *testing.T) {
+	env, err := cel.NewEnv(cel.Variable("values", cel.ListType(cel.IntType)))
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("values.map(x, values.filter(y, y > x).size()).size() == size(values)")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast, xcel.Interruptible())
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	t.Run("within deadline", func(t *testing.T) {
+		out, _, err := xcel.EvalWithDeadline(context.Background(), prg, map[string]any{
+			"values": []int{1, 2, 3},
+		}, xcel.WithEvalTimeout(time.Second))
+		if err != nil {
+			t.Fatalf("failed to evaluate program: %v", err)
+		}
+		if out != types.True {
+			t.Fatalf("expected 'true' but got '%v'", out)
+		}
+	})
+
+	t.Run("deadline exceeded", func(t *testing.T) {
+		values := make([]int, 20_000)
+		for i := range values {
+			values[i] = i
+		}
+
+		start := time.Now()
+
+		_, _, err := xcel.EvalWithDeadline(context.Background(), prg, map[string]any{
+			"values": values,
+		}, xcel.WithEvalTimeout(50*time.Millisecond))
+		if !errors.Is(err, xcel.ErrEvalTimeout) {
+			t.Fatalf("expected timeout error, got: %v", err)
+		}
+
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("expected evaluation to be interrupted near the deadline, took %v", elapsed)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, _, err := xcel.EvalWithDeadline(ctx, prg, map[string]any{
+			"values": make([]int, 1000),
+		})
+		if !errors.Is(err, context.Canceled) || errors.Is(err, xcel.ErrEvalTimeout) {
+			t.Fatalf("expected cancellation error, got: %v", err)
+		}
+	})
+}
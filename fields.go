@@ -0,0 +1,1585 @@
+package xcel
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"google.golang.org/protobuf/proto"
+)
+
+// NewFields returns a map[string]*types.FieldType for the given object type
+// wrapping a Go struct pointer value, see the package documentation.
+func NewFields[T any](objt *Object[T], opts ...Option) map[string]*types.FieldType {
+	fields, err := NewFieldsE(objt, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return fields
+}
+
+// FieldCollisionError reports two fields of an object type with the same
+// name at the same depth of embedding, such as fields named by their cel
+// tag, see NewFieldsE.
+type FieldCollisionError struct {
+	// Type is the CEL type name of the object type.
+	Type string
+
+	// Name is the CEL name of the fields.
+	Name string
+
+	// Paths are the dotted paths of Go field names of the fields, the
+	// first being the field which was derived first.
+	Paths [2]string
+}
+
+// Error implements the error interface.
+func (e *FieldCollisionError) Error() string {
+	return fmt.Sprintf("xcel: fields '%s' and '%s' of '%s' are both named '%s'", e.Paths[0], e.Paths[1], e.Type, e.Name)
+}
+
+// NewFieldsE is like NewFields, but returns an error instead of panicking,
+// such as for types supplied by plugins of a long-running process. Each
+// field whose name collides with another one is reported, as a
+// *FieldCollisionError, along with the other errors joined with
+// errors.Join.
+func NewFieldsE[T any](objt *Object[T], opts ...Option) (map[string]*types.FieldType, error) {
+	o := newOptions(opts...)
+	if err := o.check("NewFields", fieldScope); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]*types.FieldType{}
+
+	b := &fieldsBuilder{
+		o: o,
+		// The adapter is only known once the object is registered.
+		adapter: func() types.Adapter {
+			return objt.adapterOrDefault()
+		},
+		nested:  map[reflect.Type]*nestedObject{},
+		matched: map[string]bool{},
+	}
+
+	// Fields of the same type as the object are wrapped as objects, so
+	// they can be used with the same fields and member functions.
+	wrap := func(value any) ref.Val {
+		return &Object[T]{Raw: value.(T), fields: fields, adapter: objt.adapter, opts: objt.opts}
+	}
+
+	rt := reflect.TypeOf(objt.Raw)
+	if rt.Kind() == reflect.Pointer {
+		b.nested[rt] = &nestedObject{rt: rt, typ: objectTypeOf(objt.Raw), fields: fields, wrap: wrap}
+	}
+
+	b.addFields(fields, objectTypeOf(objt.Raw).TypeName(), rt, reflect.ValueOf(objt.Raw), wrap)
+
+	if b.o.flattenDepth > 0 {
+		b.flattenFields(fields, b.o.flattenDepth)
+	}
+
+	b.errs = append(b.errs, b.o.fieldListErrors(b.matched)...)
+	b.errs = append(b.errs, b.o.valueLimitErrors()...)
+
+	if len(b.errs) > 0 {
+		return nil, errors.Join(b.errs...)
+	}
+
+	objt.nested, objt.protos = b.order, b.protos
+
+	return fields, nil
+}
+
+// flattenFields adds the fields of the nested objects of the given fields,
+// up to depth levels of nesting, prefixed with the name of the field they
+// are nested in, such as runtime_container_id for runtime.container_id.
+// Flattened names colliding with another field are reported as errors.
+func (b *fieldsBuilder) flattenFields(fields map[string]*types.FieldType, depth int) {
+	// The fields of each nested object type as they were derived, since
+	// the object's own fields gain the flattened ones.
+	objects := map[string]map[string]*types.FieldType{}
+	for _, n := range b.nested {
+		objects[n.typ.TypeName()] = n.fields
+	}
+	for name, nested := range objects {
+		copied := make(map[string]*types.FieldType, len(nested))
+		for k, v := range nested {
+			copied[k] = v
+		}
+		objects[name] = copied
+	}
+
+	var flatten func(name string, field *types.FieldType, depth int)
+	flatten = func(name string, field *types.FieldType, depth int) {
+		nested, ok := objects[field.Type.TypeName()]
+		if !ok || field.Type.Kind() != types.StructKind || depth == 0 {
+			return
+		}
+		for _, leaf := range sortedFieldNames(nested) {
+			flat := name + "_" + leaf
+			if _, ok := fields[flat]; ok {
+				b.errs = append(b.errs, fmt.Errorf("xcel: flattened field '%s' collides with another field", flat))
+				continue
+			}
+			fields[flat] = flattenedField(field, nested[leaf])
+			flatten(flat, fields[flat], depth-1)
+		}
+	}
+
+	for _, name := range sortedFieldNames(fields) {
+		flatten(name, fields[name], depth)
+	}
+}
+
+// flattenedField returns the field of the nested object held by the outer
+// field, which is unset when the outer field is.
+func flattenedField(outer, inner *types.FieldType) *types.FieldType {
+	return &types.FieldType{
+		Type: inner.Type,
+		IsSet: ref.FieldTester(func(target any) bool {
+			if !outer.IsSet(target) {
+				return false
+			}
+			v, err := outer.GetFrom(target)
+			return err == nil && inner.IsSet(v)
+		}),
+		GetFrom: ref.FieldGetter(func(target any) (any, error) {
+			v, err := outer.GetFrom(target)
+			if err != nil {
+				return nil, err
+			}
+			return inner.GetFrom(v)
+		}),
+	}
+}
+
+// fieldsBuilder derives the fields of an object type and the nested object
+// types they refer to.
+type fieldsBuilder struct {
+	o       *options
+	adapter func() types.Adapter
+
+	// nested are the object types by their Go struct pointer type, in
+	// the order they were found, not including the root object type.
+	nested map[reflect.Type]*nestedObject
+	order  []*nestedObject
+
+	// protos are the protobuf message types of fields, which are
+	// registered along with the object by RegisterObject.
+	protos []proto.Message
+
+	// scope is the CEL type name and Go field name of the field whose
+	// type is being derived, such as "*pkg.Config.Limits", which names
+	// nested objects of anonymous struct types.
+	scope string
+
+	// errs are the errors found while deriving the fields, such as
+	// fields with the same name, which are all reported at once.
+	errs []error
+
+	// path is the dotted path of CEL names from the object to the field
+	// whose type is being derived, such as "runtime.container_id", and
+	// matched are the paths given with WithIncludeFields and
+	// WithExcludeFields which matched a field.
+	path    string
+	matched map[string]bool
+
+	// depth is the nesting depth of the object whose fields are being
+	// derived, the object itself being 0, and truncated is set when the
+	// type of a field refers to a nested object beyond WithMaxDepth.
+	depth     int
+	truncated bool
+}
+
+// nestedObject is an object type referred to by the fields of another,
+// such as the values of a map field, see RegisterNestedType.
+type nestedObject struct {
+	rt     reflect.Type
+	typ    *types.Type
+	fields map[string]*types.FieldType
+	wrap   func(any) ref.Val
+}
+
+// nestedObject returns the nested object type for the Go struct pointer
+// type, deriving its fields the first time it is found.
+func (b *fieldsBuilder) nestedObject(rt reflect.Type) *nestedObject {
+	if n, ok := b.nested[rt]; ok {
+		return n
+	}
+
+	n := &nestedObject{rt: rt, typ: objectTypeOf(reflect.Zero(rt).Interface()), fields: map[string]*types.FieldType{}}
+	if b.o.maxDepth > 0 && b.depth+1 >= b.o.maxDepth {
+		// The field referring to the object is left out, so the
+		// object is neither derived nor registered.
+		b.truncated = true
+		return n
+	}
+	if rt.Elem().Name() == "" {
+		// Anonymous struct types, such as struct{ CPU, Memory int64 }, are
+		// named after the field they were first found in.
+		n.typ = cel.ObjectType(b.scope, traits.ReceiverType)
+	}
+	n.wrap = func(value any) ref.Val {
+		return &Object[any]{Raw: value, fields: n.fields, adapter: b.adapter(), opts: b.o, typ: n.typ}
+	}
+
+	b.nested[rt] = n
+	b.order = append(b.order, n)
+
+	b.depth++
+	b.addFields(n.fields, n.typ.TypeName(), rt, reflect.Value{}, n.wrap)
+	b.depth--
+	b.truncated = false
+
+	return n
+}
+
+// addFields adds the fields for the exported fields of the given struct,
+// or pointer to struct, type named typeName, including those promoted from
+// embedded structs (see promotedFields). The sample value is used to promote
+// fields through embedded interfaces.
+func (b *fieldsBuilder) addFields(fields map[string]*types.FieldType, typeName string, rt reflect.Type, sample reflect.Value, wrap func(any) ref.Val) {
+	o, adapter, prefix := b.o, b.adapter, b.path
+
+	if o.skipped != nil && !o.noPromotion && !o.collisionRename {
+		for _, pf := range ambiguousFields(rt, sample, o.impls) {
+			if pf.IsExported() && !pf.excluded && !(pf.Anonymous && isStructType(pf.Type)) {
+				o.skipped(SkippedField{Path: pf.goPath(), Type: pf.Type, Ambiguous: true})
+			}
+		}
+	}
+
+	var candidates, embeds []promotedField
+	for _, pf := range promotedFields(rt, sample, o.impls) {
+		switch {
+		case !pf.IsExported(), pf.excluded:
+		case o.noPromotion:
+			// Embedded structs are fields like any other, and the
+			// fields promoted from them are left out.
+			if len(pf.path) == 1 {
+				candidates = append(candidates, pf)
+			}
+		case pf.Anonymous && isStructType(pf.Type):
+			if o.embeddedPaths {
+				embeds = append(embeds, pf)
+			}
+		default:
+			candidates = append(candidates, pf)
+		}
+	}
+
+	var renamed map[string]string
+	if o.collisionRename && !o.noPromotion {
+		var hidden []promotedField
+		hidden, renamed = b.renameCollisions(rt, candidates)
+		candidates = append(candidates, hidden...)
+	}
+
+	// Like Go selectors, fields with the same name resolve to the
+	// shallowest one, so shallower fields are added first and hide the
+	// deeper fields named like them, such as a direct ContainerID field
+	// and a ContainerId field promoted from an embedded struct.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].depth < candidates[j].depth
+	})
+
+	// added are the fields added by name, to report fields of the same
+	// depth mapped to the same name.
+	added := map[string]promotedField{}
+
+	// Embedded structs are added after the other fields, so their
+	// names never take precedence over the fields they collide with.
+	for _, pf := range append(candidates, embeds...) {
+		sf := pf.StructField
+
+		goPath := make([]string, len(pf.path))
+		for i, step := range pf.path {
+			goPath[i] = step.name
+		}
+
+		name, path := o.fieldName(goPath, sf), pf.path
+		if qualified, ok := renamed[pf.goPath()]; ok {
+			name = qualified
+		}
+
+		fieldPath := name
+		if prefix != "" {
+			fieldPath = prefix + "." + name
+		}
+		if !o.fieldAllowed(fieldPath, b.matched) {
+			continue
+		}
+
+		if _, ok := fields[name]; ok && sf.Anonymous {
+			if o.skipped != nil {
+				o.skipped(SkippedField{Path: pf.goPath(), Type: sf.Type, Ambiguous: true})
+			}
+			continue
+		}
+		if other, ok := added[name]; ok {
+			if other.depth == pf.depth {
+				b.errs = append(b.errs, &FieldCollisionError{Type: typeName, Name: name, Paths: [2]string{other.goPath(), pf.goPath()}})
+			}
+			continue
+		}
+
+		b.scope, b.path, b.truncated = typeName+"."+sf.Name, fieldPath, false
+		errs := len(b.errs)
+		typ, convert, ok := b.fieldType(sf)
+		if b.truncated {
+			if o.skipped != nil {
+				o.skipped(SkippedField{Path: pf.goPath(), Type: sf.Type, Truncated: true})
+			}
+			continue
+		}
+		if !ok {
+			// Fields reported as errors, such as maps with unsupported
+			// keys, are not skipped.
+			if o.skipped != nil && len(b.errs) == errs {
+				o.skipped(SkippedField{Path: pf.goPath(), Type: sf.Type})
+			}
+			continue
+		}
+
+		limit, limited := o.maxValueSizes[name]
+
+		omitEmpty := tagHasOption(sf.Tag.Get("cel"), "omitempty") ||
+			o.jsonPresence && tagHasOption(sf.Tag.Get("json"), "omitempty")
+
+		setIf, err := setIfPredicate(sf)
+		if err != nil {
+			b.errs = append(b.errs, err)
+			continue
+		}
+
+		unsetIf, err := unsetIfPredicate(sf)
+		if err != nil {
+			b.errs = append(b.errs, err)
+			continue
+		}
+
+		defaultValue, err := fieldDefault(sf, typ)
+		if err != nil {
+			b.errs = append(b.errs, err)
+			continue
+		}
+
+		isSet := func(target any) bool {
+			v, err := structValue(target)
+			if err != nil {
+				return false
+			}
+
+			fv, err := getNestedField(v, path, sf.Type)
+			if rtErr, ok := err.(*runtimeTypeError); ok {
+				switch o.dynamicTypeMode {
+				case DynamicTypeStrict:
+					return true
+				case DynamicTypeDispatch:
+					if obj, field, ok := dispatchField(adapter(), rtErr.dynamic, name); ok {
+						return field.IsSet(obj)
+					}
+				}
+				return false
+			}
+
+			return err == nil && o.fieldPresent(fv, sf) && !(omitEmpty && isEmptyValue(fv)) && (setIf == nil || setIf(fv)) && (unsetIf == nil || unsetIf(fv))
+		}
+
+		added[name] = pf
+
+		absentValue := o.absentValues && typ.Kind() != types.StructKind
+
+		fields[name] = &types.FieldType{
+			Type:  typ,
+			IsSet: ref.FieldTester(isSet),
+			GetFrom: hookedFieldGetter(name, func(target any) (any, error) {
+				if defaultValue != nil && !isSet(target) {
+					return defaultValue, nil
+				}
+				if absentValue && !isSet(target) {
+					return absent{field: name, typ: typ}, nil
+				}
+
+				v, err := structValue(target)
+				if errors.Is(err, errNilObject) {
+					return absentField(name, sf.Type, rt, wrap)
+				}
+				if err != nil {
+					return nil, err
+				}
+
+				fv, err := getNestedField(v, path, sf.Type)
+				if rtErr, ok := err.(*runtimeTypeError); ok {
+					if o.dynamicTypeMode == DynamicTypeDispatch {
+						if obj, field, ok := dispatchField(adapter(), rtErr.dynamic, name); ok {
+							return field.GetFrom(obj)
+						}
+					}
+					return nil, fmt.Errorf("xcel: field '%s' %v", name, rtErr)
+				}
+				if err != nil {
+					return absentField(name, sf.Type, rt, wrap)
+				}
+
+				if fv.Kind() == reflect.Interface && fv.IsNil() {
+					return absent{field: name}, nil
+				}
+
+				if fv.Type() == rt {
+					return wrap(fv.Interface()), nil
+				}
+
+				if limited {
+					if fv, err = limit.apply(name, fv); err != nil {
+						return nil, err
+					}
+				}
+
+				cv, err := convert(fv)
+				if errors.Is(err, errNilField) {
+					return absentField(name, sf.Type, rt, wrap)
+				}
+				return cv, err
+			}),
+		}
+	}
+}
+
+// fieldType returns the CEL type and conversion of the field from the first
+// type mapper which does not defer, consulting the mappers given as options
+// before those for collections of nested objects and DefaultTypeMapper, or
+// false if the field is of a kind CEL has no type for, see isSupportedKind.
+func (b *fieldsBuilder) fieldType(sf reflect.StructField) (*types.Type, ConvertFunc, bool) {
+	for _, m := range b.o.typeMappers {
+		if t, convert, ok := m(sf); ok {
+			return t, convert, true
+		}
+	}
+	if !isSupportedKind(sf.Type) {
+		return nil, nil, false
+	}
+	if t, convert, ok := b.objectCollectionType(sf.Type); ok {
+		return t, convert, true
+	}
+	if t, convert, ok := b.dynCollectionType(sf.Type); ok {
+		return t, convert, true
+	}
+	if isProtoType(sf.Type) {
+		t, convert := b.protoFieldType(sf.Type)
+		return t, convert, true
+	}
+	if isURLType(sf.Type) {
+		t, convert := b.urlFieldType()
+		return t, convert, true
+	}
+	if isBigType(sf.Type) {
+		strings := b.o.bigNumberStrings
+		return bigType(sf.Type, strings), func(v reflect.Value) (any, error) {
+			return bigValue(v, strings)
+		}, true
+	}
+	if sf.Type == jsonRawMessageType && (b.o.parsedJSON || tagHasOption(sf.Tag.Get("cel"), "json")) {
+		return types.DynType, parseJSONField, true
+	}
+	if b.o.textMarshalers {
+		if t, convert, ok := textFieldType(sf.Type); ok {
+			return t, convert, true
+		}
+	}
+	if b.o.stringerFallback {
+		if t, convert, ok := b.o.stringerFieldType(sf.Type); ok {
+			return t, convert, true
+		}
+	}
+	if elem, ok := objectElemType(sf.Type); ok {
+		t, convert := b.objectFieldType(elem)
+		return t, convert, true
+	}
+	if sf.Type.Kind() == reflect.Interface && !isErrorType(sf.Type) {
+		b.implementationObjects(sf.Type)
+	}
+	if sf.Type.Kind() == reflect.Map {
+		if _, ok := mapKeyType(sf.Type.Key()); !ok {
+			b.errs = append(b.errs, fmt.Errorf("xcel: unsupported key type '%s' of map field '%s', expected string, int, uint, or bool keys", sf.Type.Key(), sf.Name))
+			return nil, nil, false
+		}
+	}
+	return DefaultTypeMapper(sf)
+}
+
+// isSupportedKind reports whether the type, or the type it points to, is
+// of a kind CEL values can be derived from, unlike funcs, chans, complex
+// numbers, and unsafe pointers.
+func isSupportedKind(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Func, reflect.Chan, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer, reflect.Uintptr:
+		return false
+	}
+	return true
+}
+
+// objectFieldType returns the CEL type and conversion for struct and struct
+// pointer fields, which are nested objects of the struct pointer type. Struct
+// values are copied to pointers when they are accessed.
+func (b *fieldsBuilder) objectFieldType(elem reflect.Type) (*types.Type, ConvertFunc) {
+	n := b.nestedObject(elem)
+
+	return n.typ, func(v reflect.Value) (any, error) {
+		if v.Kind() == reflect.Pointer {
+			return n.wrap(v.Interface()), nil
+		}
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		return n.wrap(p.Interface()), nil
+	}
+}
+
+// objectCollectionType returns the CEL type and conversion for slices and
+// maps whose elements are nested objects, which are wrapped as objects when
+// they are accessed.
+func (b *fieldsBuilder) objectCollectionType(t reflect.Type) (*types.Type, ConvertFunc, bool) {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return b.objectListType(t)
+	case reflect.Map:
+		return b.objectMapType(t)
+	}
+	return nil, nil, false
+}
+
+// objectListType returns the CEL type and conversion for slices and arrays
+// of nested objects. The slice is not copied; only the elements which are
+// accessed are wrapped.
+func (b *fieldsBuilder) objectListType(t reflect.Type) (*types.Type, ConvertFunc, bool) {
+	elem, ok := objectElemType(t.Elem())
+	if !ok {
+		return nil, nil, false
+	}
+
+	n := b.nestedObject(elem)
+
+	convert := func(v reflect.Value) (any, error) {
+		return types.NewDynamicList(&objectAdapter{Adapter: b.adapter(), elem: n}, v.Interface()), nil
+	}
+
+	return types.NewListType(n.typ), convert, true
+}
+
+// objectMapType returns the CEL type and conversion for maps whose values
+// are nested objects.
+func (b *fieldsBuilder) objectMapType(t reflect.Type) (*types.Type, ConvertFunc, bool) {
+
+	kt, ok := mapKeyType(t.Key())
+	if !ok {
+		return nil, nil, false
+	}
+
+	elem, ok := objectElemType(t.Elem())
+	if !ok {
+		return nil, nil, false
+	}
+
+	n := b.nestedObject(elem)
+
+	convert := func(v reflect.Value) (any, error) {
+		adapter := &objectAdapter{Adapter: b.adapter(), elem: n}
+		if !isNativeKeyType(t.Key()) {
+			return newKeyMap(adapter, v, reflect.Value.Interface), nil
+		}
+		return types.NewDynamicMap(adapter, v.Interface()), nil
+	}
+
+	return types.NewMapType(kt, n.typ), convert, true
+}
+
+// isNativeKeyType reports whether map keys of the type can be looked up
+// with CEL values without converting them, see convertMap.
+func isNativeKeyType(t reflect.Type) bool {
+	return t == reflect.TypeOf(primitiveValue(reflect.Zero(t)))
+}
+
+// objectElemType returns the Go struct pointer type for a struct or struct
+// pointer type of nested objects.
+func objectElemType(t reflect.Type) (reflect.Type, bool) {
+	if isScalarStructType(t) {
+		return nil, false
+	}
+	switch {
+	case t.Kind() == reflect.Struct:
+		return reflect.PointerTo(t), true
+	case t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct:
+		return t, true
+	}
+	return nil, false
+}
+
+// objectAdapter wraps the elements of a collection of nested objects as
+// objects when they are accessed, copying struct values to pointers.
+type objectAdapter struct {
+	types.Adapter
+
+	elem *nestedObject
+}
+
+// NativeToValue implements the types.Adapter interface.
+func (a *objectAdapter) NativeToValue(value any) ref.Val {
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Type() == a.elem.rt:
+		return a.elem.wrap(value)
+	case v.Type() == a.elem.rt.Elem():
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		return a.elem.wrap(p.Interface())
+	}
+	return a.Adapter.NativeToValue(value)
+}
+
+// fieldHooks is implemented by objects which cache or observe the values
+// read by their field getters during one evaluation, see RuleSet and
+// Registry.Trace.
+type fieldHooks interface {
+	fieldValues() map[string]any
+	fieldAccessed(name string, value any)
+}
+
+// hookedFieldGetter returns a field getter which reads the named field
+// through the target's field value cache, if it has one, and reports the
+// value to the target's field access hook.
+func hookedFieldGetter(name string, get ref.FieldGetter) ref.FieldGetter {
+	return func(target any) (any, error) {
+		h, ok := target.(fieldHooks)
+		if !ok {
+			return get(target)
+		}
+		values := h.fieldValues()
+		if v, ok := values[name]; ok {
+			h.fieldAccessed(name, v)
+			return v, nil
+		}
+		v, err := get(target)
+		if err != nil {
+			return nil, err
+		}
+		if values != nil {
+			values[name] = v
+		}
+		h.fieldAccessed(name, v)
+		return v, nil
+	}
+}
+
+// isStructType reports whether the type is a struct or pointer to struct.
+func isStructType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// celTypeForField returns the CEL type for a Go struct field type, falling
+// back to an object type named after the Go type. Structs and struct
+// pointers have the object type of the struct pointer, the name their
+// nested objects are registered under, see objectTypeOf.
+func celTypeForField(t reflect.Type) *types.Type {
+	if isTimeType(t) {
+		return types.TimestampType
+	}
+	if isDurationType(t) {
+		return types.DurationType
+	}
+	if isAddrType(t) {
+		return types.StringType
+	}
+	if isBigType(t) {
+		return bigType(t, false)
+	}
+	if isErrorType(t) {
+		return types.StringType
+	}
+	if t.Kind() == reflect.Pointer && t.Elem().Kind() != reflect.Struct {
+		// Pointers distinguishing absent from empty values, such as a
+		// *[]string, have the type of the value they point to.
+		return celTypeForField(t.Elem())
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return types.StringType
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return types.IntType
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return types.UintType
+	case reflect.Float32, reflect.Float64:
+		return types.DoubleType
+	case reflect.Bool:
+		return types.BoolType
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return types.BytesType
+		}
+		if lt, ok := listType(t); ok {
+			return lt
+		}
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return types.BytesType
+		}
+		if lt, ok := listType(t); ok {
+			return lt
+		}
+	case reflect.Interface:
+		return types.DynType
+	case reflect.Map:
+		if kt, ok := mapKeyType(t.Key()); ok {
+			if vt, ok := primitiveType(t.Elem()); ok {
+				return types.NewMapType(kt, vt)
+			}
+			if vt, ok := listType(t.Elem()); ok {
+				return types.NewMapType(kt, vt)
+			}
+		}
+	case reflect.Struct:
+		return objectTypeOf(reflect.Zero(reflect.PointerTo(t)).Interface())
+	case reflect.Pointer:
+		return objectTypeOf(reflect.Zero(t).Interface())
+	}
+	return cel.ObjectType(t.String(), traits.ReceiverType)
+}
+
+// timeType is the reflect type of time.Time.
+var timeType = reflect.TypeOf(time.Time{})
+
+// isTimeType reports whether the type is time.Time, a named type whose
+// underlying type is time.Time (type EventTime time.Time), or a pointer
+// to either.
+func isTimeType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t == timeType || t.Kind() == reflect.Struct && t.ConvertibleTo(timeType)
+}
+
+// durationType is the reflect type of time.Duration.
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// isDurationType reports whether the type is time.Duration or a pointer
+// to it.
+func isDurationType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t == durationType
+}
+
+// isScalarStructType reports whether the type is a struct type, or pointer
+// to one, whose values are converted to CEL scalars rather than objects,
+// such as time.Time, netip.Addr, or big.Int.
+func isScalarStructType(t reflect.Type) bool {
+	return isTimeType(t) || isAddrType(t) || isURLType(t) || isBigType(t) || isErrorType(t) || isProtoType(t)
+}
+
+// errorType is the reflect type of the error interface.
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// isErrorType reports whether the type is error or implements it, in which
+// case values of the type are strings of their message.
+func isErrorType(t reflect.Type) bool {
+	return t.Implements(errorType)
+}
+
+// Reflect types of the network address types which are strings in CEL.
+var (
+	ipType     = reflect.TypeOf(net.IP(nil))
+	addrType   = reflect.TypeOf(netip.Addr{})
+	prefixType = reflect.TypeOf(netip.Prefix{})
+)
+
+// isAddrType reports whether the type is net.IP, netip.Addr, netip.Prefix,
+// or a pointer to one of them.
+func isAddrType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t == ipType || t == addrType || t == prefixType
+}
+
+// addrString returns the canonical string form of a network address value,
+// where IPv4-mapped IPv6 addresses are IPv4 addresses, so that ::ffff:10.0.0.1
+// and 10.0.0.1 compare equal, like net.IP formats them.
+func addrString(v reflect.Value) any {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return types.NullValue
+		}
+		v = v.Elem()
+	}
+	switch addr := v.Interface().(type) {
+	case net.IP:
+		if addr == nil {
+			return types.NullValue
+		}
+		return addr.String()
+	case netip.Addr:
+		return addr.Unmap().String()
+	case netip.Prefix:
+		if a := addr.Addr(); a.Is4In6() && addr.Bits() >= 96 {
+			addr = netip.PrefixFrom(a.Unmap(), addr.Bits()-96)
+		}
+		return addr.String()
+	}
+	return v.Interface()
+}
+
+// primitiveType returns the CEL type for Go types of primitive kinds.
+func primitiveType(t reflect.Type) (*types.Type, bool) {
+	switch t.Kind() {
+	case reflect.String:
+		return types.StringType, true
+	case reflect.Bool:
+		return types.BoolType, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return types.IntType, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return types.UintType, true
+	case reflect.Float32, reflect.Float64:
+		return types.DoubleType, true
+	}
+	return nil, false
+}
+
+// primitiveValue returns the value of a primitive kind as the Go type the
+// CEL type adapter supports for its CEL type, such as int64 for an int16
+// or a named integer type.
+func primitiveValue(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return v.Interface()
+}
+
+// convertForCEL returns the field value in a form the CEL type adapter
+// supports, such as a timestamp for named time types or a duration for
+// time.Duration.
+func convertForCEL(v reflect.Value) (any, error) {
+	if v.Kind() == reflect.Interface {
+		// Values of dyn fields are converted for their dynamic type.
+		if v.IsNil() {
+			return types.NullValue, nil
+		}
+		v = v.Elem()
+	}
+	if isTimeType(v.Type()) {
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return types.NullValue, nil
+			}
+			v = v.Elem()
+		}
+		return types.Timestamp{Time: v.Convert(timeType).Interface().(time.Time)}, nil
+	}
+	if isDurationType(v.Type()) {
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return types.NullValue, nil
+			}
+			v = v.Elem()
+		}
+		return types.Duration{Duration: time.Duration(v.Int())}, nil
+	}
+	if isAddrType(v.Type()) {
+		return addrString(v), nil
+	}
+	if isBigType(v.Type()) {
+		return bigValue(v, false)
+	}
+	if isErrorType(v.Type()) {
+		if !presenceIsSet(v) {
+			return types.NullValue, nil
+		}
+		return v.Interface().(error).Error(), nil
+	}
+	if v.Kind() == reflect.Pointer && v.Type().Elem().Kind() != reflect.Struct {
+		if v.IsNil() {
+			return nil, errNilField
+		}
+		return convertForCEL(v.Elem())
+	}
+	if v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8 {
+		b := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(b), v)
+		return types.Bytes(b), nil
+	}
+	if _, ok := listType(v.Type()); ok && v.Type() != stringsType {
+		return types.NewDynamicList(primitiveAdapter{types.DefaultTypeAdapter}, v.Interface()), nil
+	}
+	if v.Kind() == reflect.Map {
+		_, keyOK := mapKeyType(v.Type().Key())
+		if _, ok := primitiveType(v.Type().Elem()); ok && keyOK {
+			return newKeyMap(types.DefaultTypeAdapter, v, primitiveValue), nil
+		}
+		if _, ok := listType(v.Type().Elem()); ok && keyOK {
+			// Lists of values, such as the values of an http.Header, are
+			// adapted when they are accessed.
+			adapter := primitiveAdapter{types.DefaultTypeAdapter}
+			if !isNativeKeyType(v.Type().Key()) {
+				return newKeyMap(adapter, v, reflect.Value.Interface), nil
+			}
+			return types.NewDynamicMap(adapter, v.Interface()), nil
+		}
+	}
+	if k := v.Kind(); k == reflect.String || k == reflect.Bool || k == reflect.Uint8 || isNumericKind(k) {
+		// Named types, such as type Status string, and integers narrower
+		// than 32 bits are only supported by the CEL type adapter as their
+		// underlying or widened type.
+		return primitiveValue(v), nil
+	}
+	return v.Interface(), nil
+}
+
+// isNumericKind reports whether the kind is an integer or floating point
+// kind, other than uint8 (see celTypeForField for []byte) and uintptr.
+func isNumericKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// listType returns the CEL list type for slices and arrays of strings,
+// bools, numbers, and timestamps, and for slices and arrays of them, such
+// as list(list(string)) for a [][]string.
+func listType(t reflect.Type) (*types.Type, bool) {
+	if !isListKind(t) {
+		return nil, false
+	}
+	switch e := t.Elem(); {
+	case isTimeType(e):
+		return types.NewListType(types.TimestampType), true
+	case e.Kind() == reflect.String, e.Kind() == reflect.Bool, isNumericKind(e.Kind()):
+		et, _ := primitiveType(e)
+		return types.NewListType(et), true
+	case isListKind(e):
+		if et, ok := listType(e); ok {
+			return types.NewListType(et), true
+		}
+	}
+	return nil, false
+}
+
+// isListKind reports whether the type is a slice or array type other than
+// a []byte.
+func isListKind(t reflect.Type) bool {
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8
+}
+
+// stringsType is the reflect type of []string, which the CEL type adapter
+// supports without conversion.
+var stringsType = reflect.TypeOf([]string(nil))
+
+// primitiveAdapter widens values of primitive kinds, such as the elements
+// of a []uint16 or a []Severity, to the Go types the adapter supports (see
+// primitiveValue) when they are accessed, converts times to timestamps, and
+// adapts the elements of nested slices the same way.
+type primitiveAdapter struct {
+	types.Adapter
+}
+
+// NativeToValue implements the types.Adapter interface.
+func (a primitiveAdapter) NativeToValue(value any) ref.Val {
+	v := reflect.ValueOf(value)
+	if isListKind(v.Type()) {
+		return types.NewDynamicList(a, value)
+	}
+	if isTimeType(v.Type()) {
+		// Nil elements of a []*time.Time are only an error when they
+		// are accessed, so the rest of the list can still be used.
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return types.NewErr("xcel: nil '%s' list element", v.Type())
+		}
+		ts, _ := convertForCEL(v)
+		return a.Adapter.NativeToValue(ts)
+	}
+	return a.Adapter.NativeToValue(primitiveValue(v))
+}
+
+// dynAdapter adapts the values of dyn collections, such as the values of a
+// map[string]any, converting each value when it is accessed the same way as
+// the value of a field of its dynamic type, before adapting it with the
+// object's adapter, so registered objects are wrapped as objects.
+type dynAdapter struct {
+	types.Adapter
+}
+
+// NativeToValue implements the types.Adapter interface.
+func (a *dynAdapter) NativeToValue(value any) ref.Val {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return types.NullValue
+	}
+	if val, ok := value.(ref.Val); ok {
+		return val
+	}
+	converted, err := convertForCEL(v)
+	if err != nil {
+		return types.WrapErr(err)
+	}
+	return a.Adapter.NativeToValue(converted)
+}
+
+// implementationObjects registers the struct pointer implementations of the
+// interface type declared with WithImplementations as nested objects, so
+// values holding them are wrapped as objects by the object's adapter.
+func (b *fieldsBuilder) implementationObjects(iface reflect.Type) {
+	for _, impl := range b.o.impls {
+		if elem, ok := objectElemType(impl); ok && impl.Implements(iface) {
+			b.nestedObject(elem)
+		}
+	}
+}
+
+// dynCollectionType returns the CEL type and conversion for slices and maps
+// of interface values, such as []K8sEvent or map[string]any, whose elements
+// are dyn. The implementations of the interface declared with
+// WithImplementations are registered as nested objects, so elements holding
+// them are wrapped as objects.
+func (b *fieldsBuilder) dynCollectionType(t reflect.Type) (*types.Type, ConvertFunc, bool) {
+	if !isListKind(t) && t.Kind() != reflect.Map || t.Elem().Kind() != reflect.Interface {
+		return nil, nil, false
+	}
+
+	b.implementationObjects(t.Elem())
+
+	if t.Kind() != reflect.Map {
+		convert := func(v reflect.Value) (any, error) {
+			return types.NewDynamicList(&dynAdapter{Adapter: b.adapter()}, v.Interface()), nil
+		}
+		return types.NewListType(types.DynType), convert, true
+	}
+
+	kt, ok := mapKeyType(t.Key())
+	if !ok {
+		return nil, nil, false
+	}
+
+	convert := func(v reflect.Value) (any, error) {
+		adapter := &dynAdapter{Adapter: b.adapter()}
+		if !isNativeKeyType(t.Key()) {
+			return newKeyMap(adapter, v, reflect.Value.Interface), nil
+		}
+		return types.NewDynamicMap(adapter, v.Interface()), nil
+	}
+
+	return types.NewMapType(kt, types.DynType), convert, true
+}
+
+// mapKeyType returns the CEL type for Go map key types of the kinds CEL
+// supports as map keys: strings, integers, and bools.
+func mapKeyType(t reflect.Type) (*types.Type, bool) {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return primitiveType(t)
+	}
+	return nil, false
+}
+
+// convertMap returns a copy of the map with its keys converted to the Go
+// types the CEL type adapter supports for their CEL type (see
+// primitiveValue), so lookups such as m[1234] find keys of named or
+// narrower types, and its values converted with the given function.
+func convertMap(v reflect.Value, value func(reflect.Value) any) any {
+	kt := reflect.TypeOf(primitiveValue(reflect.Zero(v.Type().Key())))
+	m := reflect.MakeMapWithSize(reflect.MapOf(kt, anyType), v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		m.SetMapIndex(reflect.ValueOf(primitiveValue(iter.Key())), reflect.ValueOf(value(iter.Value())))
+	}
+	return m.Interface()
+}
+
+// keyMap is the CEL map of a Go map whose keys or values are of types the
+// CEL type adapter does not support, such as map[PID]string, converted when
+// they are looked up rather than copying the map on every access.
+// Iterating, comparing, and converting the map use the copy returned by
+// convertMap.
+type keyMap struct {
+	types.Adapter
+
+	v     reflect.Value
+	value func(reflect.Value) any
+}
+
+// newKeyMap returns the CEL map of the Go map, with its values converted
+// with the given function and adapted with the adapter.
+func newKeyMap(adapter types.Adapter, v reflect.Value, value func(reflect.Value) any) traits.Mapper {
+	return &keyMap{Adapter: adapter, v: v, value: value}
+}
+
+// converted returns the CEL map of a copy of the map, see convertMap.
+func (m *keyMap) converted() traits.Mapper {
+	return types.NewDynamicMap(m.Adapter, convertMap(m.v, m.value)).(traits.Mapper)
+}
+
+// ConvertToNative implements the ref.Val interface.
+func (m *keyMap) ConvertToNative(typeDesc reflect.Type) (any, error) {
+	return m.converted().ConvertToNative(typeDesc)
+}
+
+// ConvertToType implements the ref.Val interface.
+func (m *keyMap) ConvertToType(typeValue ref.Type) ref.Val {
+	if typeValue == types.MapType {
+		return m
+	}
+	return m.converted().ConvertToType(typeValue)
+}
+
+// Equal implements the ref.Val interface.
+func (m *keyMap) Equal(other ref.Val) ref.Val {
+	return m.converted().Equal(other)
+}
+
+// Type implements the ref.Val interface.
+func (m *keyMap) Type() ref.Type {
+	return types.MapType
+}
+
+// Value implements the ref.Val interface.
+func (m *keyMap) Value() any {
+	return m.converted().Value()
+}
+
+// Contains implements the traits.Container interface.
+func (m *keyMap) Contains(key ref.Val) ref.Val {
+	_, found := m.Find(key)
+	return types.Bool(found)
+}
+
+// Get implements the traits.Indexer interface.
+func (m *keyMap) Get(key ref.Val) ref.Val {
+	v, found := m.Find(key)
+	if !found {
+		return types.ValOrErr(v, "no such key: %v", key)
+	}
+	return v
+}
+
+// Iterator implements the traits.Iterable interface.
+func (m *keyMap) Iterator() traits.Iterator {
+	return m.converted().Iterator()
+}
+
+// Size implements the traits.Sizer interface.
+func (m *keyMap) Size() ref.Val {
+	return types.Int(m.v.Len())
+}
+
+// Find implements the traits.Mapper interface.
+func (m *keyMap) Find(key ref.Val) (ref.Val, bool) {
+	k, ok := mapKey(key, m.v.Type().Key())
+	if !ok {
+		return nil, false
+	}
+	v := m.v.MapIndex(k)
+	if !v.IsValid() {
+		return nil, false
+	}
+	return m.NativeToValue(m.value(v)), true
+}
+
+// mapKey returns the Go map key of the given type for a CEL map key, if
+// there is one: ints, uints, and doubles which are whole numbers find the
+// integer keys they equal, like the keys of CEL maps.
+func mapKey(key ref.Val, t reflect.Type) (reflect.Value, bool) {
+	var k reflect.Value
+	switch t.Kind() {
+	case reflect.String:
+		s, ok := key.(types.String)
+		if !ok {
+			return k, false
+		}
+		k = reflect.ValueOf(string(s))
+	case reflect.Bool:
+		b, ok := key.(types.Bool)
+		if !ok {
+			return k, false
+		}
+		k = reflect.ValueOf(bool(b))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch key := key.(type) {
+		case types.Int:
+			n = int64(key)
+		case types.Uint:
+			if key > math.MaxInt64 {
+				return k, false
+			}
+			n = int64(key)
+		case types.Double:
+			if key != types.Double(math.Trunc(float64(key))) || key < math.MinInt64 || key >= math.MaxInt64 {
+				return k, false
+			}
+			n = int64(key)
+		default:
+			return k, false
+		}
+		if reflect.Zero(t).OverflowInt(n) {
+			return k, false
+		}
+		k = reflect.ValueOf(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		switch key := key.(type) {
+		case types.Uint:
+			n = uint64(key)
+		case types.Int:
+			if key < 0 {
+				return k, false
+			}
+			n = uint64(key)
+		case types.Double:
+			if key != types.Double(math.Trunc(float64(key))) || key < 0 || key >= math.MaxUint64 {
+				return k, false
+			}
+			n = uint64(key)
+		default:
+			return k, false
+		}
+		if reflect.Zero(t).OverflowUint(n) {
+			return k, false
+		}
+		k = reflect.ValueOf(n)
+	default:
+		return k, false
+	}
+	return k.Convert(t), true
+}
+
+// anyType is the reflect type of the empty interface.
+var anyType = reflect.TypeOf((*any)(nil)).Elem()
+
+// presenceIsSet reports whether a field value is set: nilable values are
+// set when they are not nil, zero netip.Addr and netip.Prefix values are
+// unset, and all other values are always set.
+func presenceIsSet(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func, reflect.Chan:
+		return !v.IsNil()
+	}
+	switch v.Type() {
+	case addrType:
+		return v.Interface().(netip.Addr).IsValid()
+	case prefixType:
+		return v.Interface().(netip.Prefix).IsValid()
+	}
+	return true
+}
+
+// isEmptyValue reports whether the value is empty in the sense of the
+// encoding/json omitempty option.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// isExcludedField reports whether the struct field is excluded from the
+// fields of its object with `cel:"-"`, like encoding/json's `json:"-"`.
+func isExcludedField(sf reflect.StructField) bool {
+	return sf.Tag.Get("cel") == "-"
+}
+
+// tagHasOption reports whether the comma separated options of a struct tag
+// value, after its name, include the given option.
+func tagHasOption(tag, option string) bool {
+	_, opts, _ := strings.Cut(tag, ",")
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+// setIfPredicates are the predicates of the setif option of the cel tag
+// for numeric fields, by name.
+var setIfPredicates = map[string]func(sign int) bool{
+	"gt0":     func(sign int) bool { return sign > 0 },
+	"gte0":    func(sign int) bool { return sign >= 0 },
+	"nonzero": func(sign int) bool { return sign != 0 },
+}
+
+// setIfPredicate returns the presence predicate for the setif option of
+// the field's cel tag, such as `cel:",setif=gt0"`, or nil if it has none.
+// It returns an error for unknown predicates and fields which are not
+// numeric.
+func setIfPredicate(sf reflect.StructField) (func(reflect.Value) bool, error) {
+	name, ok := tagOptionValue(sf.Tag.Get("cel"), "setif")
+	if !ok {
+		return nil, nil
+	}
+
+	pred, ok := setIfPredicates[name]
+	if !ok {
+		return nil, fmt.Errorf("xcel: unknown setif predicate '%s' of field '%s', expected gt0, gte0, or nonzero", name, sf.Name)
+	}
+
+	switch sf.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+	default:
+		return nil, fmt.Errorf("xcel: setif predicate '%s' of field '%s' requires a numeric type, not '%s'", name, sf.Name, sf.Type)
+	}
+
+	return func(v reflect.Value) bool {
+		return pred(numericSign(v))
+	}, nil
+}
+
+// unsetIfPredicate returns the presence predicate for the unsetif and
+// nonzero options of the field's cel tag, or nil if it has neither. With
+// `cel:",unsetif=-1"`, the field is unset when it equals the sentinel,
+// which is parsed once for the field's int, uint, float, bool, or string
+// type, and with `cel:",nonzero"`, it is unset when it is the zero value of
+// its type. Pointers are compared by the value they point to. It returns an
+// error for sentinels which are missing or do not parse.
+func unsetIfPredicate(sf reflect.StructField) (func(reflect.Value) bool, error) {
+	tag := sf.Tag.Get("cel")
+	t := sf.Type
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var unset func(reflect.Value) bool
+
+	if sentinel, ok := tagOptionValue(tag, "unsetif"); ok {
+		want := reflect.New(t).Elem()
+
+		var err error
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			var n int64
+			if n, err = strconv.ParseInt(sentinel, 0, t.Bits()); err == nil {
+				want.SetInt(n)
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			var n uint64
+			if n, err = strconv.ParseUint(sentinel, 0, t.Bits()); err == nil {
+				want.SetUint(n)
+			}
+		case reflect.Float32, reflect.Float64:
+			var f float64
+			if f, err = strconv.ParseFloat(sentinel, t.Bits()); err == nil {
+				want.SetFloat(f)
+			}
+		case reflect.Bool:
+			var b bool
+			if b, err = strconv.ParseBool(sentinel); err == nil {
+				want.SetBool(b)
+			}
+		case reflect.String:
+			want.SetString(sentinel)
+		default:
+			return nil, fmt.Errorf("xcel: unsetif sentinel of field '%s' requires an int, uint, float, bool, or string type, not '%s'", sf.Name, sf.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("xcel: invalid unsetif sentinel '%s' of field '%s' of type '%s'", sentinel, sf.Name, sf.Type)
+		}
+
+		unset = func(v reflect.Value) bool {
+			return v.Equal(want)
+		}
+	} else if tagHasOption(tag, "unsetif") {
+		return nil, fmt.Errorf("xcel: unsetif option of field '%s' requires a sentinel, such as unsetif=-1", sf.Name)
+	}
+
+	if tagHasOption(tag, "nonzero") {
+		if unset != nil {
+			return nil, fmt.Errorf("xcel: field '%s' has both the unsetif and nonzero options", sf.Name)
+		}
+		unset = reflect.Value.IsZero
+	}
+
+	if unset == nil {
+		return nil, nil
+	}
+
+	return func(v reflect.Value) bool {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return false
+			}
+			v = v.Elem()
+		}
+		return !unset(v)
+	}, nil
+}
+
+// fieldDefault returns the value of the default option of the field's cel
+// tag, such as `cel:",default=30s"`, parsed for the field's CEL type, or nil
+// if it has none. Timestamps are parsed as RFC 3339, and durations like
+// time.ParseDuration. It returns an error for values which do not parse,
+// and for fields of other types.
+func fieldDefault(sf reflect.StructField, typ *types.Type) (ref.Val, error) {
+	value, ok := tagOptionValue(sf.Tag.Get("cel"), "default")
+	if !ok {
+		return nil, nil
+	}
+
+	var (
+		def ref.Val
+		err error
+	)
+	switch typ.Kind() {
+	case types.IntKind:
+		var n int64
+		n, err = strconv.ParseInt(value, 0, 64)
+		def = types.Int(n)
+	case types.UintKind:
+		var n uint64
+		n, err = strconv.ParseUint(value, 0, 64)
+		def = types.Uint(n)
+	case types.DoubleKind:
+		var f float64
+		f, err = strconv.ParseFloat(value, 64)
+		def = types.Double(f)
+	case types.BoolKind:
+		var b bool
+		b, err = strconv.ParseBool(value)
+		def = types.Bool(b)
+	case types.StringKind:
+		def = types.String(value)
+	case types.DurationKind:
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		def = types.Duration{Duration: d}
+	case types.TimestampKind:
+		var t time.Time
+		t, err = time.Parse(time.RFC3339, value)
+		def = types.Timestamp{Time: t}
+	default:
+		return nil, fmt.Errorf("xcel: default of field '%s' is not supported for type '%s'", sf.Name, typ)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("xcel: invalid default '%s' of field '%s' of type '%s': %v", value, sf.Name, typ, err)
+	}
+	return def, nil
+}
+
+// numericSign returns -1, 0, or 1 for negative, zero, and positive values
+// of numeric kinds. NaN is neither, and is reported as 1 so it is nonzero.
+func numericSign(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch n := v.Int(); {
+		case n < 0:
+			return -1
+		case n == 0:
+			return 0
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() == 0 {
+			return 0
+		}
+	case reflect.Float32, reflect.Float64:
+		switch f := v.Float(); {
+		case f < 0:
+			return -1
+		case f == 0:
+			return 0
+		}
+	}
+	return 1
+}
+
+// tagOptionValue returns the value of a key=value option of a struct tag,
+// such as gt0 for the setif option of `cel:",setif=gt0"`.
+func tagOptionValue(tag, key string) (string, bool) {
+	_, opts, _ := strings.Cut(tag, ",")
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if k, v, ok := strings.Cut(opt, "="); ok && k == key {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// rawValuer is implemented by objects to expose their wrapped Go value
+// without knowing its type parameter.
+type rawValuer interface {
+	rawValue() any
+}
+
+// rawValue implements the rawValuer interface.
+func (o *Object[T]) rawValue() any {
+	return o.Raw
+}
+
+// errNilObject is returned by structValue for nil objects.
+var errNilObject = errors.New("xcel: object is nil")
+
+// structValue returns the struct value for a field getter or tester
+// target, which is either an object or the Go value it wraps.
+func structValue(target any) (reflect.Value, error) {
+	if obj, ok := target.(rawValuer); ok {
+		target = obj.rawValue()
+	}
+
+	v := reflect.ValueOf(target)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}, errNilObject
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("xcel: unsupported object type '%T'", target)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,3606 @@
+package xcel_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/picatz/xcel"
+)
+
+type EventTime time.Time
+
+type EventBase struct {
+	CreatedAt EventTime
+	UpdatedAt *time.Time
+}
+
+type TimedEvent struct {
+	EventBase
+	Name string
+}
+
+func TestNewFieldsPromotedTime(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	created := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	obj, typ := xcel.NewObject(&TimedEvent{
+		EventBase: EventBase{CreatedAt: EventTime(created)},
+		Name:      "test",
+	})
+
+	xcel.RegisterObject(ta, tp, obj, typ, xcel.NewFields(obj))
+
+	env, err := cel.NewEnv(
+		cel.Types(typ),
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"obj.created_at.getFullYear() == 2024", true},
+		{"obj.created_at.getMonth() == 2 && obj.created_at.getDayOfMonth() == 0", true},
+		{"obj.created_at < timestamp('2025-01-01T00:00:00Z')", true},
+		{"obj.created_at == timestamp('2024-03-01T12:00:00Z')", true},
+		{"has(obj.created_at) && !has(obj.updated_at)", true},
+		{"obj.name == 'test'", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			ast, iss := env.Compile(test.expr)
+			if iss.Err() != nil {
+				t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			out, _, err := prg.Eval(map[string]any{"obj": obj})
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out.Value() != test.want {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out.Value())
+			}
+		})
+	}
+}
+
+func TestNewFieldsDeterministicSchema(t *testing.T) {
+	register := func() string {
+		reg := xcel.NewRegistry()
+
+		err := xcel.RegisterAll(reg, []any{&TimedEvent{}, &ExecEvent{}, &DNSEvent{}, &FileEvent{}})
+		if err != nil {
+			t.Fatalf("failed to register types: %v", err)
+		}
+
+		return reg.Provider.Schema()
+	}
+
+	want := register()
+	for i := 0; i < 10; i++ {
+		if got := register(); got != want {
+			t.Fatalf("expected identical schemas:\n%s\n!=\n%s", got, want)
+		}
+	}
+
+	if !strings.Contains(want, "type *xcel_test.TimedEvent\n\tfield created_at google.protobuf.Timestamp\n\tfield name string\n\tfield updated_at google.protobuf.Timestamp\n") {
+		t.Fatalf("unexpected schema:\n%s", want)
+	}
+}
+
+type Profile struct {
+	Name     string            `json:"name,omitempty"`
+	Age      int               `json:"age,omitempty"`
+	Admin    bool              `json:"admin,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Nickname *string           `json:"nickname,omitempty"`
+	Score    float64           `json:"score"`
+	Team     string            `cel:",omitempty"`
+}
+
+func TestNewFieldsPresenceFromJSONTags(t *testing.T) {
+	empty := ""
+
+	tests := []struct {
+		name    string
+		profile *Profile
+		opts    []xcel.Option
+		want    map[string]bool
+	}{
+		{
+			name:    "zero without json presence",
+			profile: &Profile{},
+			want: map[string]bool{
+				"name": true, "age": true, "admin": true, "tags": false, "labels": false,
+				"nickname": false, "score": true, "team": false,
+			},
+		},
+		{
+			name:    "zero with json presence",
+			profile: &Profile{},
+			opts:    []xcel.Option{xcel.PresenceFromJSONTags(true)},
+			want: map[string]bool{
+				"name": false, "age": false, "admin": false, "tags": false, "labels": false,
+				"nickname": false, "score": true, "team": false,
+			},
+		},
+		{
+			name:    "disabled json presence",
+			profile: &Profile{},
+			opts:    []xcel.Option{xcel.PresenceFromJSONTags(false)},
+			want: map[string]bool{
+				"name": true, "age": true, "admin": true, "score": true, "team": false,
+			},
+		},
+		{
+			name: "set with json presence",
+			profile: &Profile{
+				Name: "test", Age: 1, Admin: true, Tags: []string{}, Labels: map[string]string{"a": "b"},
+				Nickname: &empty, Team: "red",
+			},
+			opts: []xcel.Option{xcel.PresenceFromJSONTags(true)},
+			want: map[string]bool{
+				"name": true, "age": true, "admin": true, "tags": false, "labels": true,
+				"nickname": true, "score": true, "team": true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			obj, _ := xcel.NewObject(test.profile)
+
+			fields := xcel.NewFields(obj, test.opts...)
+
+			for name, want := range test.want {
+				if got := fields[name].IsSet(obj); got != want {
+					t.Fatalf("expected has(%s) to be '%v' but got '%v'", name, want, got)
+				}
+			}
+		})
+	}
+}
+
+type Source interface {
+	Kind() string
+}
+
+type Meta struct {
+	Region string
+}
+
+type Host struct {
+	Meta
+	Hostname string
+}
+
+type Process struct {
+	Host
+	PID int
+}
+
+func (*Process) Kind() string { return "process" }
+
+type Pod struct {
+	Namespace string
+	*Host
+}
+
+func (*Pod) Kind() string { return "pod" }
+
+type Job struct {
+	Name string
+}
+
+func (*Job) Kind() string { return "job" }
+
+type Envelope struct {
+	Source
+	ID string
+}
+
+func TestNewFieldsInterfacePromotion(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	obj, typ := xcel.NewObject(&Envelope{
+		Source: &Process{Host: Host{Meta: Meta{Region: "us-east-1"}, Hostname: "web-1"}, PID: 1},
+		ID:     "a",
+	})
+
+	fields := xcel.NewFields(obj)
+
+	for _, name := range []string{"id", "pid", "hostname", "region"} {
+		if _, ok := fields[name]; !ok {
+			t.Fatalf("expected field %q to be promoted, got %v", name, fields)
+		}
+	}
+
+	xcel.RegisterObject(ta, tp, obj, typ, fields)
+
+	env, err := cel.NewEnv(
+		cel.Types(typ),
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("has(obj.region) ? obj.region + '/' + obj.hostname : 'none'")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	tests := []struct {
+		event *Envelope
+		want  string
+	}{
+		{obj.Raw, "us-east-1/web-1"},
+		// The dynamic type may differ between events, with the embedded
+		// structs at different indexes.
+		{&Envelope{Source: &Pod{Namespace: "default", Host: &Host{Meta: Meta{Region: "eu-west-1"}, Hostname: "node-1"}}}, "eu-west-1/node-1"},
+		{&Envelope{Source: &Pod{Namespace: "default"}}, "none"},
+		{&Envelope{Source: &Job{Name: "backup"}}, "none"},
+		{&Envelope{}, "none"},
+	}
+
+	for _, test := range tests {
+		out, _, err := prg.Eval(map[string]any{"obj": test.event})
+		if err != nil {
+			t.Fatalf("failed to evaluate program for %+v: %v", test.event, err)
+		}
+
+		if out.Value() != test.want {
+			t.Fatalf("expected %q but got '%v' for %+v", test.want, out.Value(), test.event)
+		}
+	}
+}
+
+type Task struct {
+	Region string
+	Name   string
+}
+
+func (*Task) Kind() string { return "task" }
+
+func TestNewFieldsDynamicTypeMode(t *testing.T) {
+	const expr = "has(obj.region) ? obj.region : 'none'"
+
+	sample := &Envelope{Source: &Process{Host: Host{Meta: Meta{Region: "us-east-1"}}}}
+
+	tests := []struct {
+		name  string
+		mode  xcel.DynamicTypeMode
+		event *Envelope
+		want  string
+		err   string
+	}{
+		{name: "lenient sample type", mode: xcel.DynamicTypeLenient, event: sample, want: "us-east-1"},
+		{name: "lenient other type", mode: xcel.DynamicTypeLenient, event: &Envelope{Source: &Job{}}, want: "none"},
+		{name: "strict sample type", mode: xcel.DynamicTypeStrict, event: sample, want: "us-east-1"},
+		{
+			name:  "strict other type",
+			mode:  xcel.DynamicTypeStrict,
+			event: &Envelope{Source: &Job{}},
+			err:   "xcel: field 'region' not present on runtime type '*xcel_test.Job'",
+		},
+		{name: "dispatch sample type", mode: xcel.DynamicTypeDispatch, event: sample, want: "us-east-1"},
+		{name: "dispatch registered type", mode: xcel.DynamicTypeDispatch, event: &Envelope{Source: &Task{Region: "ap-south-1"}}, want: "ap-south-1"},
+		{name: "dispatch unregistered type", mode: xcel.DynamicTypeDispatch, event: &Envelope{Source: &Job{}}, want: "none"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+			task, taskType := xcel.NewObject(&Task{})
+			xcel.RegisterObject(ta, tp, task, taskType, xcel.NewFields(task))
+
+			obj, typ := xcel.NewObject(sample)
+			xcel.RegisterObject(ta, tp, obj, typ, xcel.NewFields(obj, xcel.WithDynamicTypeMode(test.mode)))
+
+			env, err := cel.NewEnv(
+				cel.Variable("obj", typ),
+				cel.CustomTypeAdapter(ta),
+				cel.CustomTypeProvider(tp),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, iss := env.Compile(expr)
+			if iss.Err() != nil {
+				t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			out, _, err := prg.Eval(map[string]any{"obj": test.event})
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q but got '%v' (%v)", test.err, err, out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out.Value() != test.want {
+				t.Fatalf("expected %q but got '%v'", test.want, out.Value())
+			}
+		})
+	}
+}
+
+type Deployment struct {
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+func TestNewFieldsStringMaps(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	obj, typ := xcel.NewObject(&Deployment{})
+
+	xcel.RegisterObject(ta, tp, obj, typ, xcel.NewFields(obj))
+
+	env, err := cel.NewEnv(
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	tests := []struct {
+		expr  string
+		event *Deployment
+		want  bool
+	}{
+		{"'app' in obj.labels && obj.labels['app'] == 'nginx'", &Deployment{Labels: map[string]string{"app": "nginx"}}, true},
+		{"'app' in obj.labels", &Deployment{Labels: map[string]string{"tier": "web"}}, false},
+		{"obj.labels.app == 'nginx' && obj.labels.exists(k, k == 'app')", &Deployment{Labels: map[string]string{"app": "nginx"}}, true},
+		{"has(obj.labels) && !has(obj.annotations)", &Deployment{Labels: map[string]string{}}, true},
+		{"has(obj.labels)", &Deployment{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			ast, iss := env.Compile(test.expr)
+			if iss.Err() != nil {
+				t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			out, _, err := prg.Eval(map[string]any{"obj": test.event})
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out.Value() != test.want {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out.Value())
+			}
+		})
+	}
+}
+
+// evalFields evaluates the expression with obj bound to the value, using
+// fields derived from the value with NewFields.
+func evalFields[T any](t *testing.T, value T, expr string, opts ...xcel.Option) (ref.Val, error) {
+	t.Helper()
+
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	obj, typ := xcel.NewObject(value)
+
+	xcel.RegisterObject(ta, tp, obj, typ, xcel.NewFields(obj, opts...))
+
+	env, err := cel.NewEnv(
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression %q: %v", expr, iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	out, _, err := prg.Eval(map[string]any{"obj": obj})
+	return out, err
+}
+
+type ResourceUsage struct {
+	Counters map[string]int64
+	Limits   map[string]uint32
+	Ratios   map[string]float64
+	Small    map[string]int8
+	Flags    map[string]bool
+}
+
+func TestNewFieldsNumericMaps(t *testing.T) {
+	usage := &ResourceUsage{
+		Counters: map[string]int64{"open_fds": 128},
+		Limits:   map[string]uint32{"open_fds": 1024},
+		Ratios:   map[string]float64{"cpu": 0.75},
+		Small:    map[string]int8{"nice": -5},
+		Flags:    map[string]bool{},
+	}
+
+	for _, expr := range []string{
+		"obj.counters['open_fds'] > 100",
+		"obj.limits['open_fds'] == 1024u && uint(obj.counters.open_fds) < obj.limits.open_fds",
+		"obj.ratios.cpu > 0.5",
+		"obj.small.nice == -5",
+		"has(obj.flags) && size(obj.flags) == 0",
+		"!('missing' in obj.counters)",
+	} {
+		out, err := evalFields(t, usage, expr)
+		if err != nil {
+			t.Fatalf("failed to evaluate %q: %v", expr, err)
+		}
+		if out != types.True {
+			t.Fatalf("expected %q to be 'true' but got '%v'", expr, out)
+		}
+	}
+}
+
+type UserID [4]byte
+
+func (id UserID) String() string {
+	return fmt.Sprintf("u-%x", id[:])
+}
+
+type Session struct {
+	Host
+	UserID  UserID
+	ExePath string
+}
+
+func TestNewFieldsMappers(t *testing.T) {
+	idMapper := func(sf reflect.StructField) (*types.Type, xcel.ConvertFunc, bool) {
+		if sf.Type != reflect.TypeOf(UserID{}) {
+			return nil, nil, false
+		}
+		return types.StringType, func(v reflect.Value) (any, error) {
+			return v.Interface().(UserID).String(), nil
+		}, true
+	}
+
+	paths := map[string][]string{}
+
+	kebab := func(goPath []string, sf reflect.StructField) string {
+		paths[sf.Name] = goPath
+		if sf.Name == "Hostname" {
+			// Defer to the default name mapper.
+			return ""
+		}
+		return strings.ReplaceAll(xcel.ToSnakeCase(sf.Name), "_", "-")
+	}
+
+	reg := xcel.NewRegistry(xcel.WithTypeMapper(idMapper), xcel.WithNameMapper(kebab))
+
+	if err := xcel.RegisterAll(reg, []any{&Session{}}); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	names, _ := reg.Provider.FindStructFieldNames("*xcel_test.Session")
+
+	want := []string{"exe-path", "hostname", "region", "user-id"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected field names %v but got %v", want, names)
+	}
+
+	if want := []string{"Host", "Meta", "Region"}; !reflect.DeepEqual(paths["Region"], want) {
+		t.Fatalf("expected Go path %v but got %v", want, paths["Region"])
+	}
+
+	out, err := evalFields(t, &Session{UserID: UserID{0xde, 0xad, 0xbe, 0xef}, ExePath: "/bin/sh"},
+		"obj.user_id == 'u-deadbeef' && obj.user_id.startsWith('u-') && obj.exe_path == '/bin/sh'",
+		xcel.WithTypeMapper(idMapper))
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+}
+
+type Alert struct {
+	Name   string
+	Parent *Alert
+	Event  Source
+}
+
+func TestNewFieldsAbsentNestedObjects(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	proc, procType := xcel.NewObject(&Process{})
+	xcel.RegisterObject(ta, tp, proc, procType, xcel.NewFields(proc))
+
+	obj, typ := xcel.NewObject(&Alert{})
+	xcel.RegisterObject(ta, tp, obj, typ, xcel.NewFields(obj))
+
+	env, err := cel.NewEnv(
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	orphan := &Alert{Name: "orphan"}
+	child := &Alert{Name: "child", Parent: &Alert{Name: "parent"}, Event: &Process{PID: 42}}
+
+	tests := []struct {
+		expr  string
+		alert *Alert
+		want  any
+		err   string
+	}{
+		{expr: "has(obj.parent)", alert: orphan, want: false},
+		{expr: "has(obj.parent.name)", alert: orphan, want: false},
+		{expr: "has(obj.parent.parent.name)", alert: orphan, want: false},
+		{expr: "has(obj.parent.parent.parent)", alert: orphan, want: false},
+		{expr: "obj.parent.name", alert: orphan, err: "xcel: field 'name' is not set"},
+		{expr: "obj.parent.parent.name", alert: orphan, err: "xcel: field 'name' is not set"},
+		{expr: "has(obj.parent.name) && obj.parent.name == 'parent'", alert: child, want: true},
+		{expr: "has(obj.parent.parent.name)", alert: child, want: false},
+		{expr: "has(obj.event)", alert: orphan, want: false},
+		{expr: "has(obj.event.pid)", alert: orphan, want: false},
+		{expr: "obj.event.pid", alert: orphan, err: "xcel: field 'event' is not set"},
+		{expr: "has(obj.event.pid) && obj.event.pid == 42", alert: child, want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			ast, iss := env.Compile(test.expr)
+			if iss.Err() != nil {
+				t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			out, _, err := prg.Eval(map[string]any{"obj": test.alert})
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q but got '%v' (%v)", test.err, err, out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out.Value() != test.want {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out.Value())
+			}
+		})
+	}
+}
+
+type ContainerInfo struct {
+	Image string
+	Ports []string
+}
+
+type PodSpec struct {
+	Containers map[string]ContainerInfo
+	Sidecars   map[string]*ContainerInfo
+}
+
+func TestFieldsMapOfStructs(t *testing.T) {
+	pod := &PodSpec{
+		Containers: map[string]ContainerInfo{"nginx": {Image: "nginx:1.25", Ports: []string{"80"}}},
+		Sidecars:   map[string]*ContainerInfo{"envoy": {Image: "envoy:1.29"}, "empty": nil},
+	}
+
+	tests := []struct {
+		expr string
+		pod  *PodSpec
+		want any
+	}{
+		{"obj.containers['nginx'].image == 'nginx:1.25'", pod, true},
+		{"obj.containers['nginx'].ports[0] == '80'", pod, true},
+		{"obj.sidecars['envoy'].image == 'envoy:1.29'", pod, true},
+		{"has(obj.sidecars['empty'].image)", pod, false},
+		{"obj.containers.all(k, obj.containers[k].image.startsWith(k))", pod, true},
+		{"'redis' in obj.containers", pod, false},
+		{"has(obj.containers)", &PodSpec{}, false},
+		{"size(obj.containers) == 0", &PodSpec{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.pod, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out.Value() != test.want {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out.Value())
+			}
+		})
+	}
+}
+
+type PID uint32
+
+type NodeAgent struct {
+	Exits     map[int32]string
+	Processes map[PID]*ExecEvent
+	Ready     map[bool]int
+}
+
+func TestFieldsMapKeys(t *testing.T) {
+	agent := &NodeAgent{
+		Exits:     map[int32]string{-1: "killed", 0: "ok"},
+		Processes: map[PID]*ExecEvent{1234: {ExePath: "/usr/bin/curl"}},
+		Ready:     map[bool]int{true: 3, false: 1},
+	}
+
+	for _, expr := range []string{
+		"obj.exits[-1] == 'killed' && obj.exits[0] == 'ok'",
+		"obj.processes[1234u].exe_path == '/usr/bin/curl'",
+		"!(4321u in obj.processes)",
+		"obj.ready[true] == 3 && obj.ready[false] == 1",
+		"obj.exits.exists(k, k < 0)",
+		"obj.exits[dyn(0u)] == 'ok' && obj.processes[dyn(1234)] == obj.processes[dyn(1234.0)]",
+		"!(1099511627776 in obj.exits) && !(dyn(-1) in obj.processes) && !(dyn(1234.5) in obj.processes)",
+		"size(obj.exits) == 2 && obj.exits == {-1: 'killed', 0: 'ok'}",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			out, err := evalFields(t, agent, expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.True {
+				t.Fatalf("expected 'true' but got '%v'", out)
+			}
+		})
+	}
+}
+
+type Histogram struct {
+	Buckets map[float64]int
+}
+
+func TestFieldsMapKeysUnsupported(t *testing.T) {
+	err := xcel.RegisterAll(xcel.NewRegistry(), []any{&Histogram{}})
+	if err == nil || !strings.Contains(err.Error(), "unsupported key type 'float64' of map field 'Buckets'") {
+		t.Fatalf("expected an unsupported key type error but got '%v'", err)
+	}
+
+	var skipped []xcel.SkippedField
+	obj, _ := xcel.NewObject(&Histogram{})
+	_, err = xcel.NewFieldsE(obj, xcel.WithSkippedFields(func(f xcel.SkippedField) {
+		skipped = append(skipped, f)
+	}))
+	if err == nil || !strings.Contains(err.Error(), "unsupported key type 'float64' of map field 'Buckets'") {
+		t.Fatalf("expected an unsupported key type error but got '%v'", err)
+	}
+	if len(skipped) != 0 {
+		t.Fatalf("expected no skipped fields but got %v", skipped)
+	}
+}
+
+type Child struct {
+	Name string
+	Age  int
+}
+
+type Family struct {
+	Children []Child
+	Parents  []*Child
+}
+
+func TestFieldsSliceOfStructs(t *testing.T) {
+	family := &Family{
+		Children: []Child{{Name: "ada", Age: 7}, {Name: "bob", Age: 4}},
+		Parents:  []*Child{{Name: "eve", Age: 40}},
+	}
+
+	for _, expr := range []string{
+		"obj.children[0].name == 'ada'",
+		"size(obj.children) == 2",
+		"obj.children.exists(c, c.name == 'bob')",
+		"obj.children.all(c, c.age < 18)",
+		"obj.children.filter(c, c.age > 5).map(c, c.name) == ['ada']",
+		"obj.children.exists_one(c, c.age == 4)",
+		"obj.parents[0].name == 'eve'",
+		"obj.parents.map(p, p.age) == [40]",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			out, err := evalFields(t, family, expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.True {
+				t.Fatalf("expected 'true' but got '%v'", out)
+			}
+		})
+	}
+}
+
+func TestFieldsSliceOfStructsLazy(t *testing.T) {
+	family := &Family{Children: make([]Child, 100000)}
+	family.Children[len(family.Children)-1].Name = "last"
+
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	obj, typ := xcel.NewObject(family)
+
+	xcel.RegisterObject(ta, tp, obj, typ, xcel.NewFields(obj))
+
+	env, err := cel.NewEnv(
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("obj.children[99999].name == 'last' && size(obj.children) == 100000")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	vars := map[string]any{"obj": obj}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		out, _, err := prg.Eval(vars)
+		if err != nil || out != types.True {
+			t.Fatalf("expected 'true' but got '%v' (%v)", out, err)
+		}
+	})
+
+	// Only the accessed element is wrapped, so the allocations do not
+	// depend on the length of the slice.
+	if allocs > 100 {
+		t.Fatalf("expected the slice not to be copied but got %v allocations", allocs)
+	}
+}
+
+type MountInfo struct {
+	Path     string
+	ReadOnly bool
+}
+
+type Mounted struct {
+	Mounts []*MountInfo
+}
+
+func TestFieldsSliceOfStructPointers(t *testing.T) {
+	tests := []struct {
+		expr    string
+		mounted *Mounted
+		want    bool
+		err     string
+	}{
+		{expr: "size(obj.mounts) == 0", mounted: &Mounted{}, want: true},
+		{expr: "obj.mounts.all(m, m.read_only)", mounted: &Mounted{}, want: true},
+		{expr: "obj.mounts.all(m, m.read_only)", mounted: &Mounted{Mounts: []*MountInfo{{Path: "/etc", ReadOnly: true}, {Path: "/tmp"}}}, want: false},
+		{expr: "obj.mounts.exists(m, m.path == '/etc')", mounted: &Mounted{Mounts: []*MountInfo{{Path: "/etc"}}}, want: true},
+		{expr: "size(obj.mounts) == 2", mounted: &Mounted{Mounts: []*MountInfo{nil, {Path: "/etc"}}}, want: true},
+		{expr: "obj.mounts.exists(m, has(m.path) && m.path == '/etc')", mounted: &Mounted{Mounts: []*MountInfo{nil, {Path: "/etc"}}}, want: true},
+		{expr: "has(obj.mounts[0].path)", mounted: &Mounted{Mounts: []*MountInfo{nil}}, want: false},
+		{expr: "obj.mounts[0].path == '/etc'", mounted: &Mounted{Mounts: []*MountInfo{nil}}, err: "xcel: field 'path' is not set"},
+		{expr: "obj.mounts.all(m, m.read_only)", mounted: &Mounted{Mounts: []*MountInfo{nil}}, err: "xcel: field 'read_only' is not set"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.mounted, test.expr)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q but got '%v' (%v)", test.err, err, out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
+
+type TaggedExample struct {
+	Name     string   `cel:",omitempty"`
+	Age      int      `cel:",setif=gte0"`
+	Tags     []string `cel:",omitempty"`
+	Parent   *TaggedExample
+	Pressure float64 `cel:",setif=gt0"`
+	Retries  uint8   `cel:",setif=nonzero"`
+}
+
+func TestFieldsSetIf(t *testing.T) {
+	tests := []struct {
+		expr  string
+		value *TaggedExample
+		want  bool
+	}{
+		{"has(obj.age)", &TaggedExample{Age: 0}, true},
+		{"has(obj.age)", &TaggedExample{Age: -1}, false},
+		{"has(obj.pressure)", &TaggedExample{Pressure: 0.1}, true},
+		{"has(obj.pressure)", &TaggedExample{Pressure: 0}, false},
+		{"has(obj.pressure)", &TaggedExample{Pressure: -1}, false},
+		{"has(obj.retries)", &TaggedExample{Retries: 1}, true},
+		{"has(obj.retries)", &TaggedExample{}, false},
+		{"has(obj.name) || has(obj.tags) || has(obj.parent)", &TaggedExample{Tags: []string{}}, false},
+		{"has(obj.parent.age) && obj.parent.age == 3", &TaggedExample{Parent: &TaggedExample{Age: 3}}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.value, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v' for %+v", test.want, out, test.value)
+			}
+		})
+	}
+}
+
+type BadPredicate struct {
+	Age int `cel:",setif=positive"`
+}
+
+type BadPredicateKind struct {
+	Name string `cel:",setif=nonzero"`
+}
+
+func TestFieldsSetIfErrors(t *testing.T) {
+	for _, test := range []struct {
+		value any
+		err   string
+	}{
+		{&BadPredicate{}, "unknown setif predicate 'positive' of field 'Age'"},
+		{&BadPredicateKind{}, "setif predicate 'nonzero' of field 'Name' requires a numeric type"},
+	} {
+		err := xcel.RegisterAll(xcel.NewRegistry(), []any{test.value})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("expected error %q but got '%v'", test.err, err)
+		}
+	}
+}
+
+type Listener struct {
+	Ports   []uint16
+	Offsets []int64
+	Counts  []int
+	Sizes   []uint64
+	Weights []float64
+	Levels  []int8
+}
+
+func TestFieldsNumericSlices(t *testing.T) {
+	l := &Listener{
+		Ports:   []uint16{80, 443},
+		Offsets: []int64{-1, 1 << 40},
+		Counts:  []int{1, 2, 3},
+		Sizes:   []uint64{1 << 63},
+		Weights: []float64{0.5, 1.5},
+		Levels:  []int8{-128, 127},
+	}
+
+	tests := []struct {
+		expr string
+		l    *Listener
+		want bool
+	}{
+		{"443u in obj.ports", l, true},
+		{"22u in obj.ports", l, false},
+		{"obj.ports[1] == 443u", l, true},
+		{"obj.ports.exists(p, p < 100u)", l, true},
+		{"obj.offsets[1] == 1099511627776 && -1 in obj.offsets", l, true},
+		{"obj.offsets.exists(o, o < 0)", l, true},
+		{"size(obj.counts) == 3 && obj.counts.map(c, c * 2) == [2, 4, 6]", l, true},
+		{"obj.sizes[0] == 9223372036854775808u", l, true},
+		{"obj.weights.all(w, w > 0.0) && 1.5 in obj.weights", l, true},
+		{"obj.levels[0] == -128 && 127 in obj.levels", l, true},
+		{"obj.counts == [1, 2, 3]", l, true},
+		{"has(obj.ports)", &Listener{}, false},
+		{"has(obj.ports) && size(obj.ports) == 0", &Listener{Ports: []uint16{}}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.l, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
+
+type ContainerHistory struct {
+	Flags       []bool
+	ArgsHistory [][]string
+	PortHistory [][]uint16
+}
+
+func TestFieldsNestedSlices(t *testing.T) {
+	h := &ContainerHistory{
+		Flags:       []bool{true, false},
+		ArgsHistory: [][]string{{"sh", "-c"}, {}, nil, {"curl", "-s"}},
+		PortHistory: [][]uint16{{80}, nil},
+	}
+
+	tests := []struct {
+		expr string
+		h    *ContainerHistory
+		want bool
+	}{
+		{"obj.flags[0] && !obj.flags[1]", h, true},
+		{"true in obj.flags && obj.flags.exists(f, !f)", h, true},
+		{"obj.args_history.exists(a, 'curl' in a)", h, true},
+		{"obj.args_history.exists(a, 'wget' in a)", h, false},
+		{"size(obj.args_history) == 4 && size(obj.args_history[1]) == 0 && size(obj.args_history[2]) == 0", h, true},
+		{"obj.args_history[0][1] == '-c'", h, true},
+		{"obj.args_history.map(a, size(a)) == [2, 0, 0, 2]", h, true},
+		{"80u in obj.port_history[0] && obj.port_history[1] == []", h, true},
+		{"has(obj.args_history)", &ContainerHistory{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.h, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
+
+type Resolver struct {
+	DNSServers [4]string
+	Weights    [2]float64
+	Routes     [2][2]int
+	Upstreams  [1]Child
+	Empty      [0]string `cel:",omitempty"`
+}
+
+func TestFieldsArrays(t *testing.T) {
+	r := &Resolver{
+		DNSServers: [4]string{"1.1.1.1", "8.8.8.8"},
+		Weights:    [2]float64{0.25, 0.75},
+		Routes:     [2][2]int{{1, 2}, {3, 4}},
+		Upstreams:  [1]Child{{Name: "primary"}},
+	}
+
+	tests := []struct {
+		expr string
+		r    *Resolver
+		want bool
+	}{
+		{"obj.dns_servers[0] != ''", r, true},
+		{"obj.dns_servers[3] == '' && size(obj.dns_servers) == 4", r, true},
+		{"'8.8.8.8' in obj.dns_servers", r, true},
+		{"obj.weights.all(w, w < 1.0)", r, true},
+		{"obj.routes[1][0] == 3 && obj.routes.exists(r, 2 in r)", r, true},
+		{"obj.upstreams[0].name == 'primary'", r, true},
+		{"has(obj.dns_servers) && has(obj.upstreams)", &Resolver{}, true},
+		{"has(obj.empty)", r, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.r, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
+
+type Image struct {
+	Digest [4]byte
+	UUID   [16]byte
+}
+
+func TestFieldsByteArrays(t *testing.T) {
+	img := &Image{Digest: [4]byte{0x12, 0x34, 0x56, 0x78}}
+
+	for _, expr := range []string{
+		"obj.digest == b'\\x12\\x34\\x56\\x78'",
+		"size(obj.uuid) == 16 && size(obj.digest) == 4",
+		"obj.uuid == bytes('\\x00\\x00\\x00\\x00\\x00\\x00\\x00\\x00\\x00\\x00\\x00\\x00\\x00\\x00\\x00\\x00')",
+		"has(obj.uuid)",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			out, err := evalFields(t, img, expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.True {
+				t.Fatalf("expected 'true' but got '%v'", out)
+			}
+		})
+	}
+
+	// The value is a copy of the array.
+	out, err := evalFields(t, img, "obj.digest")
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	img.Digest[0] = 0
+	if b := out.Value().([]byte); b[0] != 0x12 {
+		t.Fatalf("expected the bytes to be copied but got %x", b)
+	}
+}
+
+type Lease struct {
+	Timeout   time.Duration
+	MaxAge    *time.Duration
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func TestFieldsDurations(t *testing.T) {
+	maxAge := 2 * time.Hour
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	lease := &Lease{
+		Timeout:   time.Minute,
+		MaxAge:    &maxAge,
+		CreatedAt: created,
+		UpdatedAt: created.Add(time.Hour),
+	}
+
+	tests := []struct {
+		expr  string
+		lease *Lease
+		want  bool
+	}{
+		{"obj.timeout > duration('30s')", lease, true},
+		{"obj.timeout == duration('1m')", lease, true},
+		{"obj.updated_at - obj.created_at < obj.max_age", lease, true},
+		{"obj.created_at + obj.timeout == timestamp('2024-01-01T00:01:00Z')", lease, true},
+		{"has(obj.timeout) && obj.timeout == duration('0s')", &Lease{}, true},
+		{"has(obj.max_age)", &Lease{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.lease, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
+
+type (
+	Status   string
+	Severity int
+	Priority int32
+	Epoch    int64
+	Count    uint
+	Port     uint32
+	Inode    uint64
+	Ratio    float32
+	Score    float64
+	Enabled  bool
+)
+
+type Service struct {
+	Status   Status
+	Severity Severity
+	Priority Priority
+	Epoch    Epoch
+	Count    Count
+	Port     Port
+	Inode    Inode
+	Ratio    Ratio
+	Score    Score
+	Enabled  Enabled
+	History  []Status
+	Labels   map[string]Status
+}
+
+func TestFieldsNamedPrimitives(t *testing.T) {
+	svc := &Service{
+		Status:   "running",
+		Severity: 3,
+		Priority: -1,
+		Epoch:    1700000000,
+		Count:    2,
+		Port:     443,
+		Inode:    1 << 40,
+		Ratio:    0.5,
+		Score:    9.5,
+		Enabled:  true,
+		History:  []Status{"pending", "running"},
+		Labels:   map[string]Status{"db": "stopped"},
+	}
+
+	tests := []string{
+		"obj.status == 'running'",
+		"obj.severity == 3",
+		"obj.priority < 0",
+		"obj.epoch == 1700000000",
+		"obj.count == 2u",
+		"obj.port == 443u",
+		"obj.inode == 1099511627776u",
+		"obj.ratio == 0.5",
+		"obj.score > 9.0",
+		"obj.enabled",
+		"'pending' in obj.history && obj.history[1] == 'running'",
+		"obj.labels['db'] == 'stopped'",
+	}
+
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			out, err := evalFields(t, svc, expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.True {
+				t.Fatalf("expected 'true' but got '%v'", out)
+			}
+		})
+	}
+}
+
+type Packet struct {
+	Int      int
+	Int8     int8
+	Int16    int16
+	Int32    int32
+	Int64    int64
+	Uint     uint
+	Protocol uint8
+	Uint16   uint16
+	Uint32   uint32
+	Uint64   uint64
+}
+
+func TestFieldsIntegerWidths(t *testing.T) {
+	pkt := &Packet{
+		Int:      -1,
+		Int8:     -8,
+		Int16:    -16,
+		Int32:    -32,
+		Int64:    -64,
+		Uint:     1,
+		Protocol: 6,
+		Uint16:   16,
+		Uint32:   32,
+		Uint64:   64,
+	}
+
+	tests := []string{
+		"obj.int == -1",
+		"obj.int8 == -8 && obj.int8 < 0",
+		"obj.int16 == -16",
+		"obj.int32 == -32",
+		"obj.int64 == -64",
+		"obj.uint == 1u",
+		"obj.protocol == 6u && obj.protocol < 17u",
+		"obj.uint16 == 16u",
+		"obj.uint32 == 32u",
+		"obj.uint64 == 64u",
+		"obj.int8 + obj.int16 == -24",
+		"obj.protocol + obj.uint16 == 22u",
+	}
+
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			out, err := evalFields(t, pkt, expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.True {
+				t.Fatalf("expected 'true' but got '%v'", out)
+			}
+		})
+	}
+}
+
+type Flow struct {
+	SrcIP   net.IP
+	DstIP   *net.IP
+	Addr    netip.Addr
+	Mapped  netip.Addr
+	Network netip.Prefix
+}
+
+func TestFieldsNetworkAddresses(t *testing.T) {
+	dst := net.ParseIP("2001:db8::1")
+
+	flow := &Flow{
+		SrcIP:   net.ParseIP("10.0.0.1"),
+		DstIP:   &dst,
+		Addr:    netip.MustParseAddr("2001:0db8:0000::0002"),
+		Mapped:  netip.MustParseAddr("::ffff:192.168.1.1"),
+		Network: netip.MustParsePrefix("::ffff:10.0.0.0/104"),
+	}
+
+	tests := []struct {
+		expr string
+		flow *Flow
+		want bool
+	}{
+		{"obj.src_ip == '10.0.0.1'", flow, true},
+		{"obj.dst_ip == '2001:db8::1'", flow, true},
+		{"obj.addr == '2001:db8::2'", flow, true},
+		{"obj.mapped == '192.168.1.1'", flow, true},
+		{"obj.network == '10.0.0.0/8'", flow, true},
+		{"obj.src_ip.startsWith('10.')", flow, true},
+		{"has(obj.src_ip) || has(obj.dst_ip)", &Flow{}, false},
+		{"has(obj.addr) || has(obj.network)", &Flow{}, false},
+		{"has(obj.addr) && has(obj.network)", flow, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.flow, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
+
+// PermissionError implements error on its value.
+type PermissionError struct {
+	path string
+}
+
+func (e PermissionError) Error() string {
+	return "permission denied: " + e.path
+}
+
+type Result struct {
+	Err     error
+	Denied  *PermissionError
+	Last    PermissionError
+	Timeout error
+}
+
+func TestFieldsErrors(t *testing.T) {
+	result := &Result{
+		Err:  fmt.Errorf("open config: %w", PermissionError{path: "/etc/shadow"}),
+		Last: PermissionError{path: "/root"},
+	}
+
+	tests := []struct {
+		expr   string
+		result *Result
+		want   bool
+	}{
+		{"has(obj.err) && obj.err.contains('permission denied')", result, true},
+		{"obj.err == 'open config: permission denied: /etc/shadow'", result, true},
+		{"obj.last.endsWith('/root')", result, true},
+		{"has(obj.timeout) || has(obj.denied)", result, false},
+		{"obj.denied == 'permission denied: /tmp'", &Result{Denied: &PermissionError{path: "/tmp"}}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.result, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
+
+type Annotated struct {
+	Meta   any
+	Extra  map[string]any
+	Parent any
+}
+
+func TestFieldsDyn(t *testing.T) {
+	tests := []struct {
+		expr      string
+		annotated *Annotated
+		want      bool
+	}{
+		{"obj.meta == 'x'", &Annotated{Meta: "x"}, true},
+		{"obj.meta.count > 3", &Annotated{Meta: map[string]int{"count": 4}}, true},
+		{"obj.meta == 'running'", &Annotated{Meta: Status("running")}, true},
+		{"obj.meta == 6u", &Annotated{Meta: uint8(6)}, true},
+		{"has(obj.meta)", &Annotated{}, false},
+		{"obj.extra.user == 'root' && obj.extra.uid == 0", &Annotated{Extra: map[string]any{"user": "root", "uid": 0}}, true},
+		{"obj.extra.status == 'running' && obj.extra.tags[1] == 'b'", &Annotated{Extra: map[string]any{"status": Status("running"), "tags": []string{"a", "b"}}}, true},
+		{"obj.extra.nested.status == 'running'", &Annotated{Extra: map[string]any{"nested": map[string]any{"status": "running"}}}, true},
+		{"obj.extra.missing == null", &Annotated{Extra: map[string]any{"missing": nil}}, true},
+		{"has(obj.extra)", &Annotated{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.annotated, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
+
+type EnrichedEvent struct {
+	Event  Source
+	Labels map[string]string
+}
+
+func TestFieldsNilInterfaces(t *testing.T) {
+	reg := xcel.NewRegistry()
+
+	// Types are registered from zero-value prototypes, so the interface
+	// field is nil at registration time.
+	if err := xcel.RegisterAll(reg, []any{&EnrichedEvent{}, &Task{}}); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	_, typ := xcel.NewObject(&EnrichedEvent{})
+	reg.Variable("obj", typ)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	eval := func(expr string, event *EnrichedEvent) (ref.Val, error) {
+		ast, iss := env.Compile(expr)
+		if iss.Err() != nil {
+			t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		out, _, err := prg.Eval(map[string]any{"obj": event})
+		return out, err
+	}
+
+	tests := []struct {
+		expr  string
+		event *EnrichedEvent
+		want  bool
+	}{
+		{"has(obj.event)", &EnrichedEvent{}, false},
+		{"has(obj.event)", &EnrichedEvent{Event: &Task{Name: "backup"}}, true},
+		{"obj.event.name == 'backup'", &EnrichedEvent{Event: &Task{Name: "backup"}}, true},
+		{"has(obj.event) && obj.event.name == 'backup'", &EnrichedEvent{}, false},
+	}
+
+	for _, test := range tests {
+		out, err := eval(test.expr, test.event)
+		if err != nil {
+			t.Fatalf("failed to evaluate %q: %v", test.expr, err)
+		}
+
+		if out != types.Bool(test.want) {
+			t.Fatalf("expected '%v' but got '%v' for %q", test.want, out, test.expr)
+		}
+	}
+
+	// Selecting through a nil interface is an error, not a panic.
+	if _, err := eval("obj.event.name == 'backup'", &EnrichedEvent{}); err == nil || !strings.Contains(err.Error(), "field 'event' is not set") {
+		t.Fatalf("expected an unset field error, got: %v", err)
+	}
+}
+
+type K8sEvent interface {
+	Object() string
+}
+
+type PodEvent struct {
+	Namespace string
+	Name      string
+}
+
+func (e *PodEvent) Object() string { return e.Namespace + "/" + e.Name }
+
+type NodeEvent struct {
+	Node string
+}
+
+func (e *NodeEvent) Object() string { return e.Node }
+
+type Wrapped struct {
+	K8sEvent
+	Extra string
+}
+
+func TestFieldsEmbeddedInterfaceImplementations(t *testing.T) {
+	impls := xcel.WithImplementations((*PodEvent)(nil), (*NodeEvent)(nil), (*Job)(nil))
+
+	obj, _ := xcel.NewObject(&Wrapped{})
+	fields := xcel.NewFields(obj, impls)
+
+	for _, name := range []string{"namespace", "name", "node", "extra"} {
+		if _, ok := fields[name]; !ok {
+			t.Fatalf("expected field %q to be promoted, got %v", name, fields)
+		}
+	}
+
+	tests := []struct {
+		expr    string
+		wrapped *Wrapped
+		want    bool
+	}{
+		{"obj.namespace == 'kube-system'", &Wrapped{K8sEvent: &PodEvent{Namespace: "kube-system"}}, true},
+		{"obj.node == 'node-1' && !has(obj.namespace)", &Wrapped{K8sEvent: &NodeEvent{Node: "node-1"}}, true},
+		{"has(obj.namespace) || has(obj.node)", &Wrapped{Extra: "x"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.wrapped, test.expr, impls)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
+
+type BaseEvent struct {
+	ID     string
+	Source string
+	Tags   []string
+}
+
+type AuthEvent struct {
+	*BaseEvent
+	User string
+}
+
+func TestFieldsEmbeddedPointer(t *testing.T) {
+	// Fields are promoted from the static type of the embedded pointer,
+	// even if it is nil in the object they are derived from.
+	obj, _ := xcel.NewObject(&AuthEvent{})
+	fields := xcel.NewFields(obj)
+
+	for _, name := range []string{"id", "source", "tags", "user"} {
+		if _, ok := fields[name]; !ok {
+			t.Fatalf("expected field %q to be promoted, got %v", name, fields)
+		}
+	}
+
+	tests := []struct {
+		expr  string
+		event *AuthEvent
+		want  bool
+	}{
+		{"obj.source == 'sshd' && 'prod' in obj.tags", &AuthEvent{BaseEvent: &BaseEvent{Source: "sshd", Tags: []string{"prod"}}}, true},
+		{"has(obj.id) || has(obj.source) || has(obj.tags)", &AuthEvent{User: "root"}, false},
+		{"obj.user == 'root' && !has(obj.source)", &AuthEvent{User: "root"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.event, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+
+	// Selecting a field through a nil embedded pointer is an unset field
+	// error, not a panic.
+	_, err := evalFields(t, &AuthEvent{}, "obj.source == ''")
+	if err == nil {
+		t.Fatal("expected an error selecting an unset promoted field")
+	}
+
+	for name, field := range fields {
+		if name != "user" && field.IsSet(&AuthEvent{}) {
+			t.Fatalf("expected field %q to be unset for a nil embedded pointer", name)
+		}
+	}
+}
+
+type traceInfo struct {
+	TraceID string
+}
+
+type eventBase struct {
+	traceInfo
+	ID        string
+	Timestamp time.Time
+	internal  string
+}
+
+type Event struct {
+	eventBase
+	Name string
+}
+
+type PointerEvent struct {
+	*eventBase
+	Name string
+}
+
+func TestFieldsUnexportedEmbed(t *testing.T) {
+	obj, _ := xcel.NewObject(&Event{})
+	fields := xcel.NewFields(obj)
+
+	for _, name := range []string{"id", "timestamp", "trace_id", "name"} {
+		if _, ok := fields[name]; !ok {
+			t.Fatalf("expected field %q to be promoted, got %v", name, fields)
+		}
+	}
+	if _, ok := fields["internal"]; ok {
+		t.Fatal("expected unexported field 'internal' to be skipped")
+	}
+
+	event := &Event{
+		eventBase: eventBase{
+			traceInfo: traceInfo{TraceID: "abc"},
+			ID:        "1",
+			Timestamp: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+			internal:  "secret",
+		},
+		Name: "login",
+	}
+
+	out, err := evalFields(t, event, "obj.id == '1' && obj.trace_id == 'abc' && obj.timestamp.getFullYear() == 2024 && obj.name == 'login'")
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+
+	// Unexported embedded pointers are promoted too, and unset when nil.
+	out, err = evalFields(t, &PointerEvent{Name: "login"}, "!has(obj.id) && !has(obj.trace_id) && obj.name == 'login'")
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+
+	out, err = evalFields(t, &PointerEvent{eventBase: &event.eventBase}, "obj.id == '1' && obj.trace_id == 'abc'")
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+}
+
+type Optional[T any] struct {
+	Value T
+	Set   bool
+}
+
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+type Settings struct {
+	Name    Optional[string]
+	Retries *Optional[int]
+	Owner   Pair[string, Optional[string]]
+}
+
+func TestFieldsGenericStructs(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	obj, typ := xcel.NewObject(&Settings{})
+	fields := xcel.NewFields(obj)
+	xcel.RegisterObject(ta, tp, obj, typ, fields)
+
+	// Each instantiation is its own nested object type.
+	if fields["name"].Type.TypeName() == fields["retries"].Type.TypeName() {
+		t.Fatalf("expected distinct types for each instantiation, got %s", fields["name"].Type)
+	}
+	for _, name := range []string{"name", "retries", "owner"} {
+		if _, ok := tp.FindStructType(fields[name].Type.TypeName()); !ok {
+			t.Fatalf("expected the type of field %q to be registered, got:\n%s", name, tp.Schema())
+		}
+	}
+
+	settings := &Settings{
+		Name:    Optional[string]{Value: "api", Set: true},
+		Retries: &Optional[int]{Value: 3, Set: true},
+		Owner:   Pair[string, Optional[string]]{Key: "team", Value: Optional[string]{Value: "infra", Set: true}},
+	}
+
+	tests := []struct {
+		expr     string
+		settings *Settings
+		want     bool
+	}{
+		{"obj.name.set && obj.name.value == 'api'", settings, true},
+		{"obj.retries.set && obj.retries.value > 2", settings, true},
+		{"obj.owner.key == 'team' && obj.owner.value.value == 'infra'", settings, true},
+		{"!has(obj.retries) && !obj.name.set", &Settings{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.settings, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
+
+type HTTPRequest struct {
+	Method  string
+	Headers http.Header
+	Query   map[string][]string
+	Trailer map[string][]string
+}
+
+func TestFieldsMapOfLists(t *testing.T) {
+	req := &HTTPRequest{
+		Method: "GET",
+		Headers: http.Header{
+			"X-Forwarded-For": {"10.0.0.1", "10.0.0.2"},
+			"Content-Type":    {"application/json"},
+		},
+		Query: map[string][]string{"ids": {"1", "2", "3"}},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"'X-Forwarded-For' in obj.headers && obj.headers['X-Forwarded-For'].size() > 1", true},
+		{"obj.headers['X-Forwarded-For'][1] == '10.0.0.2'", true},
+		{"'x-forwarded-for' in obj.headers", false},
+		{"obj.query['ids'].all(id, int(id) > 0)", true},
+		{"has(obj.headers) && !has(obj.trailer)", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, req, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+
+	// Empty maps are set, unlike nil maps.
+	out, err := evalFields(t, &HTTPRequest{Headers: http.Header{}}, "has(obj.headers) && size(obj.headers) == 0")
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+}
+
+type PodStatus struct {
+	RestartTimes []time.Time
+	ProbeTimes   []*time.Time
+	Checkpoints  [][]EventTime
+}
+
+func TestFieldsTimeLists(t *testing.T) {
+	first := time.Date(2024, time.December, 31, 0, 0, 0, 0, time.UTC)
+	second := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	status := &PodStatus{
+		RestartTimes: []time.Time{first, second},
+		ProbeTimes:   []*time.Time{&first, nil, &second},
+		Checkpoints:  [][]EventTime{{EventTime(first)}, {EventTime(second)}},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"obj.restart_times.exists(t, t > timestamp('2025-01-01T00:00:00Z'))", true},
+		{"obj.restart_times.all(t, t > timestamp('2025-01-01T00:00:00Z'))", false},
+		{"obj.restart_times[0].getFullYear() == 2024", true},
+		{"obj.probe_times.size() == 3 && obj.probe_times[2] == timestamp('2025-03-01T00:00:00Z')", true},
+		{"obj.checkpoints[1][0] == timestamp('2025-03-01T00:00:00Z')", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, status, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+
+	// Nil elements are an error only when they are accessed.
+	_, err := evalFields(t, status, "obj.probe_times[1] > timestamp('2025-01-01T00:00:00Z')")
+	if err == nil || !strings.Contains(err.Error(), "nil") {
+		t.Fatalf("expected a nil element error, got: %v", err)
+	}
+}
+
+type EventBatch struct {
+	Events []K8sEvent
+}
+
+func TestFieldsInterfaceSlices(t *testing.T) {
+	impls := xcel.WithImplementations((*PodEvent)(nil), (*NodeEvent)(nil))
+
+	batch := &EventBatch{
+		Events: []K8sEvent{
+			&NodeEvent{Node: "node-1"},
+			nil,
+			&PodEvent{Namespace: "default", Name: "web"},
+		},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"obj.events.size() == 3", true},
+		{"obj.events.exists(e, e.namespace == 'default')", true},
+		{"obj.events.exists(e, has(e.namespace) && e.namespace == 'kube-system')", false},
+		{"obj.events[0].node == 'node-1' && !has(obj.events[0].namespace)", true},
+		{"obj.events[1] == null", true},
+		{"obj.events.filter(e, e != null && has(e.name)).map(e, e.name) == ['web']", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, batch, test.expr, impls)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+
+	// Selecting a field of a nil element is an error, not a panic.
+	if _, err := evalFields(t, batch, "obj.events[1].namespace == 'default'", impls); err == nil {
+		t.Fatal("expected an error selecting a field of a nil element")
+	}
+}
+
+type Worker struct {
+	Name     string
+	Done     chan struct{}
+	Gain     complex128
+	Handle   unsafe.Pointer
+	Callback func() error
+	Retries  int
+}
+
+func TestFieldsUnsupportedKinds(t *testing.T) {
+	var skipped []string
+
+	obj, _ := xcel.NewObject(&Worker{})
+	fields := xcel.NewFields(obj, xcel.WithSkippedFields(func(f xcel.SkippedField) {
+		skipped = append(skipped, fmt.Sprintf("%s %s", f.Path, f.Type))
+	}))
+
+	want := []string{"Done chan struct {}", "Gain complex128", "Handle unsafe.Pointer", "Callback func() error"}
+	if !reflect.DeepEqual(skipped, want) {
+		t.Fatalf("expected skipped fields %q but got %q", want, skipped)
+	}
+	if len(fields) != 2 {
+		t.Fatalf("expected only the supported fields, got %v", fields)
+	}
+
+	out, err := evalFields(t, &Worker{Name: "a", Done: make(chan struct{}), Retries: 2}, "obj.name == 'a' && obj.retries == 2")
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+
+	// Type mappers can still map fields of unsupported kinds.
+	fields = xcel.NewFields(obj, xcel.WithTypeMapper(func(sf reflect.StructField) (*types.Type, xcel.ConvertFunc, bool) {
+		if sf.Type.Kind() != reflect.Complex128 {
+			return nil, nil, false
+		}
+		return types.DoubleType, func(v reflect.Value) (any, error) {
+			return real(v.Complex()), nil
+		}, true
+	}))
+	if _, ok := fields["gain"]; !ok {
+		t.Fatalf("expected the mapped field 'gain', got %v", fields)
+	}
+}
+
+type QuotaConfig struct {
+	Name   string
+	Limits struct{ CPU, Memory int64 }
+	Rules  []struct {
+		Match string
+		Deny  bool
+	}
+}
+
+func TestFieldsAnonymousStructs(t *testing.T) {
+	obj, _ := xcel.NewObject(&QuotaConfig{})
+	fields := xcel.NewFields(obj)
+
+	if got, want := fields["limits"].Type.TypeName(), "*xcel_test.QuotaConfig.Limits"; got != want {
+		t.Fatalf("expected the type %q but got %q", want, got)
+	}
+	if got, want := fields["rules"].Type.String(), "list(*xcel_test.QuotaConfig.Rules)"; got != want {
+		t.Fatalf("expected the type %q but got %q", want, got)
+	}
+
+	config := &QuotaConfig{Name: "default"}
+	config.Limits.CPU = 2
+	config.Limits.Memory = 1 << 30
+	config.Rules = append(config.Rules, struct {
+		Match string
+		Deny  bool
+	}{Match: "*.exe", Deny: true})
+
+	for _, expr := range []string{
+		"obj.limits.cpu == 2 && obj.limits.memory > 1024",
+		"obj.rules.exists(r, r.match == '*.exe' && r.deny)",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			out, err := evalFields(t, config, expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.True {
+				t.Fatalf("expected 'true' but got '%v'", out)
+			}
+		})
+	}
+}
+
+type ObjectMeta struct {
+	Name        string
+	Finalizers  *[]string
+	Annotations *map[string]string
+	Replicas    *int32
+}
+
+func TestFieldsPointerCollections(t *testing.T) {
+	finalizers := []string{"foo", "bar"}
+	annotations := map[string]string{"team": "infra"}
+	replicas := int32(3)
+
+	meta := &ObjectMeta{Name: "web", Finalizers: &finalizers, Annotations: &annotations, Replicas: &replicas}
+
+	empty := []string{}
+
+	tests := []struct {
+		expr string
+		meta *ObjectMeta
+		want bool
+	}{
+		{"has(obj.finalizers) && 'foo' in obj.finalizers", meta, true},
+		{"obj.annotations['team'] == 'infra' && obj.replicas == 3", meta, true},
+		{"has(obj.finalizers) && size(obj.finalizers) == 0", &ObjectMeta{Finalizers: &empty}, true},
+		{"has(obj.finalizers) || has(obj.annotations) || has(obj.replicas)", &ObjectMeta{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.meta, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+
+	// Nil pointers are unset fields, like other unset fields.
+	_, err := evalFields(t, &ObjectMeta{}, "'foo' in obj.finalizers")
+	if err == nil || !strings.Contains(err.Error(), "field 'finalizers' is not set") {
+		t.Fatalf("expected an unset field error, got: %v", err)
+	}
+}
+
+type Tags []string
+
+type Labels map[string]string
+
+type Tagged struct {
+	Tags
+	Labels
+	Name string
+}
+
+func TestFieldsEmbeddedNonStruct(t *testing.T) {
+	obj, _ := xcel.NewObject(&Tagged{})
+	fields := xcel.NewFields(obj)
+
+	if got := fields["tags"].Type.String(); got != "list(string)" {
+		t.Fatalf("expected 'tags' to be a list(string) but got %s", got)
+	}
+	if got := fields["labels"].Type.String(); got != "map(string, string)" {
+		t.Fatalf("expected 'labels' to be a map(string, string) but got %s", got)
+	}
+
+	tagged := &Tagged{Tags: Tags{"prod", "web"}, Labels: Labels{"team": "infra"}, Name: "api"}
+
+	tests := []struct {
+		expr   string
+		tagged *Tagged
+		want   bool
+	}{
+		{"'prod' in obj.tags && obj.labels['team'] == 'infra' && obj.name == 'api'", tagged, true},
+		{"has(obj.tags) || has(obj.labels)", &Tagged{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.tagged, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
+
+type DiamondBase struct {
+	ID     string
+	Region string
+}
+
+type DiamondA struct {
+	DiamondBase
+	Name string
+}
+
+type DiamondB struct {
+	DiamondBase
+	Owner string
+}
+
+type DiamondRoot struct {
+	DiamondA
+	DiamondB
+	Region string
+}
+
+func TestFieldsDiamondEmbedding(t *testing.T) {
+	var skipped []string
+
+	obj, _ := xcel.NewObject(&DiamondRoot{})
+	fields := xcel.NewFields(obj, xcel.WithSkippedFields(func(f xcel.SkippedField) {
+		if f.Ambiguous {
+			skipped = append(skipped, f.Path)
+		}
+	}))
+
+	want := []string{"DiamondA.DiamondBase.ID", "DiamondB.DiamondBase.ID"}
+	if !reflect.DeepEqual(skipped, want) {
+		t.Fatalf("expected ambiguous fields %q but got %q", want, skipped)
+	}
+	if _, ok := fields["id"]; ok {
+		t.Fatal("expected the ambiguous field 'id' to be left out")
+	}
+
+	root := &DiamondRoot{
+		DiamondA: DiamondA{DiamondBase: DiamondBase{ID: "a", Region: "us"}, Name: "web"},
+		DiamondB: DiamondB{DiamondBase: DiamondBase{ID: "b"}, Owner: "infra"},
+		Region:   "eu",
+	}
+
+	out, err := evalFields(t, root, "obj.name == 'web' && obj.owner == 'infra' && obj.region == 'eu'")
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+}
+
+type Runtime struct {
+	ContainerID string
+}
+
+type TestCommonData struct {
+	Runtime Runtime
+}
+
+type HTTPInfo struct {
+	Method string
+}
+
+type TestBase struct {
+	TestCommonData
+	*HTTPInfo
+	HttpInfo string
+	Name     string
+}
+
+func TestFieldsEmbeddedTypePaths(t *testing.T) {
+	var skipped []string
+
+	opts := []xcel.Option{
+		xcel.WithEmbeddedTypePaths(),
+		xcel.WithSkippedFields(func(f xcel.SkippedField) {
+			skipped = append(skipped, f.Path)
+		}),
+	}
+
+	obj, _ := xcel.NewObject(&TestBase{})
+	fields := xcel.NewFields(obj, opts...)
+
+	for _, name := range []string{"test_common_data", "runtime", "method", "http_info", "name"} {
+		if _, ok := fields[name]; !ok {
+			t.Fatalf("expected field %q, got %v", name, fields)
+		}
+	}
+	if got := fields["http_info"].Type; got != types.StringType {
+		t.Fatalf("expected the 'http_info' field to keep its string type, got %s", got)
+	}
+	if want := []string{"HTTPInfo"}; !reflect.DeepEqual(skipped, want) {
+		t.Fatalf("expected skipped fields %q but got %q", want, skipped)
+	}
+
+	base := &TestBase{
+		TestCommonData: TestCommonData{Runtime: Runtime{ContainerID: "abc"}},
+		HTTPInfo:       &HTTPInfo{Method: "GET"},
+	}
+
+	for _, expr := range []string{
+		"obj.test_common_data.runtime.container_id == 'abc'",
+		"obj.test_common_data.runtime.container_id == obj.runtime.container_id",
+		"obj.method == 'GET'",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			out, err := evalFields(t, base, expr, opts...)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.True {
+				t.Fatalf("expected 'true' but got '%v'", out)
+			}
+		})
+	}
+
+	// Without the option, only the promoted fields are registered.
+	if _, ok := xcel.NewFields(obj)["test_common_data"]; ok {
+		t.Fatal("expected no embedded type path without WithEmbeddedTypePaths")
+	}
+}
+
+type ImageRef struct {
+	Name string
+}
+
+type TestRuntime struct {
+	ContainerID string
+	Image       ImageRef
+}
+
+type Workload struct {
+	Name    string
+	Runtime *TestRuntime
+}
+
+type CollidingWorkload struct {
+	Runtime            TestRuntime
+	RuntimeContainerID string
+}
+
+func TestFieldsFlattenNested(t *testing.T) {
+	obj, _ := xcel.NewObject(&Workload{})
+
+	fields := xcel.NewFields(obj, xcel.WithFlattenNested(1))
+	if _, ok := fields["runtime_container_id"]; !ok {
+		t.Fatalf("expected the flattened field 'runtime_container_id', got %v", fields)
+	}
+	if _, ok := fields["runtime_image_name"]; ok {
+		t.Fatal("expected no flattened fields beyond the depth")
+	}
+
+	workload := &Workload{Name: "web", Runtime: &TestRuntime{ContainerID: "abc", Image: ImageRef{Name: "nginx"}}}
+
+	tests := []struct {
+		expr     string
+		workload *Workload
+		want     bool
+	}{
+		{"obj.runtime_container_id == 'abc' && obj.runtime_container_id == obj.runtime.container_id", workload, true},
+		{"obj.runtime_image_name == 'nginx' && obj.runtime_image.name == 'nginx'", workload, true},
+		{"has(obj.runtime_container_id) || has(obj.runtime_image_name)", &Workload{Name: "web"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.workload, test.expr, xcel.WithFlattenNested(2))
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(fmt.Sprint(r), "'runtime_container_id' collides") {
+			t.Fatalf("expected a collision panic, got: %v", r)
+		}
+	}()
+
+	colliding, _ := xcel.NewObject(&CollidingWorkload{})
+	xcel.NewFields(colliding, xcel.WithFlattenNested(1))
+}
+
+type K8sInfo struct {
+	ContainerName string
+}
+
+type CommonData struct {
+	K8s K8sInfo
+	ID  string
+}
+
+type ThirdPartyBase struct {
+	CommonData
+	ID string
+}
+
+type ThirdPartyEvent struct {
+	ThirdPartyBase
+	Source
+	Name string
+}
+
+func TestFieldsWithoutPromotion(t *testing.T) {
+	obj, _ := xcel.NewObject(&ThirdPartyEvent{})
+	fields := xcel.NewFields(obj, xcel.WithoutPromotion())
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if want := []string{"name", "source", "third_party_base"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected fields %q but got %q", want, names)
+	}
+
+	event := &ThirdPartyEvent{
+		ThirdPartyBase: ThirdPartyBase{
+			CommonData: CommonData{K8s: K8sInfo{ContainerName: "nginx"}, ID: "inner"},
+			ID:         "outer",
+		},
+		Name: "start",
+	}
+
+	out, err := evalFields(t, event, "obj.third_party_base.common_data.k8s.container_name == 'nginx' && obj.third_party_base.id == 'outer' && obj.third_party_base.common_data.id == 'inner'", xcel.WithoutPromotion())
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+}
+
+type ObjectMetadata struct {
+	Name   string
+	Labels map[string]string
+}
+
+type PodTemplate struct {
+	Metadata *ObjectMetadata
+}
+
+type WorkloadSpec struct {
+	Replicas int
+	Template PodTemplate
+}
+
+type StatefulSet struct {
+	Spec *WorkloadSpec
+}
+
+func TestFieldsDeepNesting(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	// The types are derived from a zero-value prototype, whose nested
+	// pointers are all nil.
+	obj, typ := xcel.NewObject(&StatefulSet{})
+	xcel.RegisterObject(ta, tp, obj, typ, xcel.NewFields(obj))
+
+	env, err := cel.NewEnv(
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("obj.spec.template.metadata.name == 'web' && obj.spec.template.metadata.labels['app'] == 'nginx'")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	set := &StatefulSet{Spec: &WorkloadSpec{Template: PodTemplate{Metadata: &ObjectMetadata{Name: "web", Labels: map[string]string{"app": "nginx"}}}}}
+
+	out, _, err := prg.Eval(map[string]any{"obj": set})
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+
+	// Nil objects along the path are unset.
+	out, err = evalFields(t, &StatefulSet{Spec: &WorkloadSpec{}}, "has(obj.spec.template) && !has(obj.spec.template.metadata) && !has(obj.spec.template.metadata.name)")
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+}
+
+type TreeNode struct {
+	Name   string
+	Parent *TreeNode
+	Team   *Team
+}
+
+type Team struct {
+	Name  string
+	Lead  *TreeNode
+	Teams []Team
+}
+
+func TestFieldsRecursiveTypes(t *testing.T) {
+	// Derived from a prototype whose pointers are all nil, with the
+	// TreeNode -> Team -> TreeNode cycle derived once.
+	obj, _ := xcel.NewObject(&TreeNode{})
+	fields := xcel.NewFields(obj)
+
+	if _, ok := fields["team"]; !ok {
+		t.Fatalf("expected the 'team' field, got %v", fields)
+	}
+
+	root := &TreeNode{Name: "root", Team: &Team{Name: "infra"}}
+	root.Team.Lead = root
+	child := &TreeNode{Name: "child", Parent: &TreeNode{Name: "mid", Parent: root}}
+
+	tests := []struct {
+		expr string
+		node *TreeNode
+		want bool
+	}{
+		{"obj.parent.parent.name == 'root'", child, true},
+		{"obj.team.lead.team.lead.name == 'root' && obj.team.name == 'infra'", root, true},
+		{"obj.team.teams.size() == 0", root, true},
+		{"has(obj.parent.parent.name)", &TreeNode{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.node, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+
+	// Compiles against a nil parent, and is an unset field error.
+	if _, err := evalFields(t, &TreeNode{}, "obj.parent.parent.name == 'root'"); err == nil {
+		t.Fatal("expected an error selecting a field through a nil parent")
+	}
+}
+
+func TestFieldsInterfaceImplementations(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	// Registered once, from a prototype without an event.
+	obj, typ := xcel.NewObject(&EnrichedEvent{})
+	xcel.RegisterObject(ta, tp, obj, typ, xcel.NewFields(obj, xcel.WithImplementations((*Process)(nil), (*Pod)(nil), (*Job)(nil))))
+
+	env, err := cel.NewEnv(
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile(`
+		has(obj.event.pid) ? 'process ' + string(obj.event.pid) :
+		has(obj.event.namespace) ? 'pod ' + obj.event.namespace :
+		has(obj.event.name) ? 'job ' + obj.event.name :
+		'none'`)
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	tests := []struct {
+		event *EnrichedEvent
+		want  string
+	}{
+		{&EnrichedEvent{Event: &Process{PID: 42}}, "process 42"},
+		{&EnrichedEvent{Event: &Pod{Namespace: "default"}}, "pod default"},
+		{&EnrichedEvent{Event: &Job{Name: "backup"}}, "job backup"},
+		{&EnrichedEvent{Event: &Process{PID: 7}}, "process 7"},
+	}
+
+	for _, test := range tests {
+		out, _, err := prg.Eval(map[string]any{"obj": test.event})
+		if err != nil {
+			t.Fatalf("failed to evaluate program for %T: %v", test.event.Event, err)
+		}
+
+		if out.Value() != test.want {
+			t.Fatalf("expected %q but got '%v'", test.want, out.Value())
+		}
+	}
+}
+
+func TestFieldsFromTypeOnly(t *testing.T) {
+	keys := func(fields map[string]*types.FieldType) []string {
+		names := make([]string, 0, len(fields))
+		for name, field := range fields {
+			names = append(names, name+" "+field.Type.String())
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	tests := []struct {
+		zero, populated any
+	}{
+		{
+			&Example{},
+			&Example{Name: "test", Tags: []string{"a"}, Parent: &Example{Name: "root"}, Fn: func(int) string { return "" }, Blob: []byte("b")},
+		},
+		{
+			&AuthEvent{},
+			&AuthEvent{BaseEvent: &BaseEvent{ID: "1"}, User: "root"},
+		},
+		{
+			&StatefulSet{},
+			&StatefulSet{Spec: &WorkloadSpec{Template: PodTemplate{Metadata: &ObjectMetadata{Name: "web"}}}},
+		},
+	}
+
+	for _, test := range tests {
+		zeroObj, _ := xcel.NewObject(test.zero)
+		populatedObj, _ := xcel.NewObject(test.populated)
+
+		zero, populated := keys(xcel.NewFields(zeroObj)), keys(xcel.NewFields(populatedObj))
+		if !reflect.DeepEqual(zero, populated) {
+			t.Fatalf("expected the same fields for %T, got %q and %q", test.zero, zero, populated)
+		}
+	}
+}
+
+func TestFieldsNilIntermediates(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	obj, typ := xcel.NewObject(&TreeNode{})
+	xcel.RegisterObject(ta, tp, obj, typ, xcel.NewFields(obj))
+
+	env, err := cel.NewEnv(
+		cel.OptionalTypes(),
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	orphan := &TreeNode{Name: "orphan"}
+
+	tests := []struct {
+		expr string
+		want ref.Val
+		err  string
+	}{
+		{expr: "has(obj.parent)", want: types.False},
+		{expr: "has(obj.parent.name)", want: types.False},
+		// Selecting through nil is an error for that subexpression only,
+		// so the logical operators can still absorb it.
+		{expr: "obj.parent.name == 'x' || obj.name == 'orphan'", want: types.True},
+		{expr: "obj.name == 'root' && obj.parent.name == 'x'", want: types.False},
+		{expr: "obj.parent.parent.name == 'x'", err: "xcel: field 'name' is not set"},
+		{expr: "obj.?parent.?name.orValue('none')", want: types.String("none")},
+		{expr: "obj.?parent.?parent.?name.hasValue()", want: types.False},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			ast, iss := env.Compile(test.expr)
+			if iss.Err() != nil {
+				t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			out, _, err := prg.Eval(map[string]any{"obj": orphan})
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("expected error %q but got '%v'", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out.Equal(test.want) != types.True {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
+
+type Resources struct {
+	CPU    int64
+	Memory int64
+}
+
+type ContainerSpec struct {
+	Name     string
+	Requests Resources
+	Limits   *Resources
+}
+
+func TestFieldsNestedGettersWrapObjects(t *testing.T) {
+	tp := xcel.NewTypeProvider()
+
+	obj, typ := xcel.NewObject(&ContainerSpec{})
+	fields := xcel.NewFields(obj)
+	xcel.RegisterObject(xcel.NewTypeAdapter(), tp, obj, typ, fields)
+
+	container := &ContainerSpec{
+		Name:     "app",
+		Requests: Resources{CPU: 100, Memory: 256},
+		Limits:   &Resources{CPU: 500, Memory: 1024},
+	}
+
+	// The getters of nested struct fields return objects themselves, for
+	// values other than the one the fields were derived from.
+	for _, name := range []string{"requests", "limits"} {
+		v, err := fields[name].GetFrom(container)
+		if err != nil {
+			t.Fatalf("failed to get field %q: %v", name, err)
+		}
+		if _, ok := v.(ref.Val); !ok {
+			t.Fatalf("expected field %q to be an object, got '%T'", name, v)
+		}
+	}
+
+	// So nested fields can be selected with an adapter the nested type
+	// was never registered with.
+	env, err := cel.NewEnv(
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(types.DefaultTypeAdapter),
+		cel.CustomTypeProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("obj.requests.cpu == 100 && obj.limits.memory == 1024")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	obj.Raw = container
+
+	out, _, err := prg.Eval(map[string]any{"obj": obj})
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+}
+
+type NamedNested struct {
+	Toto string
+}
+
+type NestedHolder struct {
+	NamedNested NamedNested
+}
+
+type NestingEvent struct {
+	NestedHolder
+	Direct *NamedNested
+}
+
+func TestFieldsNestedTypeNames(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	obj, typ := xcel.NewObject(&NestingEvent{})
+	fields := xcel.NewFields(obj)
+	xcel.RegisterObject(ta, tp, obj, typ, fields)
+
+	// Struct fields, whether promoted or declared directly, and whether
+	// values or pointers, have the type the nested object is registered
+	// under, which is also the type DefaultTypeMapper gives them.
+	_, want := xcel.NewObject(&NamedNested{})
+	for _, name := range []string{"named_nested", "direct"} {
+		if got := fields[name].Type.TypeName(); got != want.TypeName() {
+			t.Fatalf("expected field %q to be of type '%s', got '%s'", name, want.TypeName(), got)
+		}
+	}
+
+	sf, _ := reflect.TypeOf(NestingEvent{}).FieldByName("NamedNested")
+	if mapped, _, _ := xcel.DefaultTypeMapper(sf); mapped.TypeName() != want.TypeName() {
+		t.Fatalf("expected DefaultTypeMapper to map to '%s', got '%s'", want.TypeName(), mapped.TypeName())
+	}
+
+	// The nested fields type-check against the provider alone.
+	env, err := cel.NewEnv(
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	for _, expr := range []string{"obj.named_nested.toto", "obj.direct.toto"} {
+		ast, iss := env.Compile(expr)
+		if iss.Err() != nil {
+			t.Fatalf("failed to compile CEL expression %q: %v", expr, iss.Err())
+		}
+		if ast.OutputType() != types.StringType {
+			t.Fatalf("expected %q to be of type 'string', got '%v'", expr, ast.OutputType())
+		}
+	}
+}
+
+type ProcessInfo struct {
+	ExePath     string `cel:"exe"`
+	ContainerID string `cel:"container_id,omitempty"`
+}
+
+type RenamedEvent struct {
+	ProcessInfo
+	Cmdline string `cel:""`
+	Comm    string `cel:",omitempty"`
+}
+
+type CollidingNames struct {
+	Exe     string
+	ExePath string `cel:"exe"`
+}
+
+func TestFieldsTagNames(t *testing.T) {
+	event := &RenamedEvent{
+		ProcessInfo: ProcessInfo{ExePath: "/usr/bin/test-process"},
+		Cmdline:     "test-process --flag",
+	}
+
+	tests := []struct {
+		expr string
+		want ref.Val
+	}{
+		{expr: "obj.exe == '/usr/bin/test-process'", want: types.True},
+		{expr: "has(obj.container_id)", want: types.False},
+		{expr: "obj.cmdline.startsWith('test-process')", want: types.True},
+		{expr: "has(obj.comm)", want: types.False},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, event, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out.Equal(test.want) != types.True {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+
+	obj, _ := xcel.NewObject(event)
+	if _, ok := xcel.NewFields(obj)["exe_path"]; ok {
+		t.Fatal("expected the tag name to replace 'exe_path'")
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(fmt.Sprint(r), "fields 'Exe' and 'ExePath'") {
+			t.Fatalf("expected a collision panic, got '%v'", r)
+		}
+	}()
+
+	colliding, _ := xcel.NewObject(&CollidingNames{})
+	xcel.NewFields(colliding)
+}
+
+type TokenCache struct {
+	Entries map[string]string
+}
+
+type DebugInfo struct {
+	Trace string
+}
+
+type Credentials struct {
+	DebugInfo `cel:"-"`
+
+	User        string
+	SecretToken string      `cel:"-"`
+	Cache       *TokenCache `cel:"-"`
+}
+
+func TestFieldsExcluded(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	obj, typ := xcel.NewObject(&Credentials{
+		User:        "alice",
+		SecretToken: "hunter2",
+		Cache:       &TokenCache{},
+		DebugInfo:   DebugInfo{Trace: "abc"},
+	})
+	xcel.RegisterObject(ta, tp, obj, typ, xcel.NewFields(obj))
+
+	env, err := cel.NewEnv(
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	if _, iss := env.Compile("obj.user == 'alice'"); iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	for _, expr := range []string{"obj.secret_token", "obj.cache", "obj.debug_info", "obj.trace"} {
+		_, iss := env.Compile(expr)
+		if iss.Err() == nil || !strings.Contains(iss.Err().Error(), "undefined field") {
+			t.Fatalf("expected %q to be an undefined field, got: %v", expr, iss.Err())
+		}
+	}
+
+	// Nested objects of excluded fields are not registered.
+	_, cacheType := xcel.NewObject(&TokenCache{})
+	if _, ok := tp.FindStructType(cacheType.TypeName()); ok {
+		t.Fatalf("expected '%s' not to be registered", cacheType.TypeName())
+	}
+}
+
+type PluginEvent struct {
+	Exe     string
+	ExePath string `cel:"exe"`
+	Name    string
+	Label   string `cel:"name"`
+	Nested  *PluginDetails
+}
+
+type PluginDetails struct {
+	ID    string
+	Ident string `cel:"id"`
+}
+
+func TestNewFieldsE(t *testing.T) {
+	obj, _ := xcel.NewObject(&PluginEvent{})
+
+	fields, err := xcel.NewFieldsE(obj)
+	if err == nil || fields != nil {
+		t.Fatalf("expected collisions to be an error, got '%v'", err)
+	}
+
+	// Each collision is reported, including those of nested objects.
+	for _, want := range []string{
+		"fields 'Exe' and 'ExePath' of '*xcel_test.PluginEvent' are both named 'exe'",
+		"fields 'Name' and 'Label' of '*xcel_test.PluginEvent' are both named 'name'",
+		"fields 'ID' and 'Ident' of '*xcel_test.PluginDetails' are both named 'id'",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected error to contain %q, got: %v", want, err)
+		}
+	}
+
+	var collision *xcel.FieldCollisionError
+	if !errors.As(err, &collision) || collision.Name != "exe" || collision.Paths != [2]string{"Exe", "ExePath"} {
+		t.Fatalf("expected a field collision error, got '%#v'", collision)
+	}
+
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+	tp.Freeze()
+
+	person, typ := xcel.NewObject(&Person{})
+	if err := xcel.RegisterObjectE(ta, tp, person, typ, xcel.NewFields(person)); !errors.Is(err, xcel.ErrFrozen) {
+		t.Fatalf("expected a frozen error, got: %v", err)
+	}
+}
+
+type NodeRuntime struct {
+	ContainerId string
+	Runtime     string
+}
+
+type NodeCommon struct {
+	NodeRuntime
+	PodName string
+	Node    string `cel:"runtime"`
+}
+
+type AgentEvent struct {
+	NodeCommon
+	ContainerID string
+}
+
+type NodeMetrics struct {
+	Host string `cel:"pod_name"`
+}
+
+type AmbiguousAgentEvent struct {
+	NodeCommon
+	NodeMetrics
+}
+
+func TestFieldsShallowestWins(t *testing.T) {
+	event := &AgentEvent{
+		NodeCommon: NodeCommon{
+			NodeRuntime: NodeRuntime{ContainerId: "deep", Runtime: "containerd"},
+			PodName:     "nginx",
+			Node:        "node-1",
+		},
+		ContainerID: "shallow",
+	}
+
+	// Fields named like shallower fields are hidden by them, like Go
+	// selectors, whether they are named after their Go name or a tag.
+	tests := []struct {
+		expr string
+		want ref.Val
+	}{
+		{expr: "obj.container_id", want: types.String("shallow")},
+		{expr: "obj.runtime", want: types.String("node-1")},
+		{expr: "obj.pod_name", want: types.String("nginx")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, event, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out.Equal(test.want) != types.True {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+
+	// Only fields of the same depth named alike collide.
+	obj, _ := xcel.NewObject(&AmbiguousAgentEvent{})
+	_, err := xcel.NewFieldsE(obj)
+
+	var collision *xcel.FieldCollisionError
+	if !errors.As(err, &collision) || collision.Paths != [2]string{"NodeCommon.PodName", "NodeMetrics.Host"} {
+		t.Fatalf("expected a collision of 'pod_name', got: %v", err)
+	}
+	if strings.Contains(err.Error(), "container_id") || strings.Contains(err.Error(), "'runtime'") {
+		t.Fatalf("expected only the same depth collision, got: %v", err)
+	}
+}
+
+type RuntimeEvent struct {
+	Runtime
+	PID int
+}
+
+type FlowSource struct {
+	Host string
+}
+
+type FlowDestination struct {
+	Host string
+}
+
+type ThirdPartyRecord struct {
+	Runtime
+	RuntimeEvent
+	FlowSource
+	FlowDestination
+}
+
+func TestFieldsCollisionRename(t *testing.T) {
+	record := &ThirdPartyRecord{
+		Runtime:         Runtime{ContainerID: "outer"},
+		RuntimeEvent:    RuntimeEvent{Runtime: Runtime{ContainerID: "inner"}, PID: 42},
+		FlowSource:      FlowSource{Host: "10.0.0.1"},
+		FlowDestination: FlowDestination{Host: "10.0.0.2"},
+	}
+
+	var renames []xcel.FieldRename
+	report := xcel.WithCollisionRename(func(r xcel.FieldRename) {
+		renames = append(renames, r)
+	})
+
+	tests := []struct {
+		expr string
+		want ref.Val
+	}{
+		{expr: "obj.container_id", want: types.String("outer")},
+		{expr: "obj.runtime_event_runtime_container_id", want: types.String("inner")},
+		{expr: "obj.pid", want: types.Int(42)},
+		{expr: "obj.flow_source_host", want: types.String("10.0.0.1")},
+		{expr: "obj.flow_destination_host", want: types.String("10.0.0.2")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, record, test.expr, report)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out.Equal(test.want) != types.True {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+
+	renames = nil
+	obj, _ := xcel.NewObject(record)
+	fields := xcel.NewFields(obj, report)
+
+	if _, ok := fields["host"]; ok {
+		t.Fatal("expected the colliding 'host' fields to be renamed")
+	}
+
+	sort.Slice(renames, func(i, j int) bool { return renames[i].Path < renames[j].Path })
+
+	want := []xcel.FieldRename{
+		{Path: "FlowDestination.Host", Name: "host", Renamed: "flow_destination_host"},
+		{Path: "FlowSource.Host", Name: "host", Renamed: "flow_source_host"},
+		{Path: "RuntimeEvent.Runtime.ContainerID", Name: "container_id", Renamed: "runtime_event_runtime_container_id"},
+	}
+	if !reflect.DeepEqual(renames, want) {
+		t.Fatalf("expected renames %+v but got %+v", want, renames)
+	}
+}
+
+type TenantRuntime struct {
+	ContainerID string
+	Image       string
+}
+
+type TenantEvent struct {
+	Name    string
+	Age     int
+	Blob    []byte
+	Parent  *TenantEvent
+	Runtime TenantRuntime
+}
+
+func TestFieldsIncludeExclude(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []xcel.Option
+		compiles  []string
+		undefined []string
+	}{
+		{
+			name:      "include",
+			opts:      []xcel.Option{xcel.WithIncludeFields("name", "age", "runtime.container_id")},
+			compiles:  []string{"obj.name", "obj.age", "obj.runtime.container_id"},
+			undefined: []string{"obj.blob", "obj.parent", "obj.runtime.image"},
+		},
+		{
+			name:      "exclude",
+			opts:      []xcel.Option{xcel.WithExcludeFields("blob", "parent")},
+			compiles:  []string{"obj.name", "obj.runtime.image"},
+			undefined: []string{"obj.blob", "obj.parent"},
+		},
+		{
+			name: "include object excluding field",
+			opts: []xcel.Option{
+				xcel.WithIncludeFields("name", "runtime"),
+				xcel.WithExcludeFields("runtime.image"),
+			},
+			compiles:  []string{"obj.name", "obj.runtime.container_id"},
+			undefined: []string{"obj.age", "obj.runtime.image"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+			obj, typ := xcel.NewObject(&TenantEvent{})
+			xcel.RegisterObject(ta, tp, obj, typ, xcel.NewFields(obj, test.opts...))
+
+			env, err := cel.NewEnv(
+				cel.Variable("obj", typ),
+				cel.CustomTypeAdapter(ta),
+				cel.CustomTypeProvider(tp),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			for _, expr := range test.compiles {
+				if _, iss := env.Compile(expr); iss.Err() != nil {
+					t.Fatalf("failed to compile CEL expression %q: %v", expr, iss.Err())
+				}
+			}
+
+			for _, expr := range test.undefined {
+				_, iss := env.Compile(expr)
+				if iss.Err() == nil || !strings.Contains(iss.Err().Error(), "undefined field") {
+					t.Fatalf("expected %q to be an undefined field, got: %v", expr, iss.Err())
+				}
+			}
+		})
+	}
+
+	obj, _ := xcel.NewObject(&TenantEvent{})
+	_, err := xcel.NewFieldsE(obj,
+		xcel.WithIncludeFields("name", "runtime.container_ip"),
+		xcel.WithExcludeFields("name", "blobs"),
+	)
+	for _, want := range []string{
+		"xcel: field 'name' is both included and excluded",
+		"xcel: unknown included field 'runtime.container_ip'",
+		"xcel: unknown excluded field 'blobs'",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected error to contain %q, got: %v", want, err)
+		}
+	}
+}
+
+type ManagedWorkload struct {
+	ObjectMetadata
+	Spec *WorkloadSpec
+}
+
+func TestFieldsMaxDepth(t *testing.T) {
+	tests := []struct {
+		depth     int
+		compiles  []string
+		undefined []string
+		truncated []string
+	}{
+		{
+			depth:     1,
+			compiles:  []string{"obj.name", "obj.labels"},
+			undefined: []string{"obj.spec"},
+			truncated: []string{"Spec"},
+		},
+		{
+			// Promoted fields are on the level of the object.
+			depth:     2,
+			compiles:  []string{"obj.name", "obj.spec.replicas"},
+			undefined: []string{"obj.spec.template"},
+			truncated: []string{"Template"},
+		},
+		{
+			depth:    4,
+			compiles: []string{"obj.spec.template.metadata.name"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.depth), func(t *testing.T) {
+			ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+			var truncated []string
+			report := xcel.WithSkippedFields(func(f xcel.SkippedField) {
+				if f.Truncated {
+					truncated = append(truncated, f.Path)
+				}
+			})
+
+			obj, typ := xcel.NewObject(&ManagedWorkload{})
+			xcel.RegisterObject(ta, tp, obj, typ, xcel.NewFields(obj, xcel.WithMaxDepth(test.depth), report))
+
+			if !reflect.DeepEqual(truncated, test.truncated) {
+				t.Fatalf("expected truncated fields %q but got %q", test.truncated, truncated)
+			}
+
+			env, err := cel.NewEnv(
+				cel.Variable("obj", typ),
+				cel.CustomTypeAdapter(ta),
+				cel.CustomTypeProvider(tp),
+			)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			for _, expr := range test.compiles {
+				if _, iss := env.Compile(expr); iss.Err() != nil {
+					t.Fatalf("failed to compile CEL expression %q: %v", expr, iss.Err())
+				}
+			}
+
+			for _, expr := range test.undefined {
+				_, iss := env.Compile(expr)
+				if iss.Err() == nil || !strings.Contains(iss.Err().Error(), "undefined field") {
+					t.Fatalf("expected %q to be an undefined field, got: %v", expr, iss.Err())
+				}
+			}
+		})
+	}
+
+	// Nested object types beyond the limit are not registered.
+	tp := xcel.NewTypeProvider()
+	obj, typ := xcel.NewObject(&ManagedWorkload{})
+	xcel.RegisterObject(xcel.NewTypeAdapter(), tp, obj, typ, xcel.NewFields(obj, xcel.WithMaxDepth(2)))
+
+	_, templateType := xcel.NewObject(&PodTemplate{})
+	if _, ok := tp.FindStructType(templateType.TypeName()); ok {
+		t.Fatalf("expected '%s' not to be registered", templateType.TypeName())
+	}
+}
+
+func ExampleWithPresence() {
+	type Person struct {
+		Name string
+		Age  int
+	}
+
+	for _, policy := range []xcel.PresencePolicy{xcel.PresenceNonNil, xcel.PresenceNonZero} {
+		ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+		obj, typ := xcel.NewObject(&Person{Age: 30})
+		xcel.RegisterObject(ta, tp, obj, typ, xcel.NewFields(obj, xcel.WithPresence(policy)))
+
+		env, _ := cel.NewEnv(
+			cel.Variable("obj", typ),
+			cel.CustomTypeAdapter(ta),
+			cel.CustomTypeProvider(tp),
+		)
+
+		ast, _ := env.Compile("[has(obj.name), has(obj.age)]")
+
+		prg, _ := env.Program(ast)
+
+		out, _, _ := prg.Eval(map[string]any{"obj": obj})
+
+		fmt.Println(out)
+	}
+	// Output:
+	// [true, true]
+	// [false, true]
+}
+
+type PresenceBase struct {
+	Node string
+}
+
+type PresenceEvent struct {
+	PresenceBase
+	Name    string
+	Age     int
+	Labels  map[string]string
+	Created time.Time
+	Parent  *PresenceEvent
+}
+
+func TestFieldsPresencePolicies(t *testing.T) {
+	event := &PresenceEvent{Age: -1, Labels: map[string]string{}, Parent: &PresenceEvent{}}
+
+	// A hand-written convention, where negative ages are unknown.
+	sentinels := xcel.WithPresenceFunc(func(v reflect.Value, sf reflect.StructField) bool {
+		if sf.Name == "Age" {
+			return v.Int() >= 0
+		}
+		return !v.IsZero()
+	})
+
+	tests := []struct {
+		name string
+		opt  xcel.Option
+		want []bool
+	}{
+		{name: "non-nil", opt: xcel.WithPresence(xcel.PresenceNonNil), want: []bool{true, true, true, true, true, true}},
+		{name: "non-zero", opt: xcel.WithPresence(xcel.PresenceNonZero), want: []bool{false, false, true, true, false, true}},
+		{name: "func", opt: sentinels, want: []bool{false, false, false, true, false, true}},
+	}
+
+	expr := "[has(obj.node), has(obj.name), has(obj.age), has(obj.labels), has(obj.created), has(obj.parent)]"
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := evalFields(t, event, expr, test.opt)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			want := types.NewDynamicList(types.DefaultTypeAdapter, test.want)
+			if out.Equal(want) != types.True {
+				t.Fatalf("expected '%v' but got '%v'", want, out)
+			}
+		})
+	}
+}
+
+type SentinelRecord struct {
+	Age     int     `cel:"age,unsetif=-1"`
+	TTL     int64   `cel:",nonzero"`
+	Port    *uint16 `cel:",unsetif=0"`
+	Ratio   float64 `cel:",unsetif=-1.5"`
+	Status  string  `cel:",unsetif=unknown"`
+	Enabled bool    `cel:",nonzero"`
+}
+
+type BadSentinel struct {
+	Age int `cel:",unsetif=old"`
+}
+
+type MissingSentinel struct {
+	Age int `cel:",unsetif"`
+}
+
+type UnsupportedSentinel struct {
+	Tags []string `cel:",unsetif=none"`
+}
+
+func TestFieldsUnsetIf(t *testing.T) {
+	port := uint16(0)
+
+	tests := []struct {
+		value *SentinelRecord
+		want  []bool
+	}{
+		{
+			value: &SentinelRecord{Age: -1, Port: &port, Ratio: -1.5, Status: "unknown"},
+			want:  []bool{false, false, false, false, false, false},
+		},
+		{
+			value: &SentinelRecord{Age: 0, TTL: 30, Ratio: 0.5, Status: "ready", Enabled: true},
+			want:  []bool{true, true, false, true, true, true},
+		},
+	}
+
+	expr := "[has(obj.age), has(obj.ttl), has(obj.port), has(obj.ratio), has(obj.status), has(obj.enabled)]"
+
+	for _, test := range tests {
+		out, err := evalFields(t, test.value, expr)
+		if err != nil {
+			t.Fatalf("failed to evaluate program: %v", err)
+		}
+
+		want := types.NewDynamicList(types.DefaultTypeAdapter, test.want)
+		if out.Equal(want) != types.True {
+			t.Fatalf("expected '%v' but got '%v'", want, out)
+		}
+	}
+
+	for _, test := range []struct {
+		value any
+		err   string
+	}{
+		{&BadSentinel{}, "invalid unsetif sentinel 'old' of field 'Age' of type 'int'"},
+		{&MissingSentinel{}, "unsetif option of field 'Age' requires a sentinel"},
+		{&UnsupportedSentinel{}, "unsetif sentinel of field 'Tags' requires an int, uint, float, bool, or string type"},
+	} {
+		err := xcel.RegisterAll(xcel.NewRegistry(), []any{test.value})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("expected error %q but got '%v'", test.err, err)
+		}
+	}
+}
+
+type TaggedResource struct {
+	Name   string
+	Tags   []string
+	Labels map[string]string
+}
+
+func TestFieldsEmptyCollectionsUnset(t *testing.T) {
+	empty := &TaggedResource{Tags: []string{}, Labels: map[string]string{}}
+
+	tests := []struct {
+		expr string
+		opts []xcel.Option
+		want ref.Val
+	}{
+		// By default, only nil collections are unset.
+		{expr: "has(obj.tags) && has(obj.labels) && has(obj.name)", want: types.True},
+		{expr: "has(obj.tags) || has(obj.labels) || has(obj.name)", opts: []xcel.Option{xcel.WithEmptyCollectionsUnset()}, want: types.False},
+		// Selecting an unset empty collection still returns it.
+		{expr: "'x' in obj.tags", opts: []xcel.Option{xcel.WithEmptyCollectionsUnset()}, want: types.False},
+		{expr: "size(obj.labels) == 0 && obj.name == ''", opts: []xcel.Option{xcel.WithEmptyCollectionsUnset()}, want: types.True},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, empty, test.expr, test.opts...)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out.Equal(test.want) != types.True {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+
+	out, err := evalFields(t, &TaggedResource{Tags: []string{"x"}}, "has(obj.tags) && 'x' in obj.tags", xcel.WithEmptyCollectionsUnset())
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+}
+
+type LimitSettings struct {
+	CPU    int64
+	Memory int64
+}
+
+type CycleNode struct {
+	Next *CycleNode
+	Name string
+}
+
+type ValidatedConfig struct {
+	*LimitSettings
+	Limits    LimitSettings
+	Overrides *LimitSettings
+	Deadline  time.Time
+	Chain     *CycleNode
+}
+
+func TestFieldsDeepStructPresence(t *testing.T) {
+	cycle := &CycleNode{}
+	cycle.Next = cycle
+
+	config := &ValidatedConfig{
+		LimitSettings: &LimitSettings{},
+		Overrides:     &LimitSettings{Memory: 512},
+		Chain:         cycle,
+	}
+
+	expr := "[has(obj.limit_settings), has(obj.limits), has(obj.overrides), has(obj.deadline), has(obj.chain)]"
+
+	tests := []struct {
+		name string
+		opts []xcel.Option
+		want []bool
+	}{
+		{
+			name: "shallow",
+			opts: []xcel.Option{xcel.WithPresence(xcel.PresenceNonZero), xcel.WithEmbeddedTypePaths()},
+			want: []bool{true, false, true, false, true},
+		},
+		{
+			name: "deep",
+			opts: []xcel.Option{xcel.WithPresence(xcel.PresenceNonZero), xcel.WithEmbeddedTypePaths(), xcel.WithDeepStructPresence()},
+			want: []bool{false, false, true, false, false},
+		},
+		{
+			// Without a policy making scalars unset, structs of
+			// scalars are always set.
+			name: "deep non-nil",
+			opts: []xcel.Option{xcel.WithEmbeddedTypePaths(), xcel.WithDeepStructPresence()},
+			want: []bool{true, true, true, true, true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := evalFields(t, config, expr, test.opts...)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			want := types.NewDynamicList(types.DefaultTypeAdapter, test.want)
+			if out.Equal(want) != types.True {
+				t.Fatalf("expected '%v' but got '%v'", want, out)
+			}
+		})
+	}
+
+	config.Limits.CPU = 2
+	config.Chain.Name = "head"
+
+	out, err := evalFields(t, config, "has(obj.limits) && has(obj.chain)", xcel.WithPresence(xcel.PresenceNonZero), xcel.WithDeepStructPresence())
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+}
+
+type ProbeSettings struct {
+	Timeout   time.Duration `cel:",nonzero,default=30s"`
+	Retries   *int          `cel:",default=3"`
+	Threshold *uint         `cel:",default=0x10"`
+	Ratio     float64       `cel:",unsetif=-1,default=0.5"`
+	Verbose   *bool         `cel:",default=true"`
+	Mode      string        `cel:",omitempty,default=strict"`
+	Since     *time.Time    `cel:",default=2024-01-02T03:04:05Z"`
+}
+
+type BadDefault struct {
+	Retries int `cel:",nonzero,default=three"`
+}
+
+type UnsupportedDefault struct {
+	Tags []string `cel:",default=a"`
+}
+
+func TestFieldsDefaults(t *testing.T) {
+	probe := &ProbeSettings{Ratio: -1}
+
+	tests := []struct {
+		expr string
+		want ref.Val
+	}{
+		{expr: "obj.timeout == duration('30s')", want: types.True},
+		{expr: "obj.retries == 3 && obj.threshold == 16u", want: types.True},
+		{expr: "obj.ratio == 0.5 && obj.verbose && obj.mode == 'strict'", want: types.True},
+		{expr: "obj.since == timestamp('2024-01-02T03:04:05Z')", want: types.True},
+		// Defaults are not presence.
+		{expr: "has(obj.timeout) || has(obj.retries) || has(obj.mode)", want: types.False},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, probe, test.expr)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out.Equal(test.want) != types.True {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+
+	retries := 5
+	out, err := evalFields(t, &ProbeSettings{Timeout: time.Second, Retries: &retries}, "obj.timeout == duration('1s') && obj.retries == 5")
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+	if out != types.True {
+		t.Fatalf("expected set fields to ignore their defaults, got '%v'", out)
+	}
+
+	for _, test := range []struct {
+		value any
+		err   string
+	}{
+		{&BadDefault{}, "invalid default 'three' of field 'Retries' of type 'int'"},
+		{&UnsupportedDefault{}, "default of field 'Tags' is not supported for type 'list(string)'"},
+	} {
+		err := xcel.RegisterAll(xcel.NewRegistry(), []any{test.value})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("expected error %q but got '%v'", test.err, err)
+		}
+	}
+}
+
+type Named interface {
+	Title() string
+}
+
+type Leaf struct {
+	Name string
+}
+
+func (l *Leaf) Title() string { return l.Name }
+
+type Decorated struct {
+	Named
+	Tag string
+}
+
+func TestFieldsSelfReferencingEmbeddedInterface(t *testing.T) {
+	decorated := &Decorated{Tag: "outer"}
+	decorated.Named = decorated
+
+	obj, _ := xcel.NewObject(decorated)
+	if _, err := xcel.NewFieldsE(obj); err != nil {
+		t.Fatalf("failed to derive fields: %v", err)
+	}
+
+	out, err := evalFields(t, decorated, "obj.tag == 'outer'")
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+}
+
+func TestFieldsDecoratorImplementation(t *testing.T) {
+	impls := xcel.WithImplementations((*Leaf)(nil), (*Decorated)(nil))
+
+	obj, _ := xcel.NewObject(&Decorated{})
+	fields, err := xcel.NewFieldsE(obj, impls)
+	if err != nil {
+		t.Fatalf("failed to derive fields: %v", err)
+	}
+
+	for _, name := range []string{"name", "tag"} {
+		if _, ok := fields[name]; !ok {
+			t.Fatalf("expected field %q, got %v", name, fields)
+		}
+	}
+
+	out, err := evalFields(t, &Decorated{Named: &Leaf{Name: "leaf"}, Tag: "outer"}, "obj.name == 'leaf' && obj.tag == 'outer'", impls)
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+}
@@ -0,0 +1,148 @@
+package xcel
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// Method describes a member function of a registered object type, such as
+// obj.fn(1), declared with MemberFunctions.
+type Method struct {
+	// Name is the name of the function in expressions.
+	Name string
+
+	// Receiver is the type of the object the function is called on.
+	Receiver *types.Type
+
+	// Args are the types of the arguments after the receiver.
+	Args []*types.Type
+
+	// Result is the type of the function result.
+	Result *types.Type
+
+	// Impl implements the function, called with the receiver followed by
+	// the arguments.
+	Impl func(args ...ref.Val) ref.Val
+}
+
+// OverloadID returns the overload ID for the method, which is derived from
+// the function name, receiver type, and argument types. It is stable across
+// processes and releases, so it can be persisted in checked expressions,
+// and it differs for the same method name on different receiver types.
+func (m Method) OverloadID() string {
+	h := sha256.Sum256([]byte(m.signature()))
+	return fmt.Sprintf("xcel_%s_%s", m.Name, hex.EncodeToString(h[:8]))
+}
+
+// signature returns the method signature, such as "Example.fn(int)".
+func (m Method) signature() string {
+	args := make([]string, len(m.Args))
+	for i, arg := range m.Args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s.%s(%s)", m.Receiver, m.Name, strings.Join(args, ", "))
+}
+
+// MemberFunctions returns a CEL environment option declaring the methods as
+// member functions. Creating an environment with the option fails if more
+// than one method has the same name, receiver, and argument types.
+func MemberFunctions(methods ...Method) cel.EnvOption {
+	return func(e *cel.Env) (*cel.Env, error) {
+		seen := map[string]bool{}
+		overloads := map[string][]cel.FunctionOpt{}
+
+		var names []string
+		for _, m := range methods {
+			id := m.OverloadID()
+			if seen[id] {
+				return nil, fmt.Errorf("xcel: duplicate member function %s", m.signature())
+			}
+			seen[id] = true
+
+			if _, ok := overloads[m.Name]; !ok {
+				names = append(names, m.Name)
+			}
+
+			overloads[m.Name] = append(overloads[m.Name], cel.MemberOverload(
+				id,
+				append([]*types.Type{m.Receiver}, m.Args...),
+				m.Result,
+				cel.FunctionBinding(m.Impl),
+			))
+		}
+
+		opts := make([]cel.EnvOption, 0, len(names))
+		for _, name := range names {
+			opts = append(opts, cel.Function(name, overloads[name]...))
+		}
+
+		return cel.Lib(library(opts))(e)
+	}
+}
+
+// FieldFunctions returns a CEL environment option declaring member functions
+// to inspect the presence of the fields of registered objects:
+//
+//	obj.fields() -> map(string, bool)  // each field name mapped to whether it is set
+//	obj.set_fields() -> list(string)   // the sorted names of the set fields
+//
+// The functions are declared for the given object types, or for every type
+// registered with the type provider if none are given. They use the same
+// IsSet functions as has(), so fields which are not registered are not
+// included.
+func FieldFunctions(tp *TypeProvider, objTypes ...*types.Type) cel.EnvOption {
+	if len(objTypes) == 0 {
+		names := make([]string, 0, len(tp.Types))
+		for name := range tp.Types {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			objTypes = append(objTypes, tp.Types[name])
+		}
+	}
+
+	methods := make([]Method, 0, 2*len(objTypes))
+	for _, t := range objTypes {
+		methods = append(methods,
+			Method{
+				Name:     "fields",
+				Receiver: t,
+				Result:   types.NewMapType(types.StringType, types.BoolType),
+				Impl: func(args ...ref.Val) ref.Val {
+					fields := tp.StructFieldTypes[args[0].Type().TypeName()]
+					m := make(map[string]bool, len(fields))
+					for _, name := range sortedFieldNames(fields) {
+						m[name] = fields[name].IsSet(args[0].Value())
+					}
+					return types.DefaultTypeAdapter.NativeToValue(m)
+				},
+			},
+			Method{
+				Name:     "set_fields",
+				Receiver: t,
+				Result:   types.NewListType(types.StringType),
+				Impl: func(args ...ref.Val) ref.Val {
+					fields := tp.StructFieldTypes[args[0].Type().TypeName()]
+					var names []string
+					for _, name := range sortedFieldNames(fields) {
+						if fields[name].IsSet(args[0].Value()) {
+							names = append(names, name)
+						}
+					}
+					return types.NewStringList(types.DefaultTypeAdapter, names)
+				},
+			},
+		)
+	}
+
+	return MemberFunctions(methods...)
+}
@@ -0,0 +1,127 @@
+package xcel_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/picatz/xcel"
+)
+
+func TestMemberFunctions(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	ex, exType := xcel.NewObject(&Example{
+		Fn: func(i int) string {
+			return fmt.Sprintf("~%d~", i)
+		},
+	})
+	xcel.RegisterObject(ta, tp, ex, exType, xcel.NewFields(ex))
+
+	person, personType := xcel.NewObject(&Person{Name: "test"})
+	xcel.RegisterObject(ta, tp, person, personType, personFields())
+
+	exFn := xcel.Method{
+		Name:     "fn",
+		Receiver: exType,
+		Args:     []*types.Type{types.IntType},
+		Result:   types.StringType,
+		Impl: func(args ...ref.Val) ref.Val {
+			x := args[0].(*xcel.Object[*Example])
+			return types.String(x.Raw.Fn(int(args[1].(types.Int))))
+		},
+	}
+
+	personFn := xcel.Method{
+		Name:     "fn",
+		Receiver: personType,
+		Args:     []*types.Type{types.IntType},
+		Result:   types.StringType,
+		Impl: func(args ...ref.Val) ref.Val {
+			x := args[0].(*xcel.Object[*Person])
+			return types.String(fmt.Sprintf("%s-%d", x.Raw.Name, args[1].(types.Int)))
+		},
+	}
+
+	if exFn.OverloadID() == personFn.OverloadID() {
+		t.Fatalf("expected distinct overload IDs, got %q", exFn.OverloadID())
+	}
+
+	if exFn.OverloadID() != (xcel.Method{Name: "fn", Receiver: exType, Args: []*types.Type{types.IntType}}).OverloadID() {
+		t.Fatal("expected overload ID to only depend on the signature")
+	}
+
+	env, err := cel.NewEnv(
+		cel.Variable("ex", exType),
+		cel.Variable("person", personType),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+		xcel.MemberFunctions(exFn, personFn),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("ex.fn(1) == '~1~' && person.fn(2) == 'test-2'")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	out, _, err := prg.Eval(map[string]any{"ex": ex, "person": person})
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+
+	_, err = cel.NewEnv(xcel.MemberFunctions(exFn, personFn, exFn))
+	if err == nil || !strings.Contains(err.Error(), "duplicate member function") {
+		t.Fatalf("expected duplicate member function error, got: %v", err)
+	}
+}
+
+func TestFieldFunctions(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	obj, typ := xcel.NewObject(&Person{Name: "test", Age: -1})
+	xcel.RegisterObject(ta, tp, obj, typ, personFields())
+
+	env, err := cel.NewEnv(
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+		xcel.FieldFunctions(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("obj.fields() == {'name': true, 'age': false} && obj.set_fields() == ['name']")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	out, _, err := prg.Eval(map[string]any{"obj": obj})
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+}
@@ -0,0 +1,72 @@
+package xcel
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// HashFunctions returns a CEL environment option declaring hash functions
+// over bytes and strings, each returning the lower case hex digest:
+//
+//	sha256(bytes|string) -> string
+//	sha1(bytes|string) -> string
+//	md5(bytes|string) -> string
+//
+// Use WithMaxHashSize to refuse hashing values larger than a number of bytes.
+// Other options are reported as an error when the environment is created.
+func HashFunctions(opts ...Option) cel.EnvOption {
+	o := newOptions(opts...)
+	if err := o.check("HashFunctions", hashScope); err != nil {
+		return func(*cel.Env) (*cel.Env, error) {
+			return nil, err
+		}
+	}
+
+	return cel.Lib(library{
+		hashFunction("sha256", sha256.New, o.maxHashSize),
+		hashFunction("sha1", sha1.New, o.maxHashSize),
+		hashFunction("md5", md5.New, o.maxHashSize),
+	})
+}
+
+// hashFunction declares a hash function with bytes and string overloads.
+func hashFunction(name string, newHash func() hash.Hash, maxSize int) cel.EnvOption {
+	binding := cel.UnaryBinding(func(arg ref.Val) ref.Val {
+		// The size is checked before strings are copied to bytes, so
+		// oversized strings are never copied.
+		var size int
+		switch arg := arg.(type) {
+		case types.Bytes:
+			size = len(arg)
+		case types.String:
+			size = len(arg)
+		default:
+			return types.MaybeNoSuchOverloadErr(arg)
+		}
+
+		if maxSize > 0 && size > maxSize {
+			return types.NewErr("xcel: %s input of %d bytes exceeds the maximum size of %d bytes", name, size, maxSize)
+		}
+
+		h := newHash()
+		switch arg := arg.(type) {
+		case types.Bytes:
+			h.Write(arg)
+		case types.String:
+			h.Write([]byte(arg))
+		}
+		return types.String(hex.EncodeToString(h.Sum(nil)))
+	})
+
+	return cel.Function(name,
+		cel.Overload(name+"_bytes", []*cel.Type{cel.BytesType}, cel.StringType, binding),
+		cel.Overload(name+"_string", []*cel.Type{cel.StringType}, cel.StringType, binding),
+	)
+}
@@ -0,0 +1,97 @@
+package xcel_test
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+func TestHashFunctions(t *testing.T) {
+	env, err := cel.NewEnv(
+		cel.Variable("blob", cel.BytesType),
+		xcel.HashFunctions(xcel.WithMaxHashSize(8)),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	tests := map[string]types.String{
+		`sha256('test')`: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		`sha256(blob)`:   "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		`sha1('test')`:   "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3",
+		`sha1(blob)`:     "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3",
+		`md5('test')`:    "098f6bcd4621d373cade4e832627b4f6",
+		`md5(blob)`:      "098f6bcd4621d373cade4e832627b4f6",
+	}
+
+	eval := func(expr string, blob []byte) (any, error) {
+		ast, iss := env.Compile(expr)
+		if iss.Err() != nil {
+			t.Fatalf("failed to compile %q: %v", expr, iss.Err())
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		out, _, err := prg.Eval(map[string]any{"blob": blob})
+		return out, err
+	}
+
+	for expr, want := range tests {
+		out, err := eval(expr, []byte("test"))
+		if err != nil {
+			t.Fatalf("failed to evaluate %q: %v", expr, err)
+		}
+		if out != want {
+			t.Errorf("expected %v for %q but got '%v'", want, expr, out)
+		}
+	}
+
+	_, err = eval(`sha256(blob)`, []byte("too large to hash"))
+	if err == nil || !strings.Contains(err.Error(), "exceeds the maximum size") {
+		t.Fatalf("expected size limit error, got: %v", err)
+	}
+}
+
+func TestHashFunctionsOversizedString(t *testing.T) {
+	env, err := cel.NewEnv(
+		cel.Variable("text", cel.StringType),
+		xcel.HashFunctions(xcel.WithMaxHashSize(8)),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile(`sha256(text)`)
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	vars := map[string]any{"text": strings.Repeat("a", 1<<20)}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < 10; i++ {
+		_, _, err = prg.Eval(vars)
+		if err == nil || !strings.Contains(err.Error(), "sha256 input of 1048576 bytes exceeds the maximum size of 8 bytes") {
+			t.Fatalf("expected size limit error, got: %v", err)
+		}
+	}
+	runtime.ReadMemStats(&after)
+
+	// Copying the string to bytes would allocate at least 10 MiB.
+	if n := after.TotalAlloc - before.TotalAlloc; n >= 1<<20 {
+		t.Fatalf("expected oversized strings not to be copied, but %d bytes were allocated", n)
+	}
+}
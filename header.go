@@ -0,0 +1,68 @@
+package xcel
+
+import (
+	"net/textproto"
+	"sort"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+)
+
+// HeaderFunctions returns a CEL environment option declaring a function
+// looking up HTTP header values, such as those of an http.Header field:
+//
+//	header(map(string, list(string)), string) -> list(string)
+//
+// Unlike indexing the map, which matches keys exactly, header matches keys
+// by their canonical form, so header(obj.headers, 'x-forwarded-for') finds
+// the values of "X-Forwarded-For". The values of all matching keys are
+// returned, or an empty list if there are none.
+func HeaderFunctions() cel.EnvOption {
+	return cel.Lib(library{
+		cel.Function("header",
+			cel.Overload("header_map_string",
+				[]*cel.Type{cel.MapType(cel.StringType, cel.ListType(cel.StringType)), cel.StringType},
+				cel.ListType(cel.StringType),
+				cel.BinaryBinding(func(lhs, rhs ref.Val) ref.Val {
+					m, ok := lhs.(traits.Mapper)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(lhs)
+					}
+					name, ok := rhs.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(rhs)
+					}
+					return headerValues(m, string(name))
+				}),
+			),
+		),
+	})
+}
+
+// headerValues returns the values of the keys of the map matching the
+// header name by their canonical form, in key order.
+func headerValues(m traits.Mapper, name string) ref.Val {
+	name = textproto.CanonicalMIMEHeaderKey(name)
+
+	var keys []string
+	for it := m.Iterator(); it.HasNext() == types.True; {
+		if k, ok := it.Next().(types.String); ok && textproto.CanonicalMIMEHeaderKey(string(k)) == name {
+			keys = append(keys, string(k))
+		}
+	}
+	sort.Strings(keys)
+
+	var values []ref.Val
+	for _, k := range keys {
+		list, ok := m.Get(types.String(k)).(traits.Lister)
+		if !ok {
+			return types.MaybeNoSuchOverloadErr(m.Get(types.String(k)))
+		}
+		for it := list.Iterator(); it.HasNext() == types.True; {
+			values = append(values, it.Next())
+		}
+	}
+	return types.NewRefValList(types.DefaultTypeAdapter, values)
+}
@@ -0,0 +1,56 @@
+package xcel_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+func TestHeaderFunctions(t *testing.T) {
+	env, err := cel.NewEnv(
+		xcel.HeaderFunctions(),
+		cel.Variable("headers", cel.MapType(cel.StringType, cel.ListType(cel.StringType))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	headers := http.Header{
+		"X-Forwarded-For": {"10.0.0.1", "10.0.0.2"},
+		"Content-Type":    {"application/json"},
+		"x-request-id":    {"b"},
+		"X-Request-Id":    {"a"},
+	}
+
+	tests := map[string]types.Bool{
+		`header(headers, 'content-type') == ['application/json']`: true,
+		`header(headers, 'X-FORWARDED-FOR').size() == 2`:          true,
+		`header(headers, 'X-Request-ID') == ['a', 'b']`:           true,
+		`header(headers, 'Authorization') == []`:                  true,
+		`header({}, 'Authorization') == []`:                       true,
+	}
+
+	for expr, want := range tests {
+		ast, iss := env.Compile(expr)
+		if iss.Err() != nil {
+			t.Fatalf("failed to compile %q: %v", expr, iss.Err())
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		out, _, err := prg.Eval(map[string]any{"headers": headers})
+		if err != nil {
+			t.Fatalf("failed to evaluate %q: %v", expr, err)
+		}
+
+		if out != want {
+			t.Errorf("expected %v for %q but got '%v'", want, expr, out)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package xcel
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/cel-go/common/types"
+)
+
+// JSONDriftError reports the differences between a JSON document and the
+// fields derived for the Go type it was decoded into, see FromJSON.
+type JSONDriftError struct {
+	// Type is the CEL type name of the Go type.
+	Type string
+
+	// Issues describe each difference, such as a field whose key is
+	// missing from the document, in field order followed by the keys of
+	// the document without a field in key order.
+	Issues []string
+}
+
+// Error implements the error interface.
+func (e *JSONDriftError) Error() string {
+	return fmt.Sprintf("xcel: JSON does not match the fields of '%s': %s", e.Type, strings.Join(e.Issues, "; "))
+}
+
+// FromJSON decodes the JSON object into a new value of the Go struct pointer
+// type T with encoding/json, and returns it wrapped as an object with its
+// fields derived with NewFields, such as for evaluating rules against JSON
+// fixtures with T registered by Quickstart or RegisterAll.
+//
+// The fields are validated against the top-level keys of the document,
+// except for fields excluded with `json:"-"`. If the key of a field is
+// missing, so the field is unset or zero, if a key has no field, so its
+// value is dropped, or if a field cannot be used in expressions as decoded,
+// such as a map[string]any or a json.RawMessage, the object is returned
+// along with a *JSONDriftError describing each of them, so tests fail
+// loudly when fixtures and types drift apart.
+func FromJSON[T any](data []byte, opts ...Option) (*Object[T], error) {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	if rt.Kind() != reflect.Pointer || rt.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("xcel: unsupported JSON type '%s', expected a struct pointer", rt)
+	}
+	if err := newOptions(opts...).check("FromJSON", fieldScope); err != nil {
+		return nil, err
+	}
+
+	v := reflect.New(rt.Elem())
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return nil, fmt.Errorf("xcel: failed to decode JSON into '%s': %w", rt, err)
+	}
+
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("xcel: failed to decode JSON into '%s': %w", rt, err)
+	}
+
+	obj, typ := NewObject(v.Interface().(T), opts...)
+	obj.fields = NewFields(obj, opts...)
+
+	objectTypes := map[string]bool{typ.TypeName(): true}
+	for _, n := range obj.nested {
+		objectTypes[n.typ.TypeName()] = true
+	}
+
+	o := newOptions(opts...)
+
+	var issues []string
+	matched := map[string]bool{}
+
+	// match marks the keys of the document matching the field's key, and
+	// reports whether there are any.
+	match := func(key string) bool {
+		found := false
+		for k := range keys {
+			if strings.EqualFold(k, key) {
+				matched[k], found = true, true
+			}
+		}
+		return found
+	}
+
+	for _, pf := range promotedFields(rt, v, o.impls) {
+		sf := pf.StructField
+		if !sf.IsExported() || sf.Anonymous && isStructType(sf.Type) {
+			continue
+		}
+
+		if pf.excluded {
+			// Fields excluded with `cel:"-"` are decoded, but not
+			// required to be in the document.
+			if key, ok := jsonKey(sf); ok {
+				match(key)
+			}
+			continue
+		}
+
+		goPath := make([]string, len(pf.path))
+		for i, step := range pf.path {
+			goPath[i] = step.name
+		}
+
+		name := o.fieldName(goPath, sf)
+
+		field, ok := obj.fields[name]
+		if !ok {
+			continue
+		}
+
+		key, ok := jsonKey(sf)
+		if !ok {
+			continue
+		}
+
+		if !match(key) {
+			issues = append(issues, fmt.Sprintf("field '%s' is missing key '%s'", name, key))
+		}
+
+		switch {
+		case sf.Type == jsonRawMessageType && field.Type != types.DynType:
+			issues = append(issues, fmt.Sprintf("field '%s' is raw JSON exposed as bytes", name))
+		case field.Type.Kind() == types.StructKind && !objectTypes[field.Type.TypeName()]:
+			issues = append(issues, fmt.Sprintf("field '%s' of type '%s' cannot be used in expressions", name, sf.Type))
+		}
+	}
+
+	var unknown []string
+	for k := range keys {
+		if !matched[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		issues = append(issues, fmt.Sprintf("key '%s' has no field", k))
+	}
+
+	if len(issues) > 0 {
+		return obj, &JSONDriftError{Type: typ.TypeName(), Issues: issues}
+	}
+
+	return obj, nil
+}
+
+// jsonRawMessageType is the reflect type of json.RawMessage.
+var jsonRawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+// WithParsedJSON makes json.RawMessage fields derived with NewFields dyn
+// values parsed from the JSON document when they are accessed, such as
+// obj.payload.kind, instead of bytes. Fields can also opt in individually
+// with the `cel:",json"` tag. Objects become maps, arrays lists, and
+// numbers doubles, like google.protobuf.Struct values, and a document
+// which fails to parse is an error when the field is accessed.
+func WithParsedJSON() Option {
+	return option("WithParsedJSON", fieldScope, func(o *options) {
+		o.parsedJSON = true
+	})
+}
+
+// parseJSONField converts a json.RawMessage field into the value of the
+// JSON document it holds.
+func parseJSONField(v reflect.Value) (any, error) {
+	var doc any
+	if err := json.Unmarshal(v.Bytes(), &doc); err != nil {
+		return nil, fmt.Errorf("xcel: invalid JSON: %w", err)
+	}
+	if doc == nil {
+		return types.NullValue, nil
+	}
+	return doc, nil
+}
+
+// jsonKey returns the key encoding/json uses for the struct field, or false
+// if the field is excluded with `json:"-"`.
+func jsonKey(sf reflect.StructField) (string, bool) {
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name, true
+	}
+	return sf.Name, true
+}
@@ -0,0 +1,144 @@
+package xcel_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+type LoginEvent struct {
+	User    string `json:"user"`
+	Success bool   `json:"success"`
+	Source  string `json:"source_ip,omitempty"`
+	Debug   string `json:"-"`
+}
+
+type AuditEvent struct {
+	Payload json.RawMessage
+	Extra   json.RawMessage `cel:",json"`
+}
+
+type WebhookEvent struct {
+	ID      string          `json:"id"`
+	Headers map[string]any  `json:"headers"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func TestFromJSON(t *testing.T) {
+	q, err := xcel.Quickstart[*LoginEvent]("event")
+	if err != nil {
+		t.Fatalf("failed to create quickstart: %v", err)
+	}
+
+	prg := q.MustCompile("event.user == 'root' && !event.success")
+
+	obj, err := xcel.FromJSON[*LoginEvent]([]byte(`{"user": "root", "success": false, "source_ip": "10.0.0.1"}`))
+	if err != nil {
+		t.Fatalf("failed to decode JSON: %v", err)
+	}
+
+	out, err := prg.Eval(obj.Raw)
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+
+	if obj.Raw.Source != "10.0.0.1" {
+		t.Fatalf("expected the source IP to be decoded but got %q", obj.Raw.Source)
+	}
+}
+
+func TestFromJSONDrift(t *testing.T) {
+	_, err := xcel.FromJSON[*WebhookEvent]([]byte(`{"ID": "1", "payload": {"a": 1}, "extra": true, "another": 1}`))
+
+	var drift *xcel.JSONDriftError
+	if !errors.As(err, &drift) {
+		t.Fatalf("expected a drift error but got '%v'", err)
+	}
+
+	want := []string{
+		"field 'headers' is missing key 'headers'",
+		"field 'payload' is raw JSON exposed as bytes",
+		"key 'another' has no field",
+		"key 'extra' has no field",
+	}
+	if !reflect.DeepEqual(drift.Issues, want) {
+		t.Fatalf("expected issues %q but got %q", want, drift.Issues)
+	}
+}
+
+func TestFromJSONExcludedFields(t *testing.T) {
+	// Keys of excluded fields are decoded without being fields, and
+	// excluded fields may be missing from the document.
+	obj, err := xcel.FromJSON[*Credentials]([]byte(`{"User": "alice", "SecretToken": "hunter2", "Trace": "abc"}`))
+	if err != nil {
+		t.Fatalf("failed to decode JSON: %v", err)
+	}
+
+	if obj.Raw.SecretToken != "hunter2" || obj.Raw.Trace != "abc" {
+		t.Fatalf("expected excluded fields to be decoded but got '%+v'", obj.Raw)
+	}
+}
+
+func TestFromJSONErrors(t *testing.T) {
+	for _, data := range []string{`[]`, `{"user": 1}`, `not json`} {
+		if obj, err := xcel.FromJSON[*LoginEvent]([]byte(data)); err == nil || obj != nil {
+			t.Fatalf("expected a decoding error for %s but got '%v'", data, err)
+		}
+	}
+
+	if _, err := xcel.FromJSON[LoginEvent]([]byte(`{}`)); err == nil {
+		t.Fatal("expected an error for a non-pointer type")
+	}
+}
+
+func TestFieldsParsedJSON(t *testing.T) {
+	event := &AuditEvent{
+		Payload: json.RawMessage(`{"kind": "exec", "args": ["-c", "id"], "pid": 42, "tty": null}`),
+		Extra:   json.RawMessage(`["a", "b"]`),
+	}
+
+	tests := []struct {
+		expr string
+		opts []xcel.Option
+		want bool
+	}{
+		{"obj.payload.kind == 'exec' && obj.payload.args.size() > 0", []xcel.Option{xcel.WithParsedJSON()}, true},
+		{"obj.payload.pid == 42.0 && obj.payload.tty == null", []xcel.Option{xcel.WithParsedJSON()}, true},
+		{"!has(obj.payload.user)", []xcel.Option{xcel.WithParsedJSON()}, true},
+		{"'b' in obj.extra", nil, true},
+		{"obj.payload == b'{}'", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, event, test.expr, test.opts...)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+
+	// Invalid documents are errors when the field is accessed.
+	_, err := evalFields(t, &AuditEvent{Extra: json.RawMessage(`{`)}, "obj.extra == null")
+	if err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Fatalf("expected an invalid JSON error, got: %v", err)
+	}
+
+	// Parsed fields aren't reported as drift.
+	if _, err := xcel.FromJSON[*AuditEvent]([]byte(`{"Payload": {}, "Extra": []}`), xcel.WithParsedJSON()); err != nil {
+		t.Fatalf("expected no drift, got: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package xcel_test
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+type SoakEvent struct {
+	Name     string
+	Tags     []string
+	Counts   []int
+	Parent   *SoakEvent
+	Children []Child
+	Labels   map[string]string
+}
+
+// TestHeapStableAcrossEvaluations evaluates one program against a million
+// events, creating nested objects and converted lists in every evaluation,
+// and checks the heap doesn't grow with the number of evaluations.
+func TestHeapStableAcrossEvaluations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping soak test in short mode")
+	}
+
+	const (
+		events   = 1_000_000
+		warmup   = 100_000
+		headroom = 4 << 20
+	)
+
+	reg := xcel.NewRegistry()
+	if err := xcel.RegisterAll(reg, []any{&SoakEvent{}}); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	_, typ := xcel.NewObject(&SoakEvent{})
+	reg.Variable("event", typ)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile(`event.parent.name == 'root' && 'x' in event.tags && event.counts.exists(c, c > 1) &&
+		event.children.exists(c, c.age > 3) && event.labels['env'] == 'prod'`)
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast, reg.ProgramOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	heapAlloc := func() uint64 {
+		var m runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&m)
+		return m.HeapAlloc
+	}
+
+	var baseline uint64
+	for i := 0; i < events; i++ {
+		if i == warmup {
+			baseline = heapAlloc()
+		}
+
+		event := &SoakEvent{
+			Name:     strconv.Itoa(i),
+			Tags:     []string{"x", strconv.Itoa(i)},
+			Counts:   []int{i % 3, 2},
+			Parent:   &SoakEvent{Name: "root"},
+			Children: []Child{{Name: "ada", Age: i % 8}},
+			Labels:   map[string]string{"env": "prod"},
+		}
+
+		out, _, err := reg.Eval(prg, map[string]any{"event": event})
+		if err != nil {
+			t.Fatalf("failed to evaluate event %d: %v", i, err)
+		}
+		if _, ok := out.(types.Bool); !ok {
+			t.Fatalf("expected a bool but got '%v' for event %d", out, i)
+		}
+	}
+
+	if after := heapAlloc(); after > baseline+headroom {
+		t.Fatalf("heap grew from %s to %s over %d evaluations", mib(baseline), mib(after), events-warmup)
+	}
+}
+
+func mib(n uint64) string {
+	return fmt.Sprintf("%.1fMiB", float64(n)/(1<<20))
+}
@@ -0,0 +1,17 @@
+package xcel
+
+import "github.com/google/cel-go/cel"
+
+// library is a cel.Library bundling environment options, so a set of
+// declarations can be returned as a single cel.EnvOption.
+type library []cel.EnvOption
+
+// CompileOptions implements the cel.Library interface.
+func (l library) CompileOptions() []cel.EnvOption {
+	return l
+}
+
+// ProgramOptions implements the cel.Library interface.
+func (library) ProgramOptions() []cel.ProgramOption {
+	return nil
+}
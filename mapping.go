@@ -0,0 +1,258 @@
+package xcel
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/cel-go/common/types"
+)
+
+// NameMapper returns the CEL field name for a Go struct field, given the Go
+// field names on the path from the object to the field, or an empty string
+// to defer to the next name mapper.
+type NameMapper func(goPath []string, sf reflect.StructField) string
+
+// ConvertFunc converts the value of a Go struct field to a value the CEL
+// type adapter supports for the field's CEL type.
+type ConvertFunc func(v reflect.Value) (any, error)
+
+// TypeMapper returns the CEL type of a Go struct field and the function to
+// convert its values, or false to defer to the next type mapper.
+type TypeMapper func(sf reflect.StructField) (*types.Type, ConvertFunc, bool)
+
+// WithNameMapper adds a name mapper for fields derived with NewFields. Name
+// mappers are consulted in the order they are added, before
+// DefaultNameMapper.
+func WithNameMapper(m NameMapper) Option {
+	return option("WithNameMapper", fieldScope, func(o *options) {
+		o.nameMappers = append(o.nameMappers, m)
+	})
+}
+
+// WithTypeMapper adds a type mapper for fields derived with NewFields. Type
+// mappers are consulted in the order they are added, before
+// DefaultTypeMapper.
+func WithTypeMapper(m TypeMapper) Option {
+	return option("WithTypeMapper", fieldScope, func(o *options) {
+		o.typeMappers = append(o.typeMappers, m)
+	})
+}
+
+// SkippedField is a Go struct field NewFields does not derive a field for:
+// either it is of a kind CEL has no type for, such as a func, chan, complex
+// number, or unsafe pointer, and no type mapper given as an option maps it,
+// or its name is ambiguous, being promoted from more than one embedded
+// struct at the same depth, or being the name of an embedded struct which
+// collides with another field, see WithEmbeddedTypePaths, or it refers to
+// nested objects deeper than the depth given with WithMaxDepth.
+type SkippedField struct {
+	// Path is the dotted path of Go field names from the object to the
+	// field, such as "Base.Done" for a field promoted from Base.
+	Path string
+	Type reflect.Type
+
+	// Ambiguous is set for fields skipped because of their name, in which
+	// case each of the conflicting fields is reported.
+	Ambiguous bool
+
+	// Truncated is set for fields skipped because of WithMaxDepth, in
+	// which case Path is the path within the nested object the field is
+	// declared in.
+	Truncated bool
+}
+
+// WithSkippedFields reports the struct fields NewFields skips to the given
+// function, such as to log or test which fields of a type are omitted.
+// Skipping a field never affects the fields derived for its siblings.
+func WithSkippedFields(report func(SkippedField)) Option {
+	return option("WithSkippedFields", fieldScope, func(o *options) {
+		o.skipped = report
+	})
+}
+
+// WithMaxDepth limits the nesting of the objects derived with NewFields to
+// the given number of levels, such as for deeply nested third-party types
+// whose nested object types would never be used: the fields of the object
+// are the first level, the fields of its nested objects the second, and so
+// on, while fields promoted from embedded structs are on the level of the
+// struct embedding them. Fields referring to nested objects beyond the
+// limit are left out, so selecting them fails to compile, and reported to
+// WithSkippedFields.
+func WithMaxDepth(n int) Option {
+	return option("WithMaxDepth", fieldScope, func(o *options) {
+		o.maxDepth = n
+	})
+}
+
+// WithIncludeFields limits the fields derived with NewFields to the given
+// fields, by their dotted path of CEL names from the object, such as
+// "name" or "runtime.container_id". Including a nested object includes all
+// of its fields, and including one of its fields includes the object with
+// only the fields included. Other fields are left out of the object types,
+// so selecting them fails to compile.
+//
+// Since each nested object type is derived once, its fields are limited by
+// the paths of the first field it is found in. NewFieldsE reports paths
+// which match no field as an error.
+func WithIncludeFields(paths ...string) Option {
+	return option("WithIncludeFields", fieldScope, func(o *options) {
+		o.includeFields = append(o.includeFields, paths...)
+	})
+}
+
+// WithExcludeFields leaves the given fields out of the fields derived with
+// NewFields, by their dotted path of CEL names from the object like
+// WithIncludeFields, along with the nested objects they refer to, such as
+// to leave out large blobs when their struct cannot be tagged with
+// `cel:"-"`. Fields can be excluded from included nested objects, but not
+// be both included and excluded, which NewFieldsE reports as an error, as
+// well as paths which match no field.
+func WithExcludeFields(paths ...string) Option {
+	return option("WithExcludeFields", fieldScope, func(o *options) {
+		o.excludeFields = append(o.excludeFields, paths...)
+	})
+}
+
+// fieldAllowed reports whether the field with the given path of CEL names
+// is derived, see WithIncludeFields and WithExcludeFields, marking the
+// paths it matches.
+func (o *options) fieldAllowed(path string, matched map[string]bool) bool {
+	for _, p := range o.excludeFields {
+		if p == path {
+			matched[p] = true
+			return false
+		}
+	}
+	if len(o.includeFields) == 0 {
+		return true
+	}
+
+	allowed := false
+	for _, p := range o.includeFields {
+		switch {
+		case p == path:
+			matched[p] = true
+			allowed = true
+		case strings.HasPrefix(p, path+"."), strings.HasPrefix(path, p+"."):
+			// An object on the path to an included field, or a field
+			// of an included object.
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+// fieldListErrors returns the errors for the paths given with
+// WithIncludeFields and WithExcludeFields which were not matched, or which
+// are both included and excluded.
+func (o *options) fieldListErrors(matched map[string]bool) []error {
+	var errs []error
+	excluded := map[string]bool{}
+	for _, p := range o.excludeFields {
+		excluded[p] = true
+	}
+	for _, p := range o.includeFields {
+		if excluded[p] {
+			errs = append(errs, fmt.Errorf("xcel: field '%s' is both included and excluded", p))
+		} else if !matched[p] {
+			errs = append(errs, fmt.Errorf("xcel: unknown included field '%s'", p))
+		}
+	}
+	for _, p := range o.excludeFields {
+		if !matched[p] {
+			errs = append(errs, fmt.Errorf("xcel: unknown excluded field '%s'", p))
+		}
+	}
+	return errs
+}
+
+// DefaultNameMapper is the built-in name mapper, which names fields by the
+// snake_case form of their Go name, see ToSnakeCase.
+func DefaultNameMapper(goPath []string, sf reflect.StructField) string {
+	return ToSnakeCase(sf.Name)
+}
+
+// DefaultTypeMapper is the built-in type mapper, which maps primitive Go
+// types, times, and lists and maps of them to their CEL types, and anything
+// else to an object type named after the Go type.
+func DefaultTypeMapper(sf reflect.StructField) (*types.Type, ConvertFunc, bool) {
+	return celTypeForField(sf.Type), convertForCEL, true
+}
+
+// fieldName returns the CEL name of the field from its cel tag, such as
+// `cel:"container_id"`, or else from the first name mapper which does not
+// defer.
+func (o *options) fieldName(goPath []string, sf reflect.StructField) string {
+	if name, _, _ := strings.Cut(sf.Tag.Get("cel"), ","); name != "" {
+		return name
+	}
+	for _, m := range o.nameMappers {
+		if name := m(goPath, sf); name != "" {
+			return name
+		}
+	}
+	return DefaultNameMapper(goPath, sf)
+}
+
+// fieldOptions returns an option adding the name and type mappers of o
+// after those of the options it is applied to, so the fields derived for a
+// registry use its mappers after the ones given for a registration, along
+// with its field conversion options, such as WithAbsentValues.
+func (o *options) fieldOptions() Option {
+	return func(dst *options) {
+		dst.jsonString = dst.jsonString || o.jsonString
+		dst.jsonPresence = dst.jsonPresence || o.jsonPresence
+		for field, limit := range o.maxValueSizes {
+			if _, ok := dst.maxValueSizes[field]; ok {
+				continue
+			}
+			if dst.maxValueSizes == nil {
+				dst.maxValueSizes = map[string]valueLimit{}
+			}
+			dst.maxValueSizes[field] = limit
+		}
+		if dst.dynamicTypeMode == DynamicTypeLenient {
+			dst.dynamicTypeMode = o.dynamicTypeMode
+		}
+		dst.absentValues = dst.absentValues || o.absentValues
+		dst.parsedJSON = dst.parsedJSON || o.parsedJSON
+		dst.urlObjects = dst.urlObjects || o.urlObjects
+		dst.textMarshalers = dst.textMarshalers || o.textMarshalers
+		dst.bigNumberStrings = dst.bigNumberStrings || o.bigNumberStrings
+		dst.impls = append(dst.impls, o.impls...)
+		dst.stringerFallback = dst.stringerFallback || o.stringerFallback
+		for t := range o.stringers {
+			if dst.stringers == nil {
+				dst.stringers = map[reflect.Type]bool{}
+			}
+			dst.stringers[t] = true
+		}
+		dst.embeddedPaths = dst.embeddedPaths || o.embeddedPaths
+		dst.noPromotion = dst.noPromotion || o.noPromotion
+		dst.includeFields = append(dst.includeFields, o.includeFields...)
+		dst.excludeFields = append(dst.excludeFields, o.excludeFields...)
+		if !dst.collisionRename {
+			dst.collisionRename, dst.renamed = o.collisionRename, o.renamed
+		}
+		if dst.flattenDepth == 0 {
+			dst.flattenDepth = o.flattenDepth
+		}
+		if dst.presence == PresenceNonNil {
+			dst.presence = o.presence
+		}
+		dst.emptyUnset = dst.emptyUnset || o.emptyUnset
+		dst.deepStructs = dst.deepStructs || o.deepStructs
+		if dst.presenceFunc == nil {
+			dst.presenceFunc = o.presenceFunc
+		}
+		if dst.maxDepth == 0 {
+			dst.maxDepth = o.maxDepth
+		}
+		if dst.skipped == nil {
+			dst.skipped = o.skipped
+		}
+		dst.nameMappers = append(dst.nameMappers, o.nameMappers...)
+		dst.typeMappers = append(dst.typeMappers, o.typeMappers...)
+	}
+}
@@ -0,0 +1,151 @@
+package xcel
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// ToSnakeCase returns the snake_case CEL field name for a Go field name.
+// It is used by NewFields, and exported so tooling can derive the same
+// names. Since renaming a field breaks the expressions using it, the
+// rules are fixed:
+//
+//   - A lower case letter followed by an upper case letter starts a new
+//     word: "ExePath" is "exe_path".
+//   - A run of upper case letters is a single word, except for its last
+//     letter when that begins a lower case word: "HTTPServer" is "http_server".
+//   - A run of upper case letters followed by a lone "s" is a plural
+//     initialism: "IDs" is "ids" and "UserIDs" is "user_ids".
+//   - Common Go initialisms, such as API, ID, and URL, and "OAuth", are
+//     words of their own where a word starts: "APIURL" is "api_url" and
+//     "OAuth2Token" is "oauth2_token".
+//   - A single lower case letter between an upper case run and a digit
+//     belongs to the run: "IPv4Addr" is "ipv4_addr".
+//   - Digits belong to the preceding word, with no underscore before
+//     them, and an upper case letter after them starts a new word, while a
+//     lower case letter continues theirs: "Sha256Sum" is "sha256_sum",
+//     "S3Bucket" is "s3_bucket", and "Sha256sum" is "sha256sum".
+//
+// Names derived before initialisms were recognized, such as "i_ds" for
+// "IDs", are kept by LegacyNameMapper.
+func ToSnakeCase(name string) string {
+	runes := []rune(name)
+
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		j := initialismEnd(runes, i)
+		if j == i {
+			j = i + 1
+			for j < len(runes) && !wordStart(runes, j) {
+				j++
+			}
+		}
+
+		if i > 0 && runes[i-1] != '_' && runes[i] != '_' {
+			b.WriteByte('_')
+		}
+		for _, r := range runes[i:j] {
+			b.WriteRune(unicode.ToLower(r))
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// commonInitialisms are the initialisms which are words of their own, from
+// the Go style guide, ordered so longer ones match first.
+var commonInitialisms = []string{
+	"ASCII", "HTTPS", "OAuth", "XMPP", "XSRF", "GUID", "HTML",
+	"HTTP", "JSON", "SMTP", "UUID", "UTF8", "API", "CPU", "CSS", "DNS",
+	"EOF", "LHS", "QPS", "RAM", "RHS", "RPC", "SLA", "SQL", "SSH", "TCP",
+	"TLS", "TTL", "UDP", "UID", "URI", "URL", "XML", "XSS", "ID", "IP",
+	"UI", "VM",
+}
+
+// initialismEnd returns the end of the initialism word starting at index
+// i, including a plural "s" and the digits following it, or i if there is
+// none. An initialism is only a word of its own when the rest of its upper
+// case run starts a word too, so the HTTPS of "HTTPServer" and the IP of
+// "IPC" are not.
+func initialismEnd(runes []rune, i int) int {
+	for _, ini := range commonInitialisms {
+		j := i + len(ini)
+		if j > len(runes) || string(runes[i:j]) != ini {
+			continue
+		}
+		if j < len(runes) {
+			switch r := runes[j]; {
+			case unicode.IsLower(r):
+				if !isPlural(runes, j) {
+					continue
+				}
+				j++
+			case unicode.IsUpper(r):
+				if !legacyWordStart(runes, j) && initialismEnd(runes, j) == j {
+					continue
+				}
+			}
+		}
+		for j < len(runes) && unicode.IsDigit(runes[j]) {
+			j++
+		}
+		return j
+	}
+	return i
+}
+
+// isPlural reports whether the rune at index i is an "s" ending the word
+// before it, as in "IDs" or "IDsByName".
+func isPlural(runes []rune, i int) bool {
+	return runes[i] == 's' && (i+1 == len(runes) || !unicode.IsLower(runes[i+1]))
+}
+
+// wordStart reports whether the rune at index i, which is not the
+// first rune, starts a new word.
+func wordStart(runes []rune, i int) bool {
+	if unicode.IsUpper(runes[i-1]) && unicode.IsUpper(runes[i]) && i+1 < len(runes) && isPlural(runes, i+1) {
+		// The last upper case letter of a plural initialism: "PIDs".
+		return false
+	}
+	return legacyWordStart(runes, i)
+}
+
+// LegacyNameMapper is a name mapper naming fields by the snake_case form of
+// their Go name without recognizing initialisms, as NewFields did before,
+// such as "i_ds" for "IDs", "apiurl" for "APIURL", and "o_auth2_token" for
+// "OAuth2Token". Use it with WithNameMapper to keep existing rules working.
+func LegacyNameMapper(goPath []string, sf reflect.StructField) string {
+	runes := []rune(sf.Name)
+
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && legacyWordStart(runes, i) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// legacyWordStart reports whether the rune at index i, which is not the
+// first rune, starts a new word, without recognizing plural initialisms.
+func legacyWordStart(runes []rune, i int) bool {
+	r, prev := runes[i], runes[i-1]
+	if !unicode.IsUpper(r) {
+		return false
+	}
+
+	// After a lower case letter or digit: "exePath", "sha256Sum".
+	if unicode.IsLower(prev) || unicode.IsDigit(prev) {
+		return true
+	}
+
+	// The last upper case letter of a run, followed by a lower case
+	// word: "HTTPServer", but not "IPv4".
+	if unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+		return !(i+2 < len(runes) && unicode.IsDigit(runes[i+2]))
+	}
+
+	return false
+}
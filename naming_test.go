@@ -0,0 +1,81 @@
+package xcel_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/picatz/xcel"
+)
+
+func TestToSnakeCase(t *testing.T) {
+	// These names are part of the rules users write, so changing any of
+	// them is a breaking change.
+	tests := map[string]string{
+		"Name":           "name",
+		"ExePath":        "exe_path",
+		"HTTPStatusCode": "http_status_code",
+		"HTTPServer":     "http_server",
+		"Sha256Sum":      "sha256_sum",
+		"IPv4Addr":       "ipv4_addr",
+		"IPv6":           "ipv6",
+		"Base64Data":     "base64_data",
+		"S3Bucket":       "s3_bucket",
+		"MD5":            "md5",
+		"Version2":       "version2",
+		"K8sEvent":       "k8s_event",
+		"X":              "x",
+		"UserID":         "user_id",
+		"APIURL":         "api_url",
+		"IDs":            "ids",
+		"UserIDs":        "user_ids",
+		"PIDs":           "pids",
+		"IDsByName":      "ids_by_name",
+		"OAuth2Token":    "oauth2_token",
+		"XMLHTTPRequest": "xml_http_request",
+		"HTTP2Server":    "http2_server",
+		"IPC":            "ipc",
+		"APIV2":          "apiv2",
+		"API_Key":        "api_key",
+		"Sha256sum":      "sha256sum",
+		"Sha256SUM":      "sha256_sum",
+		"IPv4":           "ipv4",
+		"S3":             "s3",
+		"X509Cert":       "x509_cert",
+		"Route53Zone":    "route53_zone",
+		"Port8080":       "port8080",
+		"V2Beta1":        "v2_beta1",
+		"Vec3d":          "vec3d",
+		"Top10Items":     "top10_items",
+		"Base64URL":      "base64_url",
+		"UTF8String":     "utf8_string",
+		"HTTP2":          "http2",
+		"Int64Value":     "int64_value",
+		"Md5Hash":        "md5_hash",
+	}
+
+	for name, want := range tests {
+		if got := xcel.ToSnakeCase(name); got != want {
+			t.Errorf("ToSnakeCase(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestLegacyNameMapper(t *testing.T) {
+	// The names derived before initialisms were recognized.
+	tests := map[string]string{
+		"ExePath":     "exe_path",
+		"HTTPServer":  "http_server",
+		"UserID":      "user_id",
+		"IDs":         "i_ds",
+		"APIURL":      "apiurl",
+		"OAuth2Token": "o_auth2_token",
+		"Sha256Sum":   "sha256_sum",
+	}
+
+	for name, want := range tests {
+		sf := reflect.StructField{Name: name, Type: reflect.TypeOf("")}
+		if got := xcel.LegacyNameMapper(nil, sf); got != want {
+			t.Errorf("LegacyNameMapper(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
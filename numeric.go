@@ -0,0 +1,33 @@
+package xcel
+
+import "github.com/google/cel-go/cel"
+
+// WithLenientNumerics makes the environment of a registry accept ordering
+// comparisons (<, <=, >, >=) between int, uint, and double values, such as
+// a uint field ordered against an int literal (obj.port < 1024) or a double
+// field against an int (obj.ratio < 1), using cel-go's cross-type numeric
+// comparisons.
+//
+// CEL declares == and != for operands of the same type only, and does not
+// allow other overloads, so equality still requires matching types, such as
+// obj.port == 443u or obj.port == uint(443).
+//
+// Values are compared by their numeric value, not their type, with a few
+// caveats: negative ints are always less than uints, so a uint field above
+// the maximum int64 is greater than every int; ints are converted to double
+// when compared with doubles, so integers above 2^53 compare as the nearest
+// double; and float32 fields are widened to double, so a float32 field
+// holding 0.1 is greater than the literal 0.1.
+func WithLenientNumerics() Option {
+	return option("WithLenientNumerics", registryScope, func(o *options) {
+		o.lenientNumerics = true
+	})
+}
+
+// lenientNumericOptions returns the environment options used by
+// WithLenientNumerics.
+func lenientNumericOptions() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.CrossTypeNumericComparisons(true),
+	}
+}
@@ -0,0 +1,134 @@
+package xcel_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+type Measurement struct {
+	Count   int
+	Bytes   uint64
+	Port    uint32
+	Code    int32
+	Ratio   float64
+	Reading float32
+}
+
+func TestLenientNumerics(t *testing.T) {
+	m := &Measurement{
+		Count:   1 << 53,
+		Bytes:   math.MaxUint64,
+		Port:    443,
+		Code:    -1,
+		Ratio:   0.5,
+		Reading: 0.1,
+	}
+
+	reg := xcel.NewRegistry(xcel.WithLenientNumerics())
+
+	obj, typ := xcel.NewObject(m)
+
+	xcel.RegisterObject(reg.Adapter, reg.Provider, obj, typ, xcel.NewFields(obj))
+
+	reg.Variable("obj", typ)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"obj.port < 1024", true},
+		{"obj.port > 442 && obj.port <= 443.0", true},
+		{"obj.port == 443u", true},
+		{"obj.code < 0u", true},
+		{"obj.code >= -1.0", true},
+		{"obj.ratio < 1", true},
+		{"obj.ratio > 0", true},
+		// Integers above 2^53 are compared as the nearest double.
+		{"obj.count >= 9007199254740992.0", true},
+		{"obj.count + 1 > 9007199254740992.0", false},
+		{"obj.count + 1 > 9007199254740992", true},
+		// A uint above the maximum int64 is greater than every int.
+		{"obj.bytes > 9223372036854775807", true},
+		{"obj.bytes >= 18446744073709551615.0", true},
+		{"obj.bytes > 18446744073709551614u", true},
+		// float32 fields are widened to double.
+		{"obj.reading > 0.1", true},
+		{"obj.reading > 0.09 && obj.reading < 0.11", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			ast, iss := env.Compile(test.expr)
+			if iss.Err() != nil {
+				t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			out, _, err := prg.Eval(map[string]any{"obj": obj})
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
+
+func TestLenientNumericsEquality(t *testing.T) {
+	reg := xcel.NewRegistry(xcel.WithLenientNumerics())
+
+	obj, typ := xcel.NewObject(&Measurement{})
+
+	xcel.RegisterObject(reg.Adapter, reg.Provider, obj, typ, xcel.NewFields(obj))
+
+	reg.Variable("obj", typ)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	if _, iss := env.Compile("obj.port == 443"); iss.Err() == nil {
+		t.Fatal("expected a compile error for equality across numeric types")
+	}
+}
+
+func TestLenientNumericsDisabled(t *testing.T) {
+	reg := xcel.NewRegistry()
+
+	obj, typ := xcel.NewObject(&Measurement{})
+
+	xcel.RegisterObject(reg.Adapter, reg.Provider, obj, typ, xcel.NewFields(obj))
+
+	reg.Variable("obj", typ)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	for _, expr := range []string{"obj.port < 1024", "obj.ratio < 1"} {
+		if _, iss := env.Compile(expr); iss.Err() == nil {
+			t.Fatalf("expected a compile error for %q", expr)
+		}
+	}
+
+	if _, iss := env.Compile("obj.port == 443u && obj.code == -1 && obj.reading < 1.0"); iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+}
@@ -1,26 +1,80 @@
 package xcel
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/google/cel-go/cel"
 	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
 	"github.com/google/cel-go/common/types/traits"
+	"google.golang.org/protobuf/proto"
 )
 
 // Object is a CEL value wrapper for a Go value that
 // can be used in expressions.
 type Object[T any] struct {
 	Raw T
+
+	fields  map[string]*types.FieldType
+	adapter types.Adapter
+	opts    *options
+
+	// typ is the CEL type of nested objects of anonymous struct types,
+	// which are named after the field they were found in.
+	typ *types.Type
+
+	// cache holds the field values read during one RuleSet evaluation,
+	// and onAccess observes them during one Registry.Trace evaluation.
+	cache    map[string]any
+	onAccess func(name string, value any)
+
+	// nested are the nested object types found by NewFields, and protos
+	// the protobuf message types, which are registered along with the
+	// object by RegisterObject.
+	nested []*nestedObject
+	protos []proto.Message
 }
 
 // NewObject creates a new CEL value wrapper for a Go value
 // that can be used in expressions.
-func NewObject[T any](val T) (*Object[T], *types.Type) {
-	return &Object[T]{Raw: val}, cel.ObjectType(reflect.TypeOf(val).String(), traits.ReceiverType)
+func NewObject[T any](val T, opts ...Option) (*Object[T], *types.Type) {
+	obj := &Object[T]{Raw: val, opts: newOptions(opts...)}
+	return obj, objectTypeOf(val)
+}
+
+// objectTypes caches the CEL object type for each wrapped Go type.
+var objectTypes sync.Map // map[reflect.Type]*types.Type
+
+// objectTypeOf returns the cached CEL object type for the Go value.
+func objectTypeOf(val any) *types.Type {
+	rt := reflect.TypeOf(val)
+	if t, ok := objectTypes.Load(rt); ok {
+		return t.(*types.Type)
+	}
+	t, _ := objectTypes.LoadOrStore(rt, cel.ObjectType(fmt.Sprintf("%T", val), traits.ReceiverType))
+	return t.(*types.Type)
+}
+
+// friendlyTypeName returns the Go type name of the value without
+// its package path or pointer indirection, such as "Example".
+func friendlyTypeName(val any) string {
+	rt := reflect.TypeOf(val)
+	if rt == nil {
+		return "nil"
+	}
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	if rt.Name() != "" {
+		return rt.Name()
+	}
+	return rt.String()
 }
 
 // ConvertToNative converts the CEL value wrapper to a native Go value.
@@ -32,8 +86,30 @@ func (o *Object[T]) ConvertToNative(typeDesc reflect.Type) (any, error) {
 }
 
 // ConvertToType converts the CEL value wrapper to a CEL value of the specified type.
+//
+// Besides its own type, an object can be converted to a type value, a string
+// (see String and WithJSONString), and a map of its set fields.
 func (o *Object[T]) ConvertToType(typeValue ref.Type) ref.Val {
-	if typeValue == o.Type() {
+	switch typeValue {
+	case types.TypeType:
+		return o.Type().(*types.Type)
+	case types.StringType:
+		if o.opts != nil && o.opts.jsonString {
+			b, err := json.Marshal(o)
+			if err != nil {
+				return types.NewErr("xcel: string conversion error for '%s': %v", o.Type(), err)
+			}
+			return types.String(b)
+		}
+		return types.String(o.String())
+	case types.MapType:
+		m, err := o.toMap()
+		if err != nil {
+			return types.NewErr("xcel: map conversion error for '%s': %v", o.Type(), err)
+		}
+		return types.NewStringInterfaceMap(o.adapterOrDefault(), m)
+	}
+	if typeValue.TypeName() == o.Type().TypeName() {
 		return o
 	}
 	return types.NewErr("xcel: type conversion error from '%s' to '%s'", o.Type(), typeValue)
@@ -49,7 +125,10 @@ func (o *Object[T]) Equal(other ref.Val) ref.Val {
 
 // Type returns the CEL type of the CEL value wrapper.
 func (o *Object[T]) Type() ref.Type {
-	return cel.ObjectType(fmt.Sprintf("%T", o.Raw), traits.ReceiverType)
+	if o.typ != nil {
+		return o.typ
+	}
+	return objectTypeOf(o.Raw)
 }
 
 // Value returns the CEL value wrapper.
@@ -57,92 +136,277 @@ func (o *Object[T]) Value() any {
 	return o
 }
 
-// RegisterObject registers a CEL value wrapper for a Go value with the
-// type adapter and type provider, which are provided by the caller when
-// constructing a CEL environment.
-func RegisterObject[T any](ta TypeAdapter, tp *TypeProvider, objt *Object[T], t *types.Type, fields map[string]*types.FieldType) {
-	ta[reflect.TypeOf(objt.Raw)] = func(value any) ref.Val {
-		return objt
+// Get returns the value of the named field. It is used for field selection
+// when the object type is not known when checking the expression, such as
+// optional field selection (obj.?name) or selection on dyn values.
+func (o *Object[T]) Get(index ref.Val) ref.Val {
+	field, err := o.field(index)
+	if err != nil {
+		return types.WrapErr(err)
+	}
+	v, err := field.GetFrom(o)
+	if err != nil {
+		return types.WrapErr(err)
 	}
+	return o.adapterOrDefault().NativeToValue(v)
+}
 
-	RegisterType(tp, t)
+// IsSet returns whether the named field is set, see Get. Fields which are
+// not registered for the object's type are not set, so has() can guard
+// selections on dyn values which may hold objects of different types.
+func (o *Object[T]) IsSet(index ref.Val) ref.Val {
+	if name, ok := index.(types.String); ok && o.fields != nil {
+		if _, ok := o.fields[string(name)]; !ok {
+			return types.False
+		}
+	}
+	field, err := o.field(index)
+	if err != nil {
+		return types.WrapErr(err)
+	}
+	return types.Bool(field.IsSet(o))
+}
 
-	RegisterStructType(tp, t.TypeName(), fields)
+// fieldValues returns the field value cache of the object, if any.
+func (o *Object[T]) fieldValues() map[string]any {
+	return o.cache
+}
+
+// withFieldCache returns a copy of the object with an empty field value
+// cache, so the original object is never shared across evaluations.
+func (o *Object[T]) withFieldCache() ref.Val {
+	c := *o
+	c.cache = make(map[string]any, len(o.fields))
+	return &c
+}
+
+// fieldAccessed reports a field value read to the object's access hook.
+func (o *Object[T]) fieldAccessed(name string, value any) {
+	if o.onAccess != nil {
+		o.onAccess(name, value)
+	}
 }
 
-// NewFields returns a map[string]*types.FieldType for the given object type
-// wrapping a Go struct pointer value.
-func NewFields[T any](objt *Object[T]) map[string]*types.FieldType {
-	fields := map[string]*types.FieldType{}
+// withAccessHook returns a copy of the object which reports the field
+// values read through it to the hook.
+func (o *Object[T]) withAccessHook(hook func(name string, value any)) ref.Val {
+	c := *o
+	c.onAccess = hook
+	return &c
+}
 
-	// Get the struct from the pointer.
-	v := reflect.ValueOf(objt.Raw).Elem()
+// lookupField returns the registered field with the name, if any.
+func (o *Object[T]) lookupField(name string) (*types.FieldType, bool) {
+	field, ok := o.fields[name]
+	return field, ok
+}
 
-	for i := 0; i < v.NumField(); i++ {
-		field := v.Field(i)
+// field returns the registered field for the given field name.
+func (o *Object[T]) field(index ref.Val) (*types.FieldType, error) {
+	name, ok := index.(types.String)
+	if !ok {
+		return nil, fmt.Errorf("xcel: unsupported field index type '%s' for '%s'", index.Type(), o.Type())
+	}
+	field, ok := o.fields[string(name)]
+	if !ok {
+		return nil, fmt.Errorf("xcel: no such field '%s' on '%s'", name, o.Type())
+	}
+	return field, nil
+}
 
-		// Get the field name.
-		name := v.Type().Field(i).Name
+// String returns a compact form of the wrapped value. Values implementing
+// fmt.Stringer use their own form, registered objects render their set
+// fields in name order, such as Person{age: 1, name: "test"}, and anything
+// else falls back to its type name followed by the value formatted with
+// %+v, such as Person{Name:test Age:1}.
+func (o *Object[T]) String() string {
+	if s, ok := any(o.Raw).(fmt.Stringer); ok {
+		return s.String()
+	}
 
-		// Get the field value.
-		value := field.Interface()
+	m, err := o.toMap()
+	if err != nil {
+		return fmt.Sprintf("%s%+v", friendlyTypeName(o.Raw), reflect.Indirect(reflect.ValueOf(o.Raw)))
+	}
 
-		var celType *types.Type
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(friendlyTypeName(o.Raw))
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(formatValue(m[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
 
-		// Convert the field value to a CEL value, if possible, default to object.
-		switch value.(type) {
-		case string:
-			celType = types.StringType
-		case int:
-			celType = types.IntType
-		case float64:
-			celType = types.DoubleType
-		case bool:
-			celType = types.BoolType
-		case []string:
-			celType = types.NewListType(types.StringType)
-		default:
-			celType = cel.ObjectType(reflect.TypeOf(value).String(), traits.ReceiverType)
+// MarshalJSON encodes the set fields of a registered object as a JSON
+// object, or the wrapped value itself if no fields are registered.
+func (o *Object[T]) MarshalJSON() ([]byte, error) {
+	m, err := o.toMap()
+	if err != nil {
+		return json.Marshal(o.Raw)
+	}
+	for name, v := range m {
+		if rv, ok := v.(ref.Val); ok {
+			m[name] = rv.Value()
 		}
+	}
+	return json.Marshal(m)
+}
 
-		// Use lower case for the field name.
-		fields[strings.ToLower(name)] = &types.FieldType{
-			Type: celType,
-			IsSet: ref.FieldTester(func(target any) bool {
-				// If it's a field of a struct, get the struct.
-				x := target.(*Object[T]).Raw
+// toMap returns the values of the set fields of the object by field name.
+// Fields are visited in name order, so the first error is deterministic.
+func (o *Object[T]) toMap() (map[string]any, error) {
+	if o.fields == nil {
+		return nil, fmt.Errorf("xcel: no fields registered for '%s'", o.Type())
+	}
+	m := make(map[string]any, len(o.fields))
+	for _, name := range sortedFieldNames(o.fields) {
+		field := o.fields[name]
+		if !field.IsSet(o) {
+			continue
+		}
+		v, err := field.GetFrom(o)
+		if err != nil {
+			return nil, err
+		}
+		m[name] = v
+	}
+	return m, nil
+}
 
-				v := reflect.ValueOf(x).Elem()
+// adapterOrDefault returns the type adapter the object was registered
+// with, or the default CEL type adapter.
+func (o *Object[T]) adapterOrDefault() types.Adapter {
+	if o.adapter != nil {
+		return o.adapter
+	}
+	return types.DefaultTypeAdapter
+}
 
-				// Get index of the field.
-				f := v.FieldByName(name)
+// formatValue returns the compact string form of a field value.
+func formatValue(v any) string {
+	if rv, ok := v.(ref.Val); ok {
+		v = rv.Value()
+	}
+	switch v := v.(type) {
+	case fmt.Stringer:
+		return v.String()
+	case string:
+		return strconv.Quote(v)
+	case []byte:
+		return fmt.Sprintf("b%q", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
 
-				return !f.IsNil()
+// ObjectConversions returns a CEL environment option declaring the string(obj)
+// conversion for the given registered object type.
+func ObjectConversions(t *types.Type) cel.EnvOption {
+	return cel.Function("string",
+		cel.Overload(
+			t.TypeName()+"_to_string",
+			[]*cel.Type{t},
+			cel.StringType,
+			cel.UnaryBinding(func(value ref.Val) ref.Val {
+				return value.ConvertToType(types.StringType)
 			}),
-			GetFrom: ref.FieldGetter(func(target any) (any, error) {
-				// If it's a field of a struct, get the struct.
-				x := target.(*Object[T]).Raw
+		),
+	)
+}
+
+// RegisterObject registers a CEL value wrapper for a Go value with the
+// type adapter and type provider, which are provided by the caller when
+// constructing a CEL environment. It panics if the type provider is
+// frozen, see TypeProvider.Freeze.
+func RegisterObject[T any](ta TypeAdapter, tp *TypeProvider, objt *Object[T], t *types.Type, fields map[string]*types.FieldType) {
+	if err := RegisterObjectE(ta, tp, objt, t, fields); err != nil {
+		panic(err)
+	}
+}
 
-				v := reflect.ValueOf(x).Elem()
+// RegisterObjectE is like RegisterObject, but returns an error instead of
+// panicking, wrapping ErrFrozen if the type provider is frozen.
+func RegisterObjectE[T any](ta TypeAdapter, tp *TypeProvider, objt *Object[T], t *types.Type, fields map[string]*types.FieldType) error {
+	if tp.Frozen() {
+		return fmt.Errorf("%w: cannot register '%s' with the type provider", ErrFrozen, t.TypeName())
+	}
 
-				// Get index of the field.
-				f := v.FieldByName(name)
+	objt.fields = fields
+	objt.adapter = ta
 
-				// Get the field value.
-				value := f.Interface()
+	ta[reflect.TypeOf(objt.Raw)] = func(value any) ref.Val {
+		return &Object[T]{Raw: value.(T), fields: fields, adapter: ta, opts: objt.opts}
+	}
 
-				vt, ok := value.(T)
-				if !ok {
-					return value, nil
-				}
+	RegisterType(tp, t)
 
-				// Create a CEL object from the field value.
-				obj, _ := NewObject(vt)
+	RegisterStructType(tp, t.TypeName(), fields)
 
-				return obj, nil
-			}),
+	for _, n := range objt.nested {
+		if _, ok := ta[n.rt]; !ok {
+			ta[n.rt] = n.wrap
 		}
+		RegisterNestedType(tp, t.TypeName(), n.typ, n.fields)
+	}
+
+	for _, msg := range objt.protos {
+		if err := RegisterProtoType(ta, tp, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RegisterTypeFor registers the object type of the Go struct pointer type T
+// with the type adapter and type provider, with fields derived by NewFields
+// from the type alone, and returns its CEL type, such as for cel.Variable.
+// Unlike RegisterObject, it needs no value of the type: the type adapter
+// wraps each value of the type it is given, so raw values can be passed to
+// evaluations. It is named after reflect.TypeFor, as RegisterType registers
+// a CEL type.
+func RegisterTypeFor[T any](ta TypeAdapter, tp *TypeProvider, opts ...Option) (*types.Type, error) {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	if rt.Kind() != reflect.Pointer || rt.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("xcel: unsupported type '%s', expected a struct pointer", rt)
+	}
+	if err := newOptions(opts...).check("RegisterTypeFor", fieldScope); err != nil {
+		return nil, err
+	}
+
+	obj, typ := NewObject(reflect.New(rt.Elem()).Interface().(T), opts...)
+
+	fields, err := NewFieldsE(obj, opts...)
+	if err != nil {
+		return nil, err
 	}
 
-	return fields
+	if err := RegisterObjectE(ta, tp, obj, typ, fields); err != nil {
+		return nil, err
+	}
+
+	return typ, nil
+}
+
+// MustRegisterTypeFor is like RegisterTypeFor, but panics if the type cannot
+// be registered.
+func MustRegisterTypeFor[T any](ta TypeAdapter, tp *TypeProvider, opts ...Option) *types.Type {
+	t, err := RegisterTypeFor[T](ta, tp, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return t
 }
@@ -1,12 +1,16 @@
 package xcel_test
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/google/cel-go/cel"
 	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
 	"github.com/picatz/xcel"
 )
 
@@ -614,3 +618,418 @@ func BenchmarkNewObjectReflectionFields(b *testing.B) {
 
 	b.StopTimer()
 }
+
+type Person struct {
+	Name string
+	Age  int
+}
+
+func personFields() map[string]*types.FieldType {
+	return map[string]*types.FieldType{
+		"name": {
+			Type: types.StringType,
+			IsSet: ref.FieldTester(func(target any) bool {
+				x := target.(*xcel.Object[*Person])
+
+				return x.Raw != nil && x.Raw.Name != ""
+			}),
+			GetFrom: ref.FieldGetter(func(target any) (any, error) {
+				x := target.(*xcel.Object[*Person])
+
+				return x.Raw.Name, nil
+			}),
+		},
+		"age": {
+			Type: types.IntType,
+			IsSet: ref.FieldTester(func(target any) bool {
+				x := target.(*xcel.Object[*Person])
+
+				return x.Raw != nil && x.Raw.Age >= 0
+			}),
+			GetFrom: ref.FieldGetter(func(target any) (any, error) {
+				x := target.(*xcel.Object[*Person])
+
+				return x.Raw.Age, nil
+			}),
+		},
+	}
+}
+
+func TestObjectConvertToType(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	obj, typ := xcel.NewObject(&Person{Name: "test", Age: -1})
+
+	xcel.RegisterObject(ta, tp, obj, typ, personFields())
+
+	t.Run("type", func(t *testing.T) {
+		out := obj.ConvertToType(types.TypeType)
+		if out != typ {
+			t.Fatalf("expected cached type %v, got %v", typ, out)
+		}
+	})
+
+	t.Run("string", func(t *testing.T) {
+		out := obj.ConvertToType(types.StringType)
+		if out != types.String(`Person{name: "test"}`) {
+			t.Fatalf("unexpected string form: %v", out)
+		}
+		if strings.Contains(string(out.(types.String)), "xcel.Object") {
+			t.Fatalf("string form leaks the wrapper type name: %v", out)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		obj, typ := xcel.NewObject(&Person{Name: "test", Age: 1}, xcel.WithJSONString())
+
+		xcel.RegisterObject(ta, tp, obj, typ, personFields())
+
+		out := obj.ConvertToType(types.StringType)
+		if out != types.String(`{"age":1,"name":"test"}`) {
+			t.Fatalf("unexpected JSON string form: %v", out)
+		}
+	})
+
+	t.Run("map", func(t *testing.T) {
+		out := obj.ConvertToType(types.MapType)
+		m, ok := out.(traits.Mapper)
+		if !ok {
+			t.Fatalf("expected map, got %v", out)
+		}
+		if m.Size() != types.Int(1) || m.Get(types.String("name")) != types.String("test") {
+			t.Fatalf("unexpected map: %v", out)
+		}
+	})
+
+	t.Run("cel", func(t *testing.T) {
+		env, err := cel.NewEnv(
+			cel.Types(typ),
+			cel.Variable("obj", typ),
+			cel.CustomTypeAdapter(ta),
+			cel.CustomTypeProvider(tp),
+			xcel.ObjectConversions(typ),
+		)
+		if err != nil {
+			t.Fatalf("failed to create CEL environment: %v", err)
+		}
+
+		ast, iss := env.Compile(`type(obj) == type(obj) && string(obj) == 'Person{name: "test"}'`)
+		if iss.Err() != nil {
+			t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		out, _, err := prg.Eval(map[string]any{"obj": obj})
+		if err != nil {
+			t.Fatalf("failed to evaluate program: %v", err)
+		}
+
+		if out != types.True {
+			t.Fatalf("expected 'true' but got '%v'", out)
+		}
+	})
+}
+
+type Address struct {
+	City string
+}
+
+func addressFields() map[string]*types.FieldType {
+	return map[string]*types.FieldType{
+		"city": {
+			Type: types.StringType,
+			IsSet: ref.FieldTester(func(target any) bool {
+				return target.(*xcel.Object[*Address]).Raw.City != ""
+			}),
+			GetFrom: ref.FieldGetter(func(target any) (any, error) {
+				return target.(*xcel.Object[*Address]).Raw.City, nil
+			}),
+		},
+	}
+}
+
+func TestUnregisterType(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	person, personType := xcel.NewObject(&Person{Name: "test"})
+	xcel.RegisterObject(ta, tp, person, personType, personFields())
+
+	example, exampleType := xcel.NewObject(&Example{Name: "test"})
+	xcel.RegisterObject(ta, tp, example, exampleType, map[string]*types.FieldType{})
+
+	_, addressType := xcel.NewObject(&Address{})
+	xcel.RegisterNestedType(tp, personType.TypeName(), addressType, addressFields())
+	xcel.RegisterNestedType(tp, exampleType.TypeName(), addressType, addressFields())
+
+	if plan := xcel.UnregisterPlan(tp, personType.TypeName()); fmt.Sprint(plan) != "[*xcel_test.Person]" {
+		t.Fatalf("unexpected plan while the nested type is shared: %v", plan)
+	}
+
+	if removed := xcel.UnregisterType(tp, ta, personType.TypeName()); fmt.Sprint(removed) != "[*xcel_test.Person]" {
+		t.Fatalf("unexpected removed types: %v", removed)
+	}
+
+	if _, ok := tp.FindStructType(personType.TypeName()); ok {
+		t.Fatal("expected person type to be removed")
+	}
+
+	if _, ok := tp.FindStructFieldType(addressType.TypeName(), "city"); !ok {
+		t.Fatal("expected shared nested type to remain registered")
+	}
+
+	if removed := xcel.UnregisterType(tp, ta, exampleType.TypeName()); fmt.Sprint(removed) != "[*xcel_test.Address *xcel_test.Example]" {
+		t.Fatalf("unexpected removed types: %v", removed)
+	}
+
+	if len(ta) != 0 || len(tp.Types) != 0 || len(tp.StructFieldTypes) != 0 {
+		t.Fatalf("expected empty adapter and provider, got %d adapter entries and %d types", len(ta), len(tp.Types))
+	}
+
+	env, err := cel.NewEnv(
+		cel.Variable("obj", personType),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	if _, iss := env.Compile("obj.name == 'test'"); iss.Err() == nil {
+		t.Fatal("expected compile error for unregistered type")
+	}
+}
+
+type Tenant struct {
+	Name string
+}
+
+type Cluster struct {
+	Tenant *Tenant
+}
+
+type Namespace struct {
+	Tenant *Tenant
+}
+
+func TestUnregisterSharedNestedType(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	cluster, clusterType := xcel.NewObject(&Cluster{})
+	xcel.RegisterObject(ta, tp, cluster, clusterType, xcel.NewFields(cluster))
+
+	namespace, namespaceType := xcel.NewObject(&Namespace{})
+	xcel.RegisterObject(ta, tp, namespace, namespaceType, xcel.NewFields(namespace))
+
+	if removed := xcel.UnregisterType(tp, ta, clusterType.TypeName()); fmt.Sprint(removed) != "[*xcel_test.Cluster]" {
+		t.Fatalf("unexpected removed types: %v", removed)
+	}
+
+	if _, ok := tp.FindStructFieldType("*xcel_test.Tenant", "name"); !ok {
+		t.Fatal("expected shared nested type to remain registered")
+	}
+
+	if _, ok := ta[reflect.TypeOf(&Tenant{})]; !ok {
+		t.Fatal("expected shared nested type to remain in the adapter")
+	}
+
+	if removed := xcel.UnregisterType(tp, ta, namespaceType.TypeName()); fmt.Sprint(removed) != "[*xcel_test.Namespace *xcel_test.Tenant]" {
+		t.Fatalf("unexpected removed types: %v", removed)
+	}
+}
+
+func TestRegisterObjectLiteralProvider(t *testing.T) {
+	ta := xcel.TypeAdapter{}
+	tp := &xcel.TypeProvider{
+		Idents:           map[string]ref.Val{},
+		Types:            map[string]*types.Type{},
+		Structs:          map[string]map[string]*types.FieldType{},
+		StructFieldTypes: map[string]map[string]*types.FieldType{},
+	}
+
+	obj, typ := xcel.NewObject(&Cluster{Tenant: &Tenant{Name: "acme"}})
+	xcel.RegisterObject(ta, tp, obj, typ, xcel.NewFields(obj))
+
+	env, err := cel.NewEnv(
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("obj.tenant.name == 'acme'")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	out, _, err := prg.Eval(map[string]any{"obj": obj})
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+
+	if removed := xcel.UnregisterType(tp, ta, typ.TypeName()); fmt.Sprint(removed) != "[*xcel_test.Cluster *xcel_test.Tenant]" {
+		t.Fatalf("unexpected removed types: %v", removed)
+	}
+}
+
+func TestTypeProviderFingerprint(t *testing.T) {
+	register := func(withAddress bool) *xcel.TypeProvider {
+		ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+		if withAddress {
+			obj, typ := xcel.NewObject(&Address{})
+			xcel.RegisterObject(ta, tp, obj, typ, addressFields())
+		}
+
+		obj, typ := xcel.NewObject(&Person{})
+		xcel.RegisterObject(ta, tp, obj, typ, personFields())
+
+		if !withAddress {
+			obj, typ := xcel.NewObject(&Address{})
+			xcel.RegisterObject(ta, tp, obj, typ, addressFields())
+		}
+
+		return tp
+	}
+
+	a, b := register(true), register(false)
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Fatalf("expected registration order to not matter: %s != %s", a.Fingerprint(), b.Fingerprint())
+	}
+
+	before := a.Fingerprint()
+
+	a.StructFieldTypes["*xcel_test.Address"]["zip"] = &types.FieldType{Type: types.StringType}
+	if a.Fingerprint() == before {
+		t.Fatal("expected fingerprint to change with the schema")
+	}
+}
+
+func TestRegisterObjectAdaptsEachValue(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	obj, typ := xcel.NewObject(&Example{Name: "prototype"})
+	xcel.RegisterObject(ta, tp, obj, typ, xcel.NewFields(obj))
+
+	env, err := cel.NewEnv(
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+		cel.Function("first_child",
+			cel.MemberOverload("Example_first_child", []*cel.Type{typ}, typ,
+				cel.UnaryBinding(func(arg ref.Val) ref.Val {
+					x := arg.(*xcel.Object[*Example])
+					// Returned as a raw Go value, adapted by the registered adapter.
+					return ta.NativeToValue(&Example{Name: x.Raw.Name + "/child", Parent: x.Raw})
+				}),
+			),
+		),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("obj.first_child().name + ' of ' + obj.first_child().parent.name")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	// Each raw value is wrapped by the adapter, rather than resolving to
+	// the object it was registered with.
+	for _, name := range []string{"a", "b", "c"} {
+		out, _, err := prg.Eval(map[string]any{"obj": &Example{Name: name}})
+		if err != nil {
+			t.Fatalf("failed to evaluate program: %v", err)
+		}
+
+		if want := name + "/child of " + name; out.Value() != want {
+			t.Fatalf("expected %q but got '%v'", want, out.Value())
+		}
+	}
+
+	if v := ta.NativeToValue(&Example{Name: "other"}); v.Type() != typ || v.(*xcel.Object[*Example]).Raw.Name != "other" {
+		t.Fatalf("expected the adapter to wrap the given value, got '%v'", v)
+	}
+}
+
+func TestRegisterTypeFor(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	typ, err := xcel.RegisterTypeFor[*Example](ta, tp)
+	if err != nil {
+		t.Fatalf("failed to register type: %v", err)
+	}
+
+	env, err := cel.NewEnv(
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("obj.name == 'test' && obj.parent.name == 'root' && 'a' in obj.tags")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	tests := []struct {
+		value *Example
+		want  bool
+	}{
+		{&Example{Name: "test", Tags: []string{"a"}, Parent: &Example{Name: "root"}}, true},
+		{&Example{Name: "test", Tags: []string{"b"}, Parent: &Example{Name: "root"}}, false},
+	}
+
+	for _, test := range tests {
+		out, _, err := prg.Eval(map[string]any{"obj": test.value})
+		if err != nil {
+			t.Fatalf("failed to evaluate program: %v", err)
+		}
+
+		if out != types.Bool(test.want) {
+			t.Fatalf("expected '%v' but got '%v'", test.want, out)
+		}
+	}
+
+	if _, err := xcel.RegisterTypeFor[Example](ta, tp); err == nil {
+		t.Fatal("expected an error for a non-pointer type")
+	}
+
+	tp.Freeze()
+	if _, err := xcel.RegisterTypeFor[*Person](ta, tp); !errors.Is(err, xcel.ErrFrozen) {
+		t.Fatalf("expected a frozen error, got: %v", err)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expected MustRegisterTypeFor to panic")
+		}
+	}()
+	xcel.MustRegisterTypeFor[*Person](ta, tp)
+}
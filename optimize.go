@@ -0,0 +1,26 @@
+package xcel
+
+import (
+	"errors"
+
+	"github.com/google/cel-go/cel"
+)
+
+// ErrOptimizerUnsupported is returned by FoldConstants and
+// Template.Specialize when xcel is built against a cel-go version without
+// the static optimizer, see compat.go.
+var ErrOptimizerUnsupported = errors.New("xcel: static optimization requires cel-go v0.18.0 or later")
+
+// FoldConstants returns a copy of the checked AST with the calls whose
+// arguments are all literals replaced by their results, using the CEL
+// constant folding optimizer.
+//
+// The functions declared by this package, such as domain_suffix, iequals,
+// and sha256, are pure functions of their arguments, so calls to them with
+// literal arguments are folded like the standard CEL functions. Functions
+// declared by users are folded the same way, so functions which depend on
+// anything but their arguments should not be used with literal arguments
+// in expressions that are folded.
+func FoldConstants(env *cel.Env, ast *cel.Ast) (*cel.Ast, error) {
+	return inlineAndFold(env, ast, nil)
+}
@@ -0,0 +1,13 @@
+//go:build xcel_celgo017
+
+package xcel
+
+import (
+	"github.com/google/cel-go/cel"
+)
+
+// inlineAndFold is not supported before cel-go v0.18.0, which introduced
+// the static optimizer.
+func inlineAndFold(env *cel.Env, ast *cel.Ast, defs map[string]*cel.Ast) (*cel.Ast, error) {
+	return nil, ErrOptimizerUnsupported
+}
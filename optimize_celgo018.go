@@ -0,0 +1,43 @@
+//go:build !xcel_celgo017
+
+package xcel
+
+import (
+	"sort"
+
+	"github.com/google/cel-go/cel"
+)
+
+// inlineAndFold returns a copy of the checked AST with the variables, or
+// selections such as params.name, replaced by the checked ASTs of their
+// definitions, and then constant folded.
+func inlineAndFold(env *cel.Env, ast *cel.Ast, defs map[string]*cel.Ast) (*cel.Ast, error) {
+	folder, err := cel.NewConstantFoldingOptimizer()
+	if err != nil {
+		return nil, err
+	}
+
+	optimizers := []cel.ASTOptimizer{folder}
+
+	if len(defs) > 0 {
+		names := make([]string, 0, len(defs))
+		for name := range defs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		vars := make([]*cel.InlineVariable, 0, len(names))
+		for _, name := range names {
+			vars = append(vars, cel.NewInlineVariable(name, defs[name]))
+		}
+
+		optimizers = append([]cel.ASTOptimizer{cel.NewInliningOptimizer(vars...)}, optimizers...)
+	}
+
+	optimized, iss := cel.NewStaticOptimizer(optimizers...).Optimize(env, ast)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+
+	return optimized, nil
+}
@@ -0,0 +1,65 @@
+package xcel_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+func TestFoldConstants(t *testing.T) {
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	obj, typ := xcel.NewObject(&Person{Name: "test"})
+	xcel.RegisterObject(ta, tp, obj, typ, personFields())
+
+	env, err := cel.NewEnv(
+		cel.Variable("obj", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+		xcel.DomainFunctions(),
+		xcel.CaseInsensitiveStrings(),
+		xcel.HashFunctions(),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile(`domain_suffix('a.example.com', 'example.com') && iequals(obj.name, 'TEST') && sha256('test').startsWith('9f86')`)
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	optimized, err := xcel.FoldConstants(env, ast)
+	if errors.Is(err, xcel.ErrOptimizerUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatalf("failed to fold constants: %v", err)
+	}
+
+	folded, err := cel.AstToString(optimized)
+	if err != nil {
+		t.Fatalf("failed to format optimized AST: %v", err)
+	}
+
+	if folded != `iequals(obj.name, "TEST")` {
+		t.Fatalf("expected literal calls to be folded, got: %s", folded)
+	}
+
+	prg, err := env.Program(optimized)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	out, _, err := prg.Eval(map[string]any{"obj": obj})
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+}
@@ -0,0 +1,302 @@
+package xcel
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Option configures optional behavior for objects created by this package.
+// Each option applies to some of the functions taking options, which report
+// the options given to them that do not apply as an error, such as
+// WithEvalTimeout given to NewFields.
+type Option func(*options)
+
+// optionScope is the set of functions an Option applies to.
+type optionScope uint8
+
+const (
+	// fieldScope options apply to the functions deriving fields, such as
+	// NewFields, RegisterAll, and RegisterConversion, and to registries,
+	// which derive fields with them.
+	fieldScope optionScope = 1 << iota
+
+	// registryScope options apply to NewRegistry and Quickstart.
+	registryScope
+
+	// evalScope options apply to EvalWithDeadline.
+	evalScope
+
+	// hashScope options apply to HashFunctions.
+	hashScope
+)
+
+// appliedOption is the name and scope of an Option given to a function,
+// see options.check.
+type appliedOption struct {
+	name  string
+	scope optionScope
+}
+
+// option returns an Option of the given name and scope applying the
+// function to the options.
+func option(name string, scope optionScope, apply func(*options)) Option {
+	return func(o *options) {
+		o.applied = append(o.applied, appliedOption{name: name, scope: scope})
+		apply(o)
+	}
+}
+
+// options holds the resolved configuration for a set of Option values.
+type options struct {
+	jsonString       bool
+	nullable         map[string]bool
+	optionalTypes    bool
+	maxHashSize      int
+	evalTimeout      time.Duration
+	costTracking     bool
+	fieldCosts       map[string]uint64
+	jsonPresence     bool
+	presence         PresencePolicy
+	presenceFunc     func(reflect.Value, reflect.StructField) bool
+	emptyUnset       bool
+	deepStructs      bool
+	maxValueSizes    map[string]valueLimit
+	traceValueSize   int
+	dynamicTypeMode  DynamicTypeMode
+	nameMappers      []NameMapper
+	typeMappers      []TypeMapper
+	lenientNumerics  bool
+	absentValues     bool
+	parsedJSON       bool
+	urlObjects       bool
+	textMarshalers   bool
+	stringerFallback bool
+	stringers        map[reflect.Type]bool
+	bigNumberStrings bool
+	impls            []reflect.Type
+	skipped          func(SkippedField)
+	embeddedPaths    bool
+	flattenDepth     int
+	maxDepth         int
+	noPromotion      bool
+	collisionRename  bool
+	includeFields    []string
+	excludeFields    []string
+	renamed          func(FieldRename)
+	clock            Clock
+
+	// applied are the options given, in order.
+	applied []appliedOption
+}
+
+// newOptions returns the resolved options for the given Option values.
+func newOptions(opts ...Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// check returns an error for each option which does not apply to the
+// function of the given name and scope, joined with errors.Join.
+func (o *options) check(fn string, scope optionScope) error {
+	var errs []error
+	for _, a := range o.applied {
+		if a.scope&scope == 0 {
+			errs = append(errs, fmt.Errorf("xcel: option %s does not apply to %s", a.name, fn))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithJSONString makes the CEL string conversion of an object, such as
+// string(obj), produce a JSON document of its set fields instead of the
+// default compact form.
+func WithJSONString() Option {
+	return option("WithJSONString", fieldScope, func(o *options) {
+		o.jsonString = true
+	})
+}
+
+// WithNullableVariables declares registry variables which resolve to null
+// when they are not supplied for an evaluation, so expressions can guard
+// against them with checks like pod != null. Their declared type is
+// unchanged, so field selection still type-checks.
+func WithNullableVariables(names ...string) Option {
+	return option("WithNullableVariables", registryScope, func(o *options) {
+		if o.nullable == nil {
+			o.nullable = map[string]bool{}
+		}
+		for _, name := range names {
+			o.nullable[name] = true
+		}
+	})
+}
+
+// WithOptionalTypes enables CEL optional types for a registry, and makes
+// absent nullable variables resolve to optional.none instead of null.
+func WithOptionalTypes() Option {
+	return option("WithOptionalTypes", registryScope, func(o *options) {
+		o.optionalTypes = true
+	})
+}
+
+// WithMaxHashSize limits the hash functions declared by HashFunctions to
+// inputs of at most n bytes, returning an error for larger values so that
+// expressions cannot spend unbounded time hashing large blobs.
+func WithMaxHashSize(n int) Option {
+	return option("WithMaxHashSize", hashScope, func(o *options) {
+		o.maxHashSize = n
+	})
+}
+
+// WithCostTracking enables tracking the actual cost of registry evaluations
+// with EvalCost. Selections of the given field names add their weight to
+// the cost, and are reported per field.
+func WithCostTracking(fieldCosts map[string]uint64) Option {
+	return option("WithCostTracking", registryScope, func(o *options) {
+		o.costTracking = true
+		o.fieldCosts = fieldCosts
+	})
+}
+
+// PresenceFromJSONTags makes fields derived with NewFields whose json tag has
+// the omitempty option, such as `json:"name,omitempty"`, unset when they are
+// empty, so has() agrees with whether the field appears in the JSON encoding.
+// See NewFields for how it composes with the cel tag.
+func PresenceFromJSONTags(enabled bool) Option {
+	return option("PresenceFromJSONTags", fieldScope, func(o *options) {
+		o.jsonPresence = enabled
+	})
+}
+
+// PresencePolicy is how has() tests the presence of fields derived with
+// NewFields, see WithPresence.
+type PresencePolicy int
+
+const (
+	// PresenceNonNil makes fields unset when they are a nil pointer,
+	// slice, map, or interface, so scalars are always set. It is the
+	// default policy.
+	PresenceNonNil PresencePolicy = iota
+
+	// PresenceNonZero also makes fields unset when they hold the zero
+	// value of their type, such as an empty string, 0, false, or a zero
+	// struct or time, like hand-written fields testing Name != "". A
+	// non-nil pointer is set even if it points to a zero value.
+	PresenceNonZero
+)
+
+// WithPresence sets the presence policy of fields derived with NewFields,
+// including fields promoted from embedded structs. The cel and json tag
+// options, such as omitempty, still apply on top of it.
+func WithPresence(policy PresencePolicy) Option {
+	return option("WithPresence", fieldScope, func(o *options) {
+		o.presence = policy
+	})
+}
+
+// WithPresenceFunc overrides the presence policy of fields derived with
+// NewFields with the given function, which is called with the value of the
+// field and its Go struct field each time has() tests it, such as to treat
+// sentinel values of certain fields as unset. The cel and json tag options
+// still apply on top of it.
+func WithPresenceFunc(isSet func(v reflect.Value, sf reflect.StructField) bool) Option {
+	return option("WithPresenceFunc", fieldScope, func(o *options) {
+		o.presenceFunc = isSet
+	})
+}
+
+// WithEmptyCollectionsUnset makes fields derived with NewFields unset when
+// they are empty slices, arrays, maps, or strings, even if they are not nil,
+// so has(obj.tags) means there are tags. Selecting such a field still
+// returns the empty value, so 'x' in obj.tags is false rather than an
+// error, unless WithAbsentValues is used too.
+func WithEmptyCollectionsUnset() Option {
+	return option("WithEmptyCollectionsUnset", fieldScope, func(o *options) {
+		o.emptyUnset = true
+	})
+}
+
+// WithDeepStructPresence makes struct and struct pointer fields derived
+// with NewFields, including embedded struct pointers, unset unless at least
+// one of the exported fields of their struct is set by the presence policy,
+// recursively, such as for config validation rules where has(obj.limits)
+// means some limit is configured. Structs converted to scalars, such as
+// time.Time, keep their presence, and structs reached again through a
+// cycle of pointers count as unset.
+func WithDeepStructPresence() Option {
+	return option("WithDeepStructPresence", fieldScope, func(o *options) {
+		o.deepStructs = true
+	})
+}
+
+// fieldPresent reports whether the value of the field is set by the
+// presence policy, see WithPresence, WithPresenceFunc,
+// WithEmptyCollectionsUnset, and WithDeepStructPresence.
+func (o *options) fieldPresent(v reflect.Value, sf reflect.StructField) bool {
+	return o.present(v, sf, nil)
+}
+
+// present is fieldPresent with the struct pointers being tested for deep
+// presence, to stop at cycles.
+func (o *options) present(v reflect.Value, sf reflect.StructField, visiting map[uintptr]bool) bool {
+	if !o.basePresent(v, sf) {
+		return false
+	}
+	if !o.deepStructs || isScalarStructType(v.Type()) {
+		return true
+	}
+
+	if v.Kind() == reflect.Pointer {
+		if v.Elem().Kind() != reflect.Struct {
+			return true
+		}
+		if visiting[v.Pointer()] {
+			return false
+		}
+		if visiting == nil {
+			visiting = map[uintptr]bool{}
+		}
+		visiting[v.Pointer()] = true
+		defer delete(visiting, v.Pointer())
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return true
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() && !f.Anonymous || isExcludedField(f) {
+			continue
+		}
+		if o.present(v.Field(i), f, visiting) {
+			return true
+		}
+	}
+	return false
+}
+
+// basePresent reports whether the value of the field is set by the presence
+// policy, regardless of WithDeepStructPresence.
+func (o *options) basePresent(v reflect.Value, sf reflect.StructField) bool {
+	if o.emptyUnset {
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map, reflect.String:
+			if v.Len() == 0 {
+				return false
+			}
+		}
+	}
+	if o.presenceFunc != nil {
+		return o.presenceFunc(v, sf)
+	}
+	if !presenceIsSet(v) {
+		return false
+	}
+	return o.presence != PresenceNonZero || !v.IsZero()
+}
@@ -0,0 +1,129 @@
+package xcel
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// Pair is a pair of related objects, such as two events correlated by a
+// rule, whose fields a and b are the objects of the Go struct pointer types
+// A and B, see RegisterPair.
+type Pair[A, B any] struct {
+	A A
+	B B
+}
+
+// PairVariable is a variable of a Pair type declared with RegisterPair.
+type PairVariable[A, B any] struct {
+	name    string
+	typ     *types.Type
+	fields  map[string]*types.FieldType
+	adapter TypeAdapter
+}
+
+// RegisterPair registers the Pair type of A and B with the registry and
+// declares a variable of that type with the given name, so an expression
+// can correlate two objects, such as pair.a.pid == pair.b.pid.
+//
+// A and B must be struct pointer types. They are registered with
+// RegisterAll unless they are already registered, and the fields of the
+// pair use their existing registrations, so the objects of a pair are
+// wrapped like any other value of their types, and only when selected.
+func RegisterPair[A, B any](reg *Registry, name string) (*PairVariable[A, B], error) {
+	var values []any
+	for _, rt := range []reflect.Type{reflect.TypeOf((*A)(nil)).Elem(), reflect.TypeOf((*B)(nil)).Elem()} {
+		if rt.Kind() != reflect.Pointer || rt.Elem().Kind() != reflect.Struct {
+			return nil, fmt.Errorf("xcel: unsupported pair type '%s', expected a struct pointer", rt)
+		}
+		values = append(values, reflect.New(rt.Elem()).Interface())
+	}
+
+	if err := RegisterAll(reg, values); err != nil {
+		return nil, err
+	}
+
+	typeA, typeB := objectTypeOf(values[0]), objectTypeOf(values[1])
+
+	fields := map[string]*types.FieldType{
+		"a": pairField(typeA, func(p *Pair[A, B]) any { return p.A }),
+		"b": pairField(typeB, func(p *Pair[A, B]) any { return p.B }),
+	}
+
+	obj, typ := NewObject(&Pair[A, B]{})
+
+	reg.mu.Lock()
+	if _, ok := reg.Provider.Types[typ.TypeName()]; !ok {
+		if err := RegisterObjectE(reg.Adapter, reg.Provider, obj, typ, fields); err != nil {
+			reg.mu.Unlock()
+			return nil, err
+		}
+	}
+	fields = reg.Provider.StructFieldTypes[typ.TypeName()]
+	reg.mu.Unlock()
+
+	reg.Variable(name, typ)
+
+	return &PairVariable[A, B]{name: name, typ: typ, fields: fields, adapter: reg.Adapter}, nil
+}
+
+// pairField returns the field type of an object of a pair.
+func pairField[A, B any](t *types.Type, get func(*Pair[A, B]) any) *types.FieldType {
+	pair := func(target any) *Pair[A, B] {
+		switch target := target.(type) {
+		case *Object[*Pair[A, B]]:
+			return target.Raw
+		case *Pair[A, B]:
+			return target
+		}
+		return nil
+	}
+
+	return &types.FieldType{
+		Type: t,
+		IsSet: ref.FieldTester(func(target any) bool {
+			p := pair(target)
+			if p == nil {
+				return false
+			}
+			v := reflect.ValueOf(get(p))
+			return v.IsValid() && !v.IsNil()
+		}),
+		GetFrom: ref.FieldGetter(func(target any) (any, error) {
+			p := pair(target)
+			if p == nil {
+				return nil, fmt.Errorf("xcel: unsupported pair value '%T'", target)
+			}
+			return get(p), nil
+		}),
+	}
+}
+
+// Name returns the name of the variable.
+func (v *PairVariable[A, B]) Name() string {
+	return v.name
+}
+
+// Type returns the CEL type of the pair.
+func (v *PairVariable[A, B]) Type() *types.Type {
+	return v.typ
+}
+
+// Wrap returns the pair of objects as a CEL value. The objects themselves
+// are wrapped when they are selected.
+func (v *PairVariable[A, B]) Wrap(a A, b B) ref.Val {
+	return &Object[*Pair[A, B]]{Raw: &Pair[A, B]{A: a, B: b}, fields: v.fields, adapter: v.adapter}
+}
+
+// Bind returns a copy of the variables with the pair variable bound to the
+// pair of objects.
+func (v *PairVariable[A, B]) Bind(a A, b B, vars map[string]any) map[string]any {
+	bound := make(map[string]any, len(vars)+1)
+	for name, value := range vars {
+		bound[name] = value
+	}
+	bound[v.name] = v.Wrap(a, b)
+	return bound
+}
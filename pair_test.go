@@ -0,0 +1,96 @@
+package xcel_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+type ProcExec struct {
+	PID     int
+	ExePath string
+}
+
+type NetConnect struct {
+	PID        int
+	RemoteAddr string
+}
+
+func TestRegisterPair(t *testing.T) {
+	reg := xcel.NewRegistry()
+
+	if err := xcel.RegisterAll(reg, []any{&ProcExec{}}); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	_, execType := xcel.NewObject(&ProcExec{})
+	execFields := reg.Provider.StructFieldTypes[execType.TypeName()]
+
+	pair, err := xcel.RegisterPair[*ProcExec, *NetConnect](reg, "pair")
+	if err != nil {
+		t.Fatalf("failed to register pair: %v", err)
+	}
+
+	if reflect.ValueOf(reg.Provider.StructFieldTypes[execType.TypeName()]).Pointer() != reflect.ValueOf(execFields).Pointer() {
+		t.Fatal("expected the existing registration to be reused")
+	}
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("has(pair.b) && pair.a.pid == pair.b.pid && pair.b.remote_addr.startsWith('10.') && pair.a.exe_path.endsWith('/curl')")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	exec := &ProcExec{PID: 42, ExePath: "/usr/bin/curl"}
+
+	tests := []struct {
+		conn *NetConnect
+		want bool
+	}{
+		{&NetConnect{PID: 42, RemoteAddr: "10.0.0.1"}, true},
+		{&NetConnect{PID: 43, RemoteAddr: "10.0.0.1"}, false},
+		{&NetConnect{PID: 42, RemoteAddr: "192.168.0.1"}, false},
+		{nil, false},
+	}
+
+	for _, test := range tests {
+		out, _, err := prg.Eval(pair.Bind(exec, test.conn, nil))
+		if err != nil {
+			t.Fatalf("failed to evaluate program for %+v: %v", test.conn, err)
+		}
+
+		if out != types.Bool(test.want) {
+			t.Fatalf("expected '%v' but got '%v' for %+v", test.want, out, test.conn)
+		}
+	}
+
+	// Registering the same pair again reuses the pair type.
+	if _, err := xcel.RegisterPair[*ProcExec, *NetConnect](reg, "other"); err != nil {
+		t.Fatalf("failed to register pair again: %v", err)
+	}
+}
+
+func TestRegisterPairErrors(t *testing.T) {
+	if _, err := xcel.RegisterPair[ProcExec, *NetConnect](xcel.NewRegistry(), "pair"); err == nil {
+		t.Fatal("expected an error for a non-pointer type")
+	}
+
+	reg := xcel.NewRegistry()
+	reg.Freeze()
+
+	if _, err := xcel.RegisterPair[*ProcExec, *NetConnect](reg, "pair"); err == nil {
+		t.Fatal("expected an error for a frozen registry")
+	}
+}
@@ -0,0 +1,475 @@
+package xcel
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// fieldStep is one step of the path from an object to a promoted field.
+type fieldStep struct {
+	// index is the index of the field in its struct.
+	index int
+
+	// name is the name of the field, which is used to resolve it instead
+	// of its index when the struct was reached through an interface, since
+	// the dynamic type of the interface may differ between values.
+	name    string
+	dynamic bool
+}
+
+// promotedField is a field of an object, possibly promoted from embedded
+// structs, along with the path to reach it.
+type promotedField struct {
+	reflect.StructField
+
+	path  []fieldStep
+	depth int
+
+	// excluded is set for fields tagged with `cel:"-"`, and for the fields
+	// promoted from embedded fields tagged so.
+	excluded bool
+}
+
+// goPath returns the dotted path of Go field names to the field.
+func (f promotedField) goPath() string {
+	names := make([]string, len(f.path))
+	for i, step := range f.path {
+		names[i] = step.name
+	}
+	return strings.Join(names, ".")
+}
+
+// promotedFields returns the fields of the struct, or pointer to struct,
+// type. Like Go, the exported fields of embedded structs are promoted, even
+// if the embedded type itself is unexported, with shallower fields hiding
+// deeper fields of the same name, and fields of the same name at the same
+// depth hiding each other.
+//
+// Promotion also continues through embedded interfaces which are not nil
+// in the sample value, other than errors, using the fields of their dynamic
+// type, and through nil ones using the fields of the implementations of the
+// interface, see WithImplementations. Such fields are resolved by name for
+// each value, see getNestedField.
+func promotedFields(rt reflect.Type, sample reflect.Value, impls []reflect.Type) []promotedField {
+	fields, _ := resolveFields(collectFields(rt, sample, nil, 0, false, impls, nil))
+	return fields
+}
+
+// ambiguousFields returns the fields of the struct type which are hidden by
+// another field of the same name at the same depth, such as the ID fields
+// of Root{A; B} where both A and B embed a Base struct with an ID field.
+// Like Go, which only rejects such selectors when they are used, they are
+// left out by promotedFields rather than rejecting the type.
+func ambiguousFields(rt reflect.Type, sample reflect.Value, impls []reflect.Type) []promotedField {
+	// reflect.VisibleFields already leaves out the fields which are
+	// ambiguous among embedded structs, so they are found separately.
+	_, ambiguous := resolveFields(embeddedFields(rt, nil, nil))
+	_, dynamic := resolveFields(collectFields(rt, sample, nil, 0, false, impls, nil))
+	return append(ambiguous, dynamic...)
+}
+
+// embeddedFields returns all the fields of the struct type and of the
+// structs it embeds, including hidden and ambiguous ones. Embedded structs
+// already on the path, which can only be reached through pointers, are not
+// walked again.
+func embeddedFields(t reflect.Type, prefix []fieldStep, onPath []reflect.Type) []promotedField {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	for _, seen := range onPath {
+		if seen == t {
+			return nil
+		}
+	}
+	onPath = append(onPath[:len(onPath):len(onPath)], t)
+
+	var fields []promotedField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if isExcludedField(sf) {
+			continue
+		}
+		path := append(prefix[:len(prefix):len(prefix)], fieldStep{index: i, name: sf.Name})
+		fields = append(fields, promotedField{StructField: sf, path: path, depth: len(prefix)})
+		if sf.Anonymous {
+			fields = append(fields, embeddedFields(sf.Type, path, onPath)...)
+		}
+	}
+	return fields
+}
+
+// resolveFields returns the candidate fields which are visible, being the
+// only shallowest field of their name, and those which are ambiguous.
+func resolveFields(candidates []promotedField) (visible, ambiguous []promotedField) {
+	shallowest := map[string]int{}
+	count := map[string]int{}
+	for _, f := range candidates {
+		d, ok := shallowest[f.Name]
+		switch {
+		case !ok || f.depth < d:
+			shallowest[f.Name] = f.depth
+			count[f.Name] = 1
+		case f.depth == d:
+			count[f.Name]++
+		}
+	}
+
+	visible = make([]promotedField, 0, len(candidates))
+	for _, f := range candidates {
+		switch {
+		case f.depth != shallowest[f.Name]:
+		case count[f.Name] == 1:
+			visible = append(visible, f)
+		default:
+			ambiguous = append(ambiguous, f)
+		}
+	}
+	return visible, ambiguous
+}
+
+// collectFields returns the visible fields of the struct type, and those
+// promoted through its embedded interfaces. Types already on the path, such
+// as a sample value held by one of its own embedded interfaces, are not
+// walked again.
+func collectFields(t reflect.Type, sample reflect.Value, prefix []fieldStep, depth int, dynamic bool, impls []reflect.Type, onPath []reflect.Type) []promotedField {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	sample = indirectValue(sample)
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	for _, seen := range onPath {
+		if seen == t {
+			return nil
+		}
+	}
+	onPath = append(onPath[:len(onPath):len(onPath)], t)
+
+	var fields []promotedField
+	for _, sf := range reflect.VisibleFields(t) {
+		path := make([]fieldStep, len(prefix), len(prefix)+len(sf.Index))
+		copy(path, prefix)
+		excluded := false
+		for i := range sf.Index {
+			step := t.FieldByIndex(sf.Index[:i+1])
+			path = append(path, fieldStep{
+				index:   sf.Index[i],
+				name:    step.Name,
+				dynamic: dynamic,
+			})
+			excluded = excluded || isExcludedField(step)
+		}
+
+		f := promotedField{StructField: sf, path: path, depth: depth + len(sf.Index) - 1, excluded: excluded}
+		fields = append(fields, f)
+
+		if excluded || !sf.Anonymous || sf.Type.Kind() != reflect.Interface || isErrorType(sf.Type) {
+			continue
+		}
+
+		if implFields := implementationFields(sf.Type, path, f.depth+1, impls, onPath); len(implFields) > 0 {
+			fields = append(fields, implFields...)
+			continue
+		}
+
+		if sample.IsValid() {
+			iv, err := getNestedField(sample, path[len(prefix):], nil)
+			if err == nil && !iv.IsNil() {
+				elem := iv.Elem()
+				fields = append(fields, collectFields(elem.Type(), elem, path, f.depth+1, true, impls, onPath)...)
+			}
+		}
+	}
+	return fields
+}
+
+// implementationFields returns the fields promoted through an embedded
+// interface from its declared implementations, see WithImplementations.
+// Fields with the same name and depth in more than one implementation are
+// included once, since they are resolved by name for each value.
+// Implementations already on the path, such as a decorator embedding the
+// interface it implements, are not walked again.
+func implementationFields(iface reflect.Type, prefix []fieldStep, depth int, impls []reflect.Type, onPath []reflect.Type) []promotedField {
+	type key struct {
+		name  string
+		depth int
+	}
+
+	var fields []promotedField
+	seen := map[key]bool{}
+	for _, impl := range impls {
+		if !impl.Implements(iface) {
+			continue
+		}
+		for _, f := range collectFields(impl, reflect.Value{}, prefix, depth, true, impls, onPath) {
+			if k := (key{f.Name, f.depth}); !seen[k] {
+				seen[k] = true
+				fields = append(fields, f)
+			}
+		}
+	}
+	return fields
+}
+
+// errNilField is returned by getNestedField for fields reached through a
+// nil pointer or interface.
+var errNilField = errors.New("xcel: field is reached through nil")
+
+// runtimeTypeError is returned by getNestedField for fields which are not
+// present, or have a different type, on the dynamic type of an embedded
+// interface than on the sample value's.
+type runtimeTypeError struct {
+	// dynamic is the dynamic value of the last interface on the path.
+	dynamic reflect.Value
+}
+
+func (e *runtimeTypeError) Error() string {
+	return fmt.Sprintf("not present on runtime type '%s'", e.dynamic.Type())
+}
+
+// getNestedField returns the field of the struct value at the path, which
+// must have the given type if it is reached through an embedded interface.
+// It returns errNilField if the field is reached through a nil pointer or
+// interface, and a *runtimeTypeError if the dynamic type of an interface on
+// the path does not have the field.
+func getNestedField(v reflect.Value, path []fieldStep, want reflect.Type) (reflect.Value, error) {
+	var dynamic reflect.Value
+	for i, step := range path {
+		if i > 0 {
+			if v.Kind() == reflect.Interface && !v.IsNil() {
+				dynamic = v.Elem()
+			}
+			v = indirectValue(v)
+			if !v.IsValid() {
+				return reflect.Value{}, errNilField
+			}
+		}
+		if !step.dynamic {
+			v = v.Field(step.index)
+			continue
+		}
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, &runtimeTypeError{dynamic: dynamic}
+		}
+		sf, ok := v.Type().FieldByName(step.name)
+		if !ok || len(sf.Index) != 1 {
+			return reflect.Value{}, &runtimeTypeError{dynamic: dynamic}
+		}
+		v = v.Field(sf.Index[0])
+	}
+	if dynamic.IsValid() && want != nil && v.Type() != want {
+		return reflect.Value{}, &runtimeTypeError{dynamic: dynamic}
+	}
+	return v, nil
+}
+
+// indirectValue returns the value with pointers and interfaces followed,
+// or the zero value if any of them is nil.
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// DynamicTypeMode is how fields promoted through an embedded interface are
+// handled when the interface holds a dynamic type without the field, or
+// with a field of a different type, see WithDynamicTypeMode.
+type DynamicTypeMode int
+
+const (
+	// DynamicTypeLenient makes such fields unset, so has() is false and
+	// selecting them is an error.
+	DynamicTypeLenient DynamicTypeMode = iota
+
+	// DynamicTypeStrict makes such fields an error, even when guarded
+	// with has(), which is true for them so the selection reports the
+	// mismatch.
+	DynamicTypeStrict
+
+	// DynamicTypeDispatch resolves such fields with the fields registered
+	// for the dynamic type with the type adapter, if any, and otherwise
+	// behaves like DynamicTypeLenient.
+	DynamicTypeDispatch
+)
+
+// WithDynamicTypeMode sets how fields derived with NewFields that are
+// promoted through embedded interfaces are handled when the dynamic type of
+// the interface differs from the one of the value the fields were derived
+// from. The default is DynamicTypeLenient.
+func WithDynamicTypeMode(mode DynamicTypeMode) Option {
+	return option("WithDynamicTypeMode", fieldScope, func(o *options) {
+		o.dynamicTypeMode = mode
+	})
+}
+
+// fieldLookup is implemented by objects to look up their registered fields.
+type fieldLookup interface {
+	lookupField(name string) (*types.FieldType, bool)
+}
+
+// dispatchField returns the object the adapter wraps the dynamic value in,
+// and its registered field with the name, if any.
+func dispatchField(adapter types.Adapter, dynamic reflect.Value, name string) (ref.Val, *types.FieldType, bool) {
+	if !dynamic.IsValid() {
+		return nil, nil, false
+	}
+	obj := adapter.NativeToValue(dynamic.Interface())
+	l, ok := obj.(fieldLookup)
+	if !ok {
+		return nil, nil, false
+	}
+	field, ok := l.lookupField(name)
+	return obj, field, ok
+}
+
+// WithEmbeddedTypePaths makes the embedded structs of objects fields too,
+// named after their type, in addition to promoting their fields, so rules
+// can spell out where a promoted field comes from, such as
+// obj.test_common_data.runtime.container_id for obj.runtime.container_id.
+// An embedded struct whose name collides with another field is skipped,
+// see WithSkippedFields.
+func WithEmbeddedTypePaths() Option {
+	return option("WithEmbeddedTypePaths", fieldScope, func(o *options) {
+		o.embeddedPaths = true
+	})
+}
+
+// WithoutPromotion makes the embedded structs of objects fields named after
+// their type, like WithEmbeddedTypePaths, without promoting their fields, so
+// fields are only selected by their full path, such as
+// obj.test_base.test_common_data.k8s.container_name. Since embedded fields
+// are never promoted, their names cannot collide.
+func WithoutPromotion() Option {
+	return option("WithoutPromotion", fieldScope, func(o *options) {
+		o.noPromotion = true
+	})
+}
+
+// FieldRename is a field given a path-qualified name by
+// WithCollisionRename, since its name collides with another field.
+type FieldRename struct {
+	// Path is the dotted path of Go field names from the object to the
+	// field, such as "Event.Runtime.ContainerID".
+	Path string
+
+	// Name is the name the field would have had, such as "container_id",
+	// and Renamed the name it has, such as "event_runtime_container_id".
+	Name    string
+	Renamed string
+}
+
+// WithCollisionRename keeps the fields whose names collide with another
+// field instead of leaving them out or failing: fields hidden by a
+// shallower field of the same name, and fields of the same depth with the
+// same name, are named after their path of Go fields instead, such as
+// obj.event_runtime_container_id for the Event.Runtime.ContainerID field
+// hidden by Runtime.ContainerID. Fields which do not collide keep their
+// names. Each renamed field is reported to the given function, if any, such
+// as to tell rule authors about them.
+func WithCollisionRename(report func(FieldRename)) Option {
+	return option("WithCollisionRename", fieldScope, func(o *options) {
+		o.collisionRename, o.renamed = true, report
+	})
+}
+
+// renameCollisions returns the fields of the struct type hidden by the
+// visible candidate fields or ambiguous, and the path-qualified names by Go
+// path of the fields which collide with another, see WithCollisionRename.
+func (b *fieldsBuilder) renameCollisions(rt reflect.Type, candidates []promotedField) ([]promotedField, map[string]string) {
+	visible := map[string]bool{}
+	for _, pf := range candidates {
+		visible[pf.goPath()] = true
+	}
+
+	var hidden []promotedField
+	for _, pf := range embeddedFields(rt, nil, nil) {
+		if pf.IsExported() && !(pf.Anonymous && isStructType(pf.Type)) && !visible[pf.goPath()] {
+			hidden = append(hidden, pf)
+		}
+	}
+
+	all := append(candidates[:len(candidates):len(candidates)], hidden...)
+
+	names := make([]string, len(all))
+	shallowest, count := map[string]int{}, map[string]int{}
+	for i, pf := range all {
+		goPath := make([]string, len(pf.path))
+		for j, step := range pf.path {
+			goPath[j] = step.name
+		}
+		names[i] = b.o.fieldName(goPath, pf.StructField)
+
+		d, ok := shallowest[names[i]]
+		switch {
+		case !ok || pf.depth < d:
+			shallowest[names[i]], count[names[i]] = pf.depth, 1
+		case pf.depth == d:
+			count[names[i]]++
+		}
+	}
+
+	renamed := map[string]string{}
+	for i, pf := range all {
+		if pf.depth == shallowest[names[i]] && count[names[i]] == 1 {
+			continue
+		}
+
+		words := make([]string, len(pf.path))
+		for j, step := range pf.path {
+			words[j] = ToSnakeCase(step.name)
+		}
+		rename := FieldRename{Path: pf.goPath(), Name: names[i], Renamed: strings.Join(words, "_")}
+
+		renamed[rename.Path] = rename.Renamed
+		if b.o.renamed != nil {
+			b.o.renamed(rename)
+		}
+	}
+
+	return hidden, renamed
+}
+
+// WithFlattenNested also derives flattened fields for the fields of nested
+// objects up to the given depth, named after the field they are nested in,
+// such as obj.runtime_container_id for obj.runtime.container_id, for tools
+// which only complete top-level fields. A flattened field is unset when any
+// object on its path is nil. NewFields panics if a flattened name collides
+// with another field.
+func WithFlattenNested(depth int) Option {
+	return option("WithFlattenNested", fieldScope, func(o *options) {
+		o.flattenDepth = depth
+	})
+}
+
+// WithImplementations declares the types, given as sample values such as
+// (*PodEvent)(nil), which interfaces may hold. Fields derived with
+// NewFields are promoted through an embedded interface from each of the
+// types implementing it, rather than from the value it holds in the object
+// the fields are derived from, so obj.namespace compiles for a struct
+// embedding a K8sEvent interface even from a zero-value prototype. Which of
+// them a value has is resolved when the field is accessed, and fields of the
+// other implementations are unset, see WithDynamicTypeMode.
+//
+// The implementations are also registered as nested objects of interface
+// fields and of slices and maps of interfaces, so obj.event.pid selects the
+// field of an Event field holding a *Process.
+func WithImplementations(samples ...any) Option {
+	return option("WithImplementations", fieldScope, func(o *options) {
+		for _, sample := range samples {
+			o.impls = append(o.impls, reflect.TypeOf(sample))
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package xcel
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// protoMessageType is the reflect type of proto.Message.
+var protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// isProtoType reports whether the type is a generated protobuf message type.
+func isProtoType(t reflect.Type) bool {
+	return t.Kind() == reflect.Pointer && t.Implements(protoMessageType)
+}
+
+// protoFieldType returns the CEL type and conversion of a protobuf message
+// field, which is the message's proto type. Field selection on the message
+// is delegated to cel-go's protobuf support, see RegisterProtoType.
+func (b *fieldsBuilder) protoFieldType(t reflect.Type) (*types.Type, ConvertFunc) {
+	msg := reflect.Zero(t).Interface().(proto.Message)
+	b.protos = append(b.protos, msg)
+
+	typ := cel.ObjectType(string(msg.ProtoReflect().Descriptor().FullName()))
+
+	return typ, func(v reflect.Value) (any, error) {
+		if v.IsNil() {
+			return types.NullValue, nil
+		}
+		return v.Interface(), nil
+	}
+}
+
+// RegisterProtoType registers the protobuf message type, along with the
+// other messages of its file and their dependencies, with the type adapter
+// and type provider. Their fields are resolved by cel-go's protobuf support
+// with proto semantics, such as obj.spec.containers[0].image for a field of
+// type *pb.PodSpec. RegisterObject registers the message types of the fields
+// derived with NewFields.
+func RegisterProtoType(ta TypeAdapter, tp *TypeProvider, msg proto.Message) error {
+	name := string(msg.ProtoReflect().Descriptor().FullName())
+
+	if tp.Frozen() {
+		return fmt.Errorf("%w: cannot register proto type '%s'", ErrFrozen, name)
+	}
+
+	if tp.protos == nil {
+		reg, err := types.NewRegistry()
+		if err != nil {
+			return err
+		}
+		tp.protos = reg
+	}
+
+	if err := tp.protos.RegisterMessage(msg); err != nil {
+		return fmt.Errorf("xcel: failed to register proto type '%s': %w", name, err)
+	}
+
+	ta[protoAdapterType] = tp.protos.NativeToValue
+
+	return nil
+}
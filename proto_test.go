@@ -0,0 +1,83 @@
+package xcel_test
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+type PolicyRecord struct {
+	Name   string
+	Parsed *exprpb.ParsedExpr
+}
+
+func TestFieldsProtoMessages(t *testing.T) {
+	reg := xcel.NewRegistry()
+
+	if err := xcel.RegisterAll(reg, []any{&PolicyRecord{}}); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	_, typ := xcel.NewObject(&PolicyRecord{})
+	reg.Variable("obj", typ)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	record := &PolicyRecord{
+		Name: "sum",
+		Parsed: &exprpb.ParsedExpr{
+			Expr: &exprpb.Expr{
+				ExprKind: &exprpb.Expr_CallExpr{
+					CallExpr: &exprpb.Expr_Call{
+						Function: "_+_",
+						Args: []*exprpb.Expr{
+							{ExprKind: &exprpb.Expr_IdentExpr{IdentExpr: &exprpb.Expr_Ident{Name: "a"}}},
+						},
+					},
+				},
+			},
+			SourceInfo: &exprpb.SourceInfo{Location: "sum.cel"},
+		},
+	}
+
+	tests := []struct {
+		expr   string
+		record *PolicyRecord
+		want   bool
+	}{
+		{"obj.name == 'sum' && obj.parsed.source_info.location == 'sum.cel'", record, true},
+		{"obj.parsed.expr.call_expr.function == '_+_'", record, true},
+		{"obj.parsed.expr.call_expr.args[0].ident_expr.name == 'a'", record, true},
+		{"has(obj.parsed.expr.call_expr) && !has(obj.parsed.expr.ident_expr)", record, true},
+		{"has(obj.parsed)", &PolicyRecord{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			ast, iss := env.Compile(test.expr)
+			if iss.Err() != nil {
+				t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			out, _, err := prg.Eval(map[string]any{"obj": test.record})
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package xcel
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// Quick is a ready to use environment for expressions over a single variable
+// of the Go struct pointer type T, see Quickstart.
+type Quick[T any] struct {
+	reg     *Registry
+	env     *cel.Env
+	typ     *types.Type
+	varName string
+}
+
+// Quickstart registers the Go struct pointer type T with a new registry
+// created with the given options, deriving its fields with NewFields (see
+// RegisterAll), and creates an environment with the registry's environment
+// options and a variable of type T with the given name.
+func Quickstart[T any](varName string, opts ...Option) (*Quick[T], error) {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	if rt.Kind() != reflect.Pointer || rt.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("xcel: unsupported quickstart type '%s', expected a struct pointer", rt)
+	}
+
+	reg := NewRegistry(opts...)
+
+	if err := RegisterAll(reg, []any{reflect.New(rt.Elem()).Interface()}); err != nil {
+		return nil, err
+	}
+
+	typ := objectTypeOf(reflect.Zero(rt).Interface())
+
+	reg.Variable(varName, typ)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Quick[T]{reg: reg, env: env, typ: typ, varName: varName}, nil
+}
+
+// Registry returns the registry T is registered with.
+func (q *Quick[T]) Registry() *Registry {
+	return q.reg
+}
+
+// Env returns the CEL environment expressions are compiled with.
+func (q *Quick[T]) Env() *cel.Env {
+	return q.env
+}
+
+// Provider returns the type provider T is registered with.
+func (q *Quick[T]) Provider() *TypeProvider {
+	return q.reg.Provider
+}
+
+// Type returns the CEL type of T.
+func (q *Quick[T]) Type() *types.Type {
+	return q.typ
+}
+
+// Compile compiles the expression and creates a program for it with the
+// registry's program options.
+func (q *Quick[T]) Compile(expr string) (*QuickProgram[T], error) {
+	ast, iss := q.env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+
+	prg, err := q.env.Program(ast, q.reg.ProgramOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QuickProgram[T]{q: q, ast: ast, prg: prg}, nil
+}
+
+// MustCompile is like Compile, but panics if the expression cannot be
+// compiled, for expressions known to be valid such as constants.
+func (q *Quick[T]) MustCompile(expr string) *QuickProgram[T] {
+	p, err := q.Compile(expr)
+	if err != nil {
+		panic(fmt.Sprintf("xcel: failed to compile %q: %v", expr, err))
+	}
+	return p
+}
+
+// QuickProgram is a program compiled by Quick.Compile.
+type QuickProgram[T any] struct {
+	q   *Quick[T]
+	ast *cel.Ast
+	prg cel.Program
+}
+
+// Ast returns the checked AST of the program's expression.
+func (p *QuickProgram[T]) Ast() *cel.Ast {
+	return p.ast
+}
+
+// Program returns the underlying CEL program.
+func (p *QuickProgram[T]) Program() cel.Program {
+	return p.prg
+}
+
+// Eval evaluates the program with the variable bound to the given value.
+func (p *QuickProgram[T]) Eval(v T) (ref.Val, error) {
+	out, _, err := p.q.reg.Eval(p.prg, map[string]any{p.q.varName: p.q.reg.Adapter.NativeToValue(v)})
+	return out, err
+}
@@ -0,0 +1,82 @@
+package xcel_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+func ExampleQuickstart() {
+	type Person struct {
+		Name string
+		Age  int
+	}
+
+	q, _ := xcel.Quickstart[*Person]("obj")
+
+	out, _ := q.MustCompile("obj.name == 'test' && obj.age > 0").Eval(&Person{Name: "test", Age: -1})
+
+	fmt.Println(out.Value())
+	// Output: false
+}
+
+func TestQuickstart(t *testing.T) {
+	q, err := xcel.Quickstart[*ExecEvent]("event")
+	if err != nil {
+		t.Fatalf("failed to create quickstart: %v", err)
+	}
+
+	prg, err := q.Compile("event.exe_path.startsWith('/usr/bin/') && size(event.args) > 0")
+	if err != nil {
+		t.Fatalf("failed to compile CEL expression: %v", err)
+	}
+
+	tests := []struct {
+		event *ExecEvent
+		want  bool
+	}{
+		{&ExecEvent{ExePath: "/usr/bin/curl", Args: []string{"-s"}}, true},
+		{&ExecEvent{ExePath: "/usr/bin/curl"}, false},
+		{&ExecEvent{ExePath: "/bin/sh", Args: []string{"-c"}}, false},
+	}
+
+	for _, test := range tests {
+		out, err := prg.Eval(test.event)
+		if err != nil {
+			t.Fatalf("failed to evaluate program for %+v: %v", test.event, err)
+		}
+
+		if out != types.Bool(test.want) {
+			t.Fatalf("expected '%v' but got '%v' for %+v", test.want, out, test.event)
+		}
+	}
+
+	if _, ok := q.Provider().Types[q.Type().TypeName()]; !ok {
+		t.Fatalf("expected '%s' to be registered", q.Type().TypeName())
+	}
+}
+
+func TestQuickstartErrors(t *testing.T) {
+	if _, err := xcel.Quickstart[ExecEvent]("event"); err == nil {
+		t.Fatal("expected an error for a non-pointer type")
+	}
+
+	q, err := xcel.Quickstart[*ExecEvent]("event")
+	if err != nil {
+		t.Fatalf("failed to create quickstart: %v", err)
+	}
+
+	if _, err := q.Compile("event.missing"); err == nil {
+		t.Fatal("expected a compile error for an unknown field")
+	}
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "event.missing") {
+			t.Fatalf("expected MustCompile to panic but got '%v'", r)
+		}
+	}()
+	q.MustCompile("event.missing")
+}
@@ -0,0 +1,249 @@
+package xcel
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter"
+)
+
+// Registry bundles a type adapter and type provider with the variables
+// declared against them, producing the CEL environment options and the
+// activations needed to evaluate expressions over registered objects.
+type Registry struct {
+	Adapter  TypeAdapter
+	Provider *TypeProvider
+
+	mu   sync.Mutex
+	vars map[string]*types.Type
+	opts *options
+}
+
+// NewRegistry returns a new registry with an empty type adapter and type
+// provider. Options which do not apply to registries, such as
+// WithEvalTimeout, are reported as an error by the environment options
+// returned by EnvOptions.
+func NewRegistry(opts ...Option) *Registry {
+	return &Registry{
+		Adapter:  NewTypeAdapter(),
+		Provider: NewTypeProvider(),
+		vars:     map[string]*types.Type{},
+		opts:     newOptions(opts...),
+	}
+}
+
+// RegisterAll registers the object types of the given Go struct pointer
+// values with the registry. Fields are derived with NewFields for several
+// values concurrently, and then registered in the order of the values under
+// the registry's lock, so the result does not depend on scheduling. Values
+// of a type that is already registered are skipped, and the errors for
+// all values that cannot be registered are returned together.
+//
+// The name and type mappers given to NewRegistry (see WithNameMapper and
+// WithTypeMapper) are consulted after those given to RegisterAll.
+func RegisterAll(reg *Registry, values []any, opts ...Option) error {
+	type result struct {
+		obj    *Object[any]
+		typ    *types.Type
+		fields map[string]*types.FieldType
+		err    error
+	}
+
+	if err := newOptions(opts...).check("RegisterAll", fieldScope); err != nil {
+		return err
+	}
+
+	opts = append(opts, reg.opts.fieldOptions())
+
+	results := make([]result, len(values))
+
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.GOMAXPROCS(0), len(values)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				r := &results[i]
+				r.obj, r.typ, r.fields, r.err = deriveObject(values[i], opts...)
+			}
+		}()
+	}
+	for i := range values {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	var errs []error
+	for _, r := range results {
+		if r.err != nil {
+			errs = append(errs, r.err)
+			continue
+		}
+		if _, ok := reg.Provider.Types[r.typ.TypeName()]; ok {
+			continue
+		}
+		if err := RegisterObjectE(reg.Adapter, reg.Provider, r.obj, r.typ, r.fields); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Freeze freezes the registry's type provider, and with it the type
+// adapter, so types can no longer be registered with it, see
+// TypeProvider.Freeze. RegisterAll
+// returns an error wrapping ErrFrozen for values of types which are not
+// already registered.
+func (r *Registry) Freeze() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Provider.Freeze()
+}
+
+// Frozen reports whether the registry has been frozen, see Freeze.
+func (r *Registry) Frozen() bool {
+	return r.Provider.Frozen()
+}
+
+// deriveObject wraps the Go value and derives its fields, returning
+// an error instead of panicking for values that are not supported.
+func deriveObject(value any, opts ...Option) (*Object[any], *types.Type, map[string]*types.FieldType, error) {
+	rt := reflect.TypeOf(value)
+	if rt == nil || rt.Kind() != reflect.Pointer || rt.Elem().Kind() != reflect.Struct {
+		return nil, nil, nil, fmt.Errorf("xcel: unsupported value type '%T', expected a struct pointer", value)
+	}
+
+	obj, typ := NewObject(value, opts...)
+
+	fields, err := NewFieldsE(obj, opts...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return obj, typ, fields, nil
+}
+
+// Variable declares a variable of the given type for expressions
+// compiled with the registry's environment options.
+//
+// To evaluate one expression against values of different registered object
+// types, declare the variable as types.DynType. Field selection is then
+// resolved against the fields registered for the runtime type of the value,
+// and has() is false for fields that type does not have. This trades compile
+// time checking of field names and types for flexibility: a misspelled field
+// is only reported when it is selected at runtime.
+func (r *Registry) Variable(name string, t *types.Type) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.vars[name] = t
+}
+
+// EnvOptions returns the CEL environment options for the registry's type
+// adapter, type provider, and declared variables, along with the functions
+// declared by TimeFunctions with the registry's clock.
+func (r *Registry) EnvOptions() []cel.EnvOption {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var envOpts []cel.EnvOption
+
+	if err := r.opts.check("NewRegistry", fieldScope|registryScope); err != nil {
+		envOpts = append(envOpts, func(*cel.Env) (*cel.Env, error) {
+			return nil, err
+		})
+	}
+
+	// Optional types must be declared before the custom type provider,
+	// since declaring them registers types with the default provider.
+	if r.opts.optionalTypes {
+		envOpts = append(envOpts, cel.OptionalTypes())
+	}
+
+	envOpts = append(envOpts,
+		cel.CustomTypeAdapter(r.Adapter),
+		cel.CustomTypeProvider(r.Provider),
+	)
+
+	if r.opts.lenientNumerics {
+		envOpts = append(envOpts, lenientNumericOptions()...)
+	}
+
+	envOpts = append(envOpts, TimeFunctions(r.Clock()))
+
+	names := make([]string, 0, len(r.vars))
+	for name := range r.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		envOpts = append(envOpts, cel.Variable(name, r.vars[name]))
+	}
+
+	return envOpts
+}
+
+// Activation returns an activation for the given variables. Nullable
+// variables (see WithNullableVariables) that are not supplied resolve to
+// null, or to optional.none when WithOptionalTypes is used.
+func (r *Registry) Activation(vars map[string]any) (interpreter.Activation, error) {
+	act, err := interpreter.NewActivation(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(r.opts.nullable) == 0 {
+		return act, nil
+	}
+
+	var absent ref.Val = types.NullValue
+	if r.opts.optionalTypes {
+		absent = types.OptionalNone
+	}
+
+	return &nullableActivation{Activation: act, nullable: r.opts.nullable, absent: absent}, nil
+}
+
+// Eval evaluates the program against the given variables using the
+// registry's activation rules.
+func (r *Registry) Eval(prg cel.Program, vars map[string]any) (ref.Val, *cel.EvalDetails, error) {
+	act, err := r.Activation(vars)
+	if err != nil {
+		return nil, nil, err
+	}
+	return prg.Eval(act)
+}
+
+// nullableActivation resolves absent nullable variables to a fixed value.
+type nullableActivation struct {
+	interpreter.Activation
+
+	nullable map[string]bool
+	absent   ref.Val
+}
+
+// ResolveName implements the interpreter.Activation interface.
+func (a *nullableActivation) ResolveName(name string) (any, bool) {
+	if v, ok := a.Activation.ResolveName(name); ok {
+		return v, true
+	}
+	if a.nullable[name] {
+		return a.absent, true
+	}
+	return nil, false
+}
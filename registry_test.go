@@ -0,0 +1,533 @@
+package xcel_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+func TestRegistryNullableVariables(t *testing.T) {
+	reg := xcel.NewRegistry(xcel.WithNullableVariables("person"))
+
+	obj, typ := xcel.NewObject(&Person{Name: "test", Age: 1})
+
+	xcel.RegisterObject(reg.Adapter, reg.Provider, obj, typ, personFields())
+
+	reg.Variable("person", typ)
+	reg.Variable("host", types.StringType)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("person == null || person.name == 'test'")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	for _, vars := range []map[string]any{
+		{"person": obj},
+		{},
+	} {
+		out, _, err := reg.Eval(prg, vars)
+		if err != nil {
+			t.Fatalf("failed to evaluate program with %v: %v", vars, err)
+		}
+		if out != types.True {
+			t.Fatalf("expected 'true' but got '%v' for %v", out, vars)
+		}
+	}
+
+	ast, iss = env.Compile("host == 'localhost'")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err = env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	if _, _, err := reg.Eval(prg, map[string]any{}); err == nil {
+		t.Fatal("expected error for absent variable that is not nullable")
+	}
+}
+
+func TestRegistryNullableVariablesOptional(t *testing.T) {
+	reg := xcel.NewRegistry(xcel.WithNullableVariables("person"), xcel.WithOptionalTypes())
+
+	obj, typ := xcel.NewObject(&Person{Name: "test", Age: 1})
+
+	xcel.RegisterObject(reg.Adapter, reg.Provider, obj, typ, personFields())
+
+	reg.Variable("person", typ)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("person.?name.orValue('none')")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	for vars, want := range map[*map[string]any]types.String{
+		{"person": obj}: "test",
+		{}:              "none",
+	} {
+		out, _, err := reg.Eval(prg, *vars)
+		if err != nil {
+			t.Fatalf("failed to evaluate program with %v: %v", *vars, err)
+		}
+		if out != want {
+			t.Fatalf("expected %q but got '%v'", want, out)
+		}
+	}
+}
+
+func TestRegisterAll(t *testing.T) {
+	values := []any{&Person{}, &Address{}, &Example{}, &Person{}}
+
+	a := xcel.NewRegistry()
+	if err := xcel.RegisterAll(a, values); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	b := xcel.NewRegistry()
+	if err := xcel.RegisterAll(b, []any{values[2], values[1], values[0]}); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	if len(a.Provider.Types) != 3 {
+		t.Fatalf("expected 3 registered types, got %d", len(a.Provider.Types))
+	}
+
+	if a.Provider.Fingerprint() != b.Provider.Fingerprint() {
+		t.Fatal("expected identical fingerprints regardless of registration order")
+	}
+
+	_, typ := xcel.NewObject(&Person{})
+	a.Variable("person", typ)
+
+	env, err := cel.NewEnv(a.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("person.name == 'test'")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	out, _, err := a.Eval(prg, map[string]any{"person": &Person{Name: "test"}})
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+}
+
+func TestRegisterAllErrors(t *testing.T) {
+	reg := xcel.NewRegistry()
+
+	err := xcel.RegisterAll(reg, []any{&Person{}, "invalid", nil})
+	if err == nil {
+		t.Fatal("expected error for unsupported values")
+	}
+
+	if got := strings.Count(err.Error(), "unsupported value type"); got != 2 {
+		t.Fatalf("expected both errors to be reported, got: %v", err)
+	}
+
+	if len(reg.Provider.Types) != 1 {
+		t.Fatalf("expected valid types to still be registered, got %d", len(reg.Provider.Types))
+	}
+}
+
+type ExecEvent struct {
+	ExePath string
+	Args    []string
+}
+
+type DNSEvent struct {
+	DNSQuery string
+}
+
+type FileEvent struct {
+	Path string
+}
+
+func TestRegistryDynVariable(t *testing.T) {
+	reg := xcel.NewRegistry()
+
+	if err := xcel.RegisterAll(reg, []any{&ExecEvent{}, &DNSEvent{}, &FileEvent{}}); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	reg.Variable("obj", types.DynType)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("(has(obj.exe_path) && obj.exe_path.contains('nc')) || (has(obj.dns_query) && obj.dns_query.endsWith('.evil.com'))")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	tests := []struct {
+		event any
+		want  types.Bool
+	}{
+		{&ExecEvent{ExePath: "/usr/bin/nc"}, true},
+		{&ExecEvent{ExePath: "/usr/bin/ls"}, false},
+		{&DNSEvent{DNSQuery: "c2.evil.com"}, true},
+		{&DNSEvent{DNSQuery: "example.com"}, false},
+		{&FileEvent{Path: "/etc/passwd"}, false},
+	}
+
+	for _, test := range tests {
+		out, _, err := reg.Eval(prg, map[string]any{"obj": test.event})
+		if err != nil {
+			t.Fatalf("failed to evaluate program for %#v: %v", test.event, err)
+		}
+		if out != test.want {
+			t.Errorf("expected %v for %#v but got '%v'", test.want, test.event, out)
+		}
+	}
+
+	ast, iss = env.Compile("obj.dns_query == 'example.com'")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err = env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	if _, _, err := reg.Eval(prg, map[string]any{"obj": &FileEvent{}}); err == nil || !strings.Contains(err.Error(), "no such field") {
+		t.Fatalf("expected missing field error, got: %v", err)
+	}
+}
+
+func TestRegistryFreeze(t *testing.T) {
+	reg := xcel.NewRegistry()
+
+	if err := xcel.RegisterAll(reg, []any{&ExecEvent{}}); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	reg.Freeze()
+
+	if !reg.Frozen() || !reg.Provider.Frozen() {
+		t.Fatal("expected the registry to be frozen")
+	}
+
+	if _, ok := reg.Adapter.NativeToValue(&ExecEvent{}).(*xcel.Object[any]); !ok {
+		t.Fatal("expected the frozen adapter to still wrap registered values")
+	}
+
+	if xcel.NewTypeProvider().Frozen() {
+		t.Fatal("expected a new type provider not to be frozen")
+	}
+
+	entries := len(reg.Adapter)
+
+	// Registered types are skipped as before.
+	if err := xcel.RegisterAll(reg, []any{&ExecEvent{}}); err != nil {
+		t.Fatalf("failed to register already registered types: %v", err)
+	}
+
+	err := xcel.RegisterAll(reg, []any{&DNSEvent{}})
+	if !errors.Is(err, xcel.ErrFrozen) {
+		t.Fatalf("expected a frozen error but got '%v'", err)
+	}
+
+	if _, ok := reg.Provider.Types["*xcel_test.DNSEvent"]; ok {
+		t.Fatal("expected the late type not to be registered")
+	}
+
+	func() {
+		defer func() {
+			r := recover()
+			if err, ok := r.(error); !ok || !errors.Is(err, xcel.ErrFrozen) {
+				t.Fatalf("expected a frozen panic but got '%v'", r)
+			}
+		}()
+		obj, typ := xcel.NewObject(&FileEvent{})
+		xcel.RegisterObject(reg.Adapter, reg.Provider, obj, typ, xcel.NewFields(obj))
+	}()
+
+	if len(reg.Adapter) != entries {
+		t.Fatalf("expected the adapter not to be modified but got %d entries", len(reg.Adapter))
+	}
+
+	_, typ := xcel.NewObject(&ExecEvent{})
+
+	err = xcel.RegisterComputedField(reg.Adapter, reg.Provider, typ.TypeName(), "x", xcel.ComputedField{Type: types.StringType})
+	if !errors.Is(err, xcel.ErrFrozen) {
+		t.Fatalf("expected a frozen error but got '%v'", err)
+	}
+
+	names, ok := reg.Provider.FindStructFieldNames(typ.TypeName())
+	if !ok || len(names) == 0 || !sort.StringsAreSorted(names) {
+		t.Fatalf("expected the sorted field names but got %v", names)
+	}
+
+	// Evaluation is unaffected.
+	reg.Variable("event", typ)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("event.exe_path == '/bin/sh'")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	out, _, err := reg.Eval(prg, map[string]any{"event": &ExecEvent{ExePath: "/bin/sh"}})
+	if err != nil || out != types.True {
+		t.Fatalf("expected 'true' but got '%v' (%v)", out, err)
+	}
+}
+
+func BenchmarkFindStructFieldNames(b *testing.B) {
+	for _, frozen := range []bool{false, true} {
+		b.Run(fmt.Sprintf("frozen=%v", frozen), func(b *testing.B) {
+			reg := xcel.NewRegistry()
+
+			if err := xcel.RegisterAll(reg, []any{&Example{}}); err != nil {
+				b.Fatalf("failed to register types: %v", err)
+			}
+
+			if frozen {
+				reg.Freeze()
+			}
+
+			_, typ := xcel.NewObject(&Example{})
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				reg.Provider.FindStructFieldNames(typ.TypeName())
+			}
+		})
+	}
+}
+
+func TestRegisterAllRegistryFieldOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		opt    xcel.Option
+		sample any
+		value  any
+		expr   string
+		want   any
+		err    string
+	}{
+		{
+			name:   "presence from json tags",
+			opt:    xcel.PresenceFromJSONTags(true),
+			sample: &Profile{},
+			value:  &Profile{},
+			expr:   "has(obj.nickname) || has(obj.name)",
+			want:   false,
+		},
+		{
+			name:   "max value size",
+			opt:    xcel.WithMaxValueSize("command_line", 4, xcel.TruncateOversize),
+			sample: &Capture{},
+			value:  &Capture{CommandLine: "curl https://example.com"},
+			expr:   "obj.command_line",
+			want:   "curl" + xcel.TruncationMarker,
+		},
+		{
+			name:   "dynamic type mode",
+			opt:    xcel.WithDynamicTypeMode(xcel.DynamicTypeStrict),
+			sample: &Envelope{Source: &Process{}},
+			value:  &Envelope{Source: &Job{}},
+			expr:   "has(obj.region) ? obj.region : 'none'",
+			err:    "xcel: field 'region' not present on runtime type '*xcel_test.Job'",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reg := xcel.NewRegistry(test.opt)
+
+			if err := xcel.RegisterAll(reg, []any{test.sample}); err != nil {
+				t.Fatalf("failed to register types: %v", err)
+			}
+
+			_, typ := xcel.NewObject(test.sample)
+			reg.Variable("obj", typ)
+
+			env, err := cel.NewEnv(reg.EnvOptions()...)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			ast, iss := env.Compile(test.expr)
+			if iss.Err() != nil {
+				t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+			}
+
+			prg, err := env.Program(ast)
+			if err != nil {
+				t.Fatalf("failed to create CEL program: %v", err)
+			}
+
+			out, _, err := reg.Eval(prg, map[string]any{"obj": test.value})
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got: %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out.Value() != test.want {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}
+
+func TestRegisterAllSharedNestedTypes(t *testing.T) {
+	reg := xcel.NewRegistry()
+
+	upper := func(goPath []string, sf reflect.StructField) string {
+		return strings.ToUpper(sf.Name)
+	}
+
+	if err := xcel.RegisterAll(reg, []any{&Tenant{}}, xcel.WithNameMapper(upper)); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	if err := xcel.RegisterAll(reg, []any{&Cluster{}, &Namespace{}}); err != nil {
+		t.Fatalf("failed to register types: %v", err)
+	}
+
+	if _, ok := reg.Provider.FindStructFieldType("*xcel_test.Tenant", "NAME"); !ok {
+		t.Fatal("expected the registered fields of the shared nested type to be kept")
+	}
+
+	if _, ok := reg.Provider.FindStructFieldType("*xcel_test.Tenant", "name"); ok {
+		t.Fatal("expected the shared nested type not to be registered again")
+	}
+
+	xcel.UnregisterType(reg.Provider, reg.Adapter, "*xcel_test.Cluster")
+	xcel.UnregisterType(reg.Provider, reg.Adapter, "*xcel_test.Namespace")
+
+	if _, ok := reg.Provider.FindStructFieldType("*xcel_test.Tenant", "NAME"); !ok {
+		t.Fatal("expected the directly registered type to remain registered")
+	}
+}
+
+func TestOptionsNotApplying(t *testing.T) {
+	obj, _ := xcel.NewObject(&Person{})
+	_, err := xcel.NewFieldsE(obj, xcel.WithEvalTimeout(time.Second), xcel.WithPresence(xcel.PresenceNonZero))
+	if err == nil || err.Error() != "xcel: option WithEvalTimeout does not apply to NewFields" {
+		t.Fatalf("expected an option error, got: %v", err)
+	}
+
+	err = xcel.RegisterAll(xcel.NewRegistry(), []any{&Person{}}, xcel.WithClock(time.Now))
+	if err == nil || !strings.Contains(err.Error(), "option WithClock does not apply to RegisterAll") {
+		t.Fatalf("expected an option error, got: %v", err)
+	}
+
+	_, err = cel.NewEnv(xcel.HashFunctions(xcel.WithMaxHashSize(8), xcel.WithAbsentValues()))
+	if err == nil || !strings.Contains(err.Error(), "option WithAbsentValues does not apply to HashFunctions") {
+		t.Fatalf("expected an option error, got: %v", err)
+	}
+
+	reg := xcel.NewRegistry(xcel.WithClock(time.Now), xcel.WithAbsentValues(), xcel.WithMaxHashSize(8))
+	_, err = cel.NewEnv(reg.EnvOptions()...)
+	if err == nil || !strings.Contains(err.Error(), "option WithMaxHashSize does not apply to NewRegistry") {
+		t.Fatalf("expected an option error, got: %v", err)
+	}
+}
+
+func TestRegistryFrozenProvider(t *testing.T) {
+	reg := xcel.NewRegistry()
+	reg.Provider.Freeze()
+
+	if !reg.Frozen() {
+		t.Fatal("expected the registry to be frozen with its provider")
+	}
+
+	for i := 0; i < 2; i++ {
+		err := xcel.RegisterAll(reg, []any{&ExecEvent{}})
+		if !errors.Is(err, xcel.ErrFrozen) || !strings.Contains(err.Error(), "with the type provider") {
+			t.Fatalf("expected a frozen provider error but got '%v'", err)
+		}
+	}
+
+	if len(reg.Adapter) != 0 {
+		t.Fatalf("expected the adapter not to be written, got %d entries", len(reg.Adapter))
+	}
+}
+
+func TestRegistryConcurrentVariables(t *testing.T) {
+	reg := xcel.NewRegistry()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			reg.Variable(fmt.Sprintf("v%d", i), types.StringType)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		reg.EnvOptions()
+	}
+	<-done
+
+	if n := len(reg.EnvOptions()); n < 100 {
+		t.Fatalf("expected the declared variables in the environment options, got %d options", n)
+	}
+}
@@ -0,0 +1,105 @@
+package xcel
+
+import (
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter"
+)
+
+// Rule is a named program compiled for a RuleSet's variable.
+type Rule struct {
+	Name    string
+	Program cel.Program
+}
+
+// RuleResult is the result of evaluating one rule of a RuleSet.
+type RuleResult struct {
+	Name  string
+	Value ref.Val
+	Err   error
+}
+
+// Matched reports whether the rule evaluated to true.
+func (r RuleResult) Matched() bool {
+	return r.Err == nil && r.Value != nil && r.Value.Value() == true
+}
+
+// RuleSetResult is the result of evaluating every rule of a RuleSet.
+type RuleSetResult struct {
+	// Results are the results of each rule, in the order of the rules.
+	Results []RuleResult
+
+	// Duration is the total time taken to evaluate the rules.
+	Duration time.Duration
+}
+
+// RuleSet evaluates many programs compiled for the same variable against
+// one object, sharing the field values read by the programs.
+type RuleSet struct {
+	variable string
+	rules    []Rule
+	adapter  types.Adapter
+}
+
+// NewRuleSet returns a rule set evaluating the rules with the object bound
+// to the named variable.
+func NewRuleSet(variable string, rules ...Rule) *RuleSet {
+	return &RuleSet{variable: variable, rules: rules}
+}
+
+// Add adds a named program to the rule set.
+func (rs *RuleSet) Add(name string, prg cel.Program) {
+	rs.rules = append(rs.rules, Rule{Name: name, Program: prg})
+}
+
+// Len returns the number of rules in the rule set.
+func (rs *RuleSet) Len() int {
+	return len(rs.rules)
+}
+
+// UseAdapter makes Eval wrap plain Go values with the type adapter, such as
+// a Registry's Adapter, so their field values are cached like the ones of
+// objects.
+func (rs *RuleSet) UseAdapter(ta types.Adapter) {
+	rs.adapter = ta
+}
+
+// Eval evaluates every rule against the object. Field values read through
+// fields derived with NewFields are cached for the duration of the call, so
+// a field selected by many rules is only read and converted once. The cache
+// is attached to a copy of the object, and never shared across calls. Plain
+// Go values are only cached when they are wrapped as objects by the type
+// adapter given with UseAdapter, and are otherwise evaluated uncached.
+//
+// Rule errors are reported in the rule's result rather than stopping the
+// evaluation of the remaining rules.
+func (rs *RuleSet) Eval(obj any) (*RuleSetResult, error) {
+	start := time.Now()
+
+	type cacher interface{ withFieldCache() ref.Val }
+
+	if _, ok := obj.(cacher); !ok && rs.adapter != nil {
+		if v, ok := rs.adapter.NativeToValue(obj).(cacher); ok {
+			obj = v
+		}
+	}
+	if c, ok := obj.(cacher); ok {
+		obj = c.withFieldCache()
+	}
+
+	act, err := interpreter.NewActivation(map[string]any{rs.variable: obj})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]RuleResult, len(rs.rules))
+	for i, rule := range rs.rules {
+		out, _, err := rule.Program.Eval(act)
+		results[i] = RuleResult{Name: rule.Name, Value: out, Err: err}
+	}
+
+	return &RuleSetResult{Results: results, Duration: time.Since(start)}, nil
+}
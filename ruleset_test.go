@@ -0,0 +1,209 @@
+package xcel_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/picatz/xcel"
+)
+
+func newRuleSetEnv(tb testing.TB, event *ExecEvent, opts ...cel.EnvOption) (*cel.Env, *xcel.Object[*ExecEvent]) {
+	tb.Helper()
+
+	reg := xcel.NewRegistry()
+
+	obj, typ := xcel.NewObject(event)
+
+	xcel.RegisterObject(reg.Adapter, reg.Provider, obj, typ, xcel.NewFields(obj))
+
+	reg.Variable("event", typ)
+
+	env, err := cel.NewEnv(append(reg.EnvOptions(), opts...)...)
+	if err != nil {
+		tb.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	return env, obj
+}
+
+func compileRule(tb testing.TB, env *cel.Env, expr string) cel.Program {
+	tb.Helper()
+
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		tb.Fatalf("failed to compile CEL expression %q: %v", expr, iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		tb.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	return prg
+}
+
+func TestRuleSet(t *testing.T) {
+	event := &ExecEvent{ExePath: "/bin/sh", Args: []string{"-c", "id"}}
+
+	// rename changes the event while the rules are evaluated, which shows
+	// whether field values are read once per evaluation.
+	rename := cel.Function("rename",
+		cel.Overload("rename_exec_event", []*cel.Type{cel.DynType}, cel.BoolType,
+			cel.UnaryBinding(func(value ref.Val) ref.Val {
+				value.(*xcel.Object[*ExecEvent]).Raw.ExePath = "/bin/bash"
+				return types.True
+			}),
+		),
+	)
+
+	env, obj := newRuleSetEnv(t, event, rename)
+
+	rs := xcel.NewRuleSet("event",
+		xcel.Rule{Name: "shell", Program: compileRule(t, env, "event.exe_path == '/bin/sh'")},
+		xcel.Rule{Name: "rename", Program: compileRule(t, env, "rename(event)")},
+	)
+	rs.Add("still-shell", compileRule(t, env, "event.exe_path == '/bin/sh' && 'id' in event.args"))
+	rs.Add("error", compileRule(t, env, "event.args[5] == 'x'"))
+
+	if rs.Len() != 4 {
+		t.Fatalf("expected 4 rules but got %d", rs.Len())
+	}
+
+	res, err := rs.Eval(obj)
+	if err != nil {
+		t.Fatalf("failed to evaluate rule set: %v", err)
+	}
+
+	for i, want := range []bool{true, true, true, false} {
+		if got := res.Results[i].Matched(); got != want {
+			t.Fatalf("expected rule %q to match '%v' but got '%v' (%v)", res.Results[i].Name, want, got, res.Results[i].Err)
+		}
+	}
+
+	if res.Results[3].Err == nil {
+		t.Fatal("expected an error for the out of range index")
+	}
+
+	if event.ExePath != "/bin/bash" {
+		t.Fatalf("expected the event to be renamed but got %q", event.ExePath)
+	}
+
+	// The cache is not shared across evaluations.
+	res, err = rs.Eval(obj)
+	if err != nil {
+		t.Fatalf("failed to evaluate rule set: %v", err)
+	}
+
+	if res.Results[0].Matched() {
+		t.Fatal("expected the renamed event to not match")
+	}
+}
+
+func TestRuleSetPlainValues(t *testing.T) {
+	tests := []struct {
+		name       string
+		useAdapter bool
+		cached     bool
+	}{
+		{name: "without adapter", useAdapter: false, cached: false},
+		{name: "with adapter", useAdapter: true, cached: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reg := xcel.NewRegistry()
+
+			if err := xcel.RegisterAll(reg, []any{&ExecEvent{}}); err != nil {
+				t.Fatalf("failed to register types: %v", err)
+			}
+
+			_, typ := xcel.NewObject(&ExecEvent{})
+			reg.Variable("event", typ)
+
+			// rename changes the event while the rules are evaluated, which
+			// shows whether field values are read once per evaluation.
+			rename := cel.Function("rename",
+				cel.Overload("rename_exec_event", []*cel.Type{cel.DynType}, cel.BoolType,
+					cel.UnaryBinding(func(value ref.Val) ref.Val {
+						value.(*xcel.Object[any]).Raw.(*ExecEvent).ExePath = "/bin/bash"
+						return types.True
+					}),
+				),
+			)
+
+			env, err := cel.NewEnv(append(reg.EnvOptions(), rename)...)
+			if err != nil {
+				t.Fatalf("failed to create CEL environment: %v", err)
+			}
+
+			rs := xcel.NewRuleSet("event")
+			rs.Add("shell", compileRule(t, env, "event.exe_path == '/bin/sh'"))
+			rs.Add("rename", compileRule(t, env, "rename(event)"))
+			rs.Add("still-shell", compileRule(t, env, "event.exe_path == '/bin/sh'"))
+
+			if test.useAdapter {
+				rs.UseAdapter(reg.Adapter)
+			}
+
+			res, err := rs.Eval(&ExecEvent{ExePath: "/bin/sh"})
+			if err != nil {
+				t.Fatalf("failed to evaluate rule set: %v", err)
+			}
+
+			for i, want := range []bool{true, true, test.cached} {
+				if got := res.Results[i].Matched(); got != want {
+					t.Fatalf("expected rule %q to match '%v' but got '%v' (%v)", res.Results[i].Name, want, got, res.Results[i].Err)
+				}
+			}
+		})
+	}
+}
+
+const ruleSetRules = 200
+
+func newRuleSetBenchmark(b *testing.B) (*xcel.RuleSet, *xcel.Object[*ExecEvent]) {
+	env, obj := newRuleSetEnv(b, &ExecEvent{ExePath: "/usr/bin/curl", Args: []string{"-s", "https://example.com"}})
+
+	rs := xcel.NewRuleSet("event")
+	for i := 0; i < ruleSetRules; i++ {
+		rs.Add(fmt.Sprint(i), compileRule(b, env, fmt.Sprintf("event.exe_path.endsWith('/bin/%d') || size(event.args) == %d", i, i)))
+	}
+
+	return rs, obj
+}
+
+func BenchmarkRuleSet(b *testing.B) {
+	rs, obj := newRuleSetBenchmark(b)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := rs.Eval(obj); err != nil {
+			b.Fatalf("failed to evaluate rule set: %v", err)
+		}
+	}
+}
+
+func BenchmarkRuleSetNaive(b *testing.B) {
+	env, obj := newRuleSetEnv(b, &ExecEvent{ExePath: "/usr/bin/curl", Args: []string{"-s", "https://example.com"}})
+
+	prgs := make([]cel.Program, 0, ruleSetRules)
+	for i := 0; i < ruleSetRules; i++ {
+		prgs = append(prgs, compileRule(b, env, fmt.Sprintf("event.exe_path.endsWith('/bin/%d') || size(event.args) == %d", i, i)))
+	}
+
+	vars := map[string]any{"event": obj}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, prg := range prgs {
+			if _, _, err := prg.Eval(vars); err != nil {
+				b.Fatalf("failed to evaluate program: %v", err)
+			}
+		}
+	}
+}
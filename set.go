@@ -0,0 +1,195 @@
+package xcel
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// SetType is the CEL type of the sets registered with RegisterSet.
+var SetType = cel.OpaqueType("xcel.Set")
+
+// Set is an immutable set of strings that can be used in expressions with
+// the in_set and has_prefix_in functions, see Sets. It is safe for
+// concurrent use across evaluations.
+type Set struct {
+	members  map[string]struct{}
+	prefixes *prefixNode
+}
+
+// prefixNode is a node in the byte-wise prefix trie of a set's members.
+type prefixNode struct {
+	children map[byte]*prefixNode
+	terminal bool
+}
+
+// NewSet returns a new set containing the given values.
+func NewSet(values []string) *Set {
+	s := &Set{
+		members:  make(map[string]struct{}, len(values)),
+		prefixes: &prefixNode{},
+	}
+	for _, value := range values {
+		s.members[value] = struct{}{}
+
+		node := s.prefixes
+		for i := 0; i < len(value); i++ {
+			if node.children == nil {
+				node.children = map[byte]*prefixNode{}
+			}
+			next, ok := node.children[value[i]]
+			if !ok {
+				next = &prefixNode{}
+				node.children[value[i]] = next
+			}
+			node = next
+		}
+		node.terminal = true
+	}
+	return s
+}
+
+// RegisterSet registers a set of the given values as a named identifier with
+// the type provider, so large allowlists are not rebuilt as CEL lists for
+// every evaluation. The set is declared for expressions by Sets.
+func RegisterSet(tp *TypeProvider, name string, values []string) *Set {
+	s := NewSet(values)
+	RegisterIdent(tp, name, s)
+	return s
+}
+
+// Sets returns a CEL environment option declaring the sets registered with the
+// type provider as variables, along with the functions used to query them:
+//
+//	in_set(string, set) -> bool         // the string is a member of the set
+//	has_prefix_in(string, set) -> bool  // a member of the set is a prefix of the string
+func Sets(tp *TypeProvider) cel.EnvOption {
+	var names []string
+	for name, v := range tp.Idents {
+		if _, ok := v.(*Set); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	opts := make([]cel.EnvOption, 0, len(names)+2)
+	for _, name := range names {
+		opts = append(opts, cel.Variable(name, SetType))
+	}
+
+	opts = append(opts,
+		cel.Function("in_set",
+			cel.Overload("in_set_string_set", []*cel.Type{cel.StringType, SetType}, cel.BoolType,
+				cel.BinaryBinding(func(lhs, rhs ref.Val) ref.Val {
+					return setBinding(lhs, rhs, (*Set).Contains)
+				}),
+			),
+		),
+		cel.Function("has_prefix_in",
+			cel.Overload("has_prefix_in_string_set", []*cel.Type{cel.StringType, SetType}, cel.BoolType,
+				cel.BinaryBinding(func(lhs, rhs ref.Val) ref.Val {
+					return setBinding(lhs, rhs, (*Set).HasPrefixOf)
+				}),
+			),
+		),
+	)
+
+	return cel.Lib(library(opts))
+}
+
+// setBinding applies the set query to the string and set arguments.
+func setBinding(lhs, rhs ref.Val, query func(*Set, string) bool) ref.Val {
+	str, ok := lhs.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(lhs)
+	}
+	set, ok := rhs.(*Set)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(rhs)
+	}
+	return types.Bool(query(set, string(str)))
+}
+
+// Contains returns true if the value is a member of the set.
+func (s *Set) Contains(value string) bool {
+	_, ok := s.members[value]
+	return ok
+}
+
+// HasPrefixOf returns true if any member of the set is a prefix of the value.
+func (s *Set) HasPrefixOf(value string) bool {
+	node := s.prefixes
+	for i := 0; ; i++ {
+		if node.terminal {
+			return true
+		}
+		if i == len(value) {
+			return false
+		}
+		next, ok := node.children[value[i]]
+		if !ok {
+			return false
+		}
+		node = next
+	}
+}
+
+// Len returns the number of members of the set.
+func (s *Set) Len() int {
+	return len(s.members)
+}
+
+// ConvertToNative converts the set to a sorted []string of its members.
+func (s *Set) ConvertToNative(typeDesc reflect.Type) (any, error) {
+	if typeDesc == reflect.TypeOf([]string(nil)) {
+		values := make([]string, 0, len(s.members))
+		for value := range s.members {
+			values = append(values, value)
+		}
+		sort.Strings(values)
+		return values, nil
+	}
+	if typeDesc == reflect.TypeOf(s) {
+		return s, nil
+	}
+	return nil, fmt.Errorf("xcel: type conversion error from '%s' to '%s'", SetType, typeDesc)
+}
+
+// ConvertToType converts the set to a CEL value of the specified type.
+func (s *Set) ConvertToType(typeValue ref.Type) ref.Val {
+	switch typeValue {
+	case SetType:
+		return s
+	case types.TypeType:
+		return SetType
+	}
+	return types.NewErr("xcel: type conversion error from '%s' to '%s'", SetType, typeValue)
+}
+
+// Equal returns true if the other value is a set with the same members.
+func (s *Set) Equal(other ref.Val) ref.Val {
+	o, ok := other.(*Set)
+	if !ok || len(o.members) != len(s.members) {
+		return types.False
+	}
+	for value := range s.members {
+		if _, ok := o.members[value]; !ok {
+			return types.False
+		}
+	}
+	return types.True
+}
+
+// Type returns the CEL type of the set.
+func (s *Set) Type() ref.Type {
+	return SetType
+}
+
+// Value returns the set.
+func (s *Set) Value() any {
+	return s
+}
@@ -0,0 +1,85 @@
+package xcel_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+func TestRegisterSet(t *testing.T) {
+	tp := xcel.NewTypeProvider()
+
+	paths := make([]string, 0, 5000)
+	for i := 0; i < 5000; i++ {
+		paths = append(paths, fmt.Sprintf("/usr/bin/tool-%d", i))
+	}
+
+	xcel.RegisterSet(tp, "known_paths", paths)
+	xcel.RegisterSet(tp, "trusted_dirs", []string{"/usr/bin/", "/opt/"})
+
+	env, err := cel.NewEnv(
+		cel.CustomTypeProvider(tp),
+		cel.Variable("path", cel.StringType),
+		xcel.Sets(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("in_set(path, known_paths) || has_prefix_in(path, trusted_dirs)")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	tests := map[string]types.Bool{
+		"/usr/bin/tool-4999": true,
+		"/usr/bin/other":     true,
+		"/opt/app/run":       true,
+		"/usr/bin":           false,
+		"/tmp/tool-1":        false,
+		"":                   false,
+	}
+
+	var wg sync.WaitGroup
+	for path, want := range tests {
+		wg.Add(1)
+		go func(path string, want types.Bool) {
+			defer wg.Done()
+
+			out, _, err := prg.Eval(map[string]any{"path": path})
+			if err != nil {
+				t.Errorf("failed to evaluate program for %q: %v", path, err)
+				return
+			}
+			if out != want {
+				t.Errorf("expected %v for %q but got '%v'", want, path, out)
+			}
+		}(path, want)
+	}
+	wg.Wait()
+}
+
+func TestSetEqual(t *testing.T) {
+	a := xcel.NewSet([]string{"a", "b"})
+	b := xcel.NewSet([]string{"b", "a", "a"})
+	c := xcel.NewSet([]string{"a"})
+
+	if a.Equal(b) != types.True {
+		t.Fatal("expected sets with the same members to be equal")
+	}
+	if a.Equal(c) != types.False {
+		t.Fatal("expected sets with different members to not be equal")
+	}
+	if a.Type() != xcel.SetType || a.ConvertToType(types.TypeType) != xcel.SetType {
+		t.Fatal("expected set type")
+	}
+}
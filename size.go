@@ -0,0 +1,125 @@
+package xcel
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"unicode/utf8"
+)
+
+// SizeLimitMode is how a field value exceeding its size limit is handled,
+// see WithMaxValueSize.
+type SizeLimitMode int
+
+const (
+	// TruncateOversize truncates oversized values to the size limit and
+	// appends TruncationMarker.
+	TruncateOversize SizeLimitMode = iota
+
+	// ErrorOversize makes selecting an oversized value an error.
+	ErrorOversize
+)
+
+// TruncationMarker is appended to values truncated by TruncateOversize.
+const TruncationMarker = "...[truncated]"
+
+// valueLimit is the size limit of a field's string and bytes values.
+type valueLimit struct {
+	size int
+	mode SizeLimitMode
+}
+
+// WithMaxValueSize limits the string and bytes values of the named field
+// derived with NewFields to n bytes, including the elements of lists and
+// the values of maps, so that huge values are not converted to CEL values
+// or scanned by functions like matches(). Limits do not change whether a
+// field is set, so has() is still true for oversized values. A negative n
+// is reported as an error by NewFieldsE.
+func WithMaxValueSize(field string, n int, mode SizeLimitMode) Option {
+	return option("WithMaxValueSize", fieldScope, func(o *options) {
+		if o.maxValueSizes == nil {
+			o.maxValueSizes = map[string]valueLimit{}
+		}
+		o.maxValueSizes[field] = valueLimit{size: n, mode: mode}
+	})
+}
+
+// valueLimitErrors returns an error for each field given a negative size
+// limit with WithMaxValueSize, sorted so they are reported in a stable
+// order.
+func (o *options) valueLimitErrors() []error {
+	var errs []error
+	for field, limit := range o.maxValueSizes {
+		if limit.size < 0 {
+			errs = append(errs, fmt.Errorf("xcel: negative maximum value size %d of field '%s'", limit.size, field))
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+	return errs
+}
+
+// apply returns the field value with its string and bytes values limited
+// to the size limit.
+func (l valueLimit) apply(name string, v reflect.Value) (reflect.Value, error) {
+	switch v.Kind() {
+	case reflect.String:
+		s := v.String()
+		if len(s) <= l.size {
+			return v, nil
+		}
+		if l.mode == ErrorOversize {
+			return v, l.errorf(name, len(s))
+		}
+		n := l.size
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		return reflect.ValueOf(s[:n] + TruncationMarker).Convert(v.Type()), nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Len() <= l.size {
+				return v, nil
+			}
+			if l.mode == ErrorOversize {
+				return v, l.errorf(name, v.Len())
+			}
+			b := make([]byte, l.size, l.size+len(TruncationMarker))
+			reflect.Copy(reflect.ValueOf(b), v)
+			return reflect.ValueOf(append(b, TruncationMarker...)), nil
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return v, nil
+		}
+		limited := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			e, err := l.apply(name, v.Index(i))
+			if err != nil {
+				return v, err
+			}
+			limited.Index(i).Set(e)
+		}
+		return limited, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return v, nil
+		}
+		limited := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			e, err := l.apply(name, iter.Value())
+			if err != nil {
+				return v, err
+			}
+			limited.SetMapIndex(iter.Key(), e)
+		}
+		return limited, nil
+	}
+	return v, nil
+}
+
+// errorf returns the error for an oversized value of the named field.
+func (l valueLimit) errorf(name string, size int) error {
+	return fmt.Errorf("xcel: field '%s' value size %d exceeds the limit of %d bytes", name, size, l.size)
+}
@@ -0,0 +1,147 @@
+package xcel_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+type Capture struct {
+	CommandLine string
+	Buffer      []byte
+	Args        []string
+	Env         map[string]string
+}
+
+func evalCapture(t *testing.T, capture *Capture, expr string, opts ...xcel.Option) (any, error) {
+	t.Helper()
+
+	ta, tp := xcel.NewTypeAdapter(), xcel.NewTypeProvider()
+
+	obj, typ := xcel.NewObject(capture)
+
+	xcel.RegisterObject(ta, tp, obj, typ, xcel.NewFields(obj, opts...))
+
+	env, err := cel.NewEnv(
+		cel.Types(typ),
+		cel.Variable("capture", typ),
+		cel.CustomTypeAdapter(ta),
+		cel.CustomTypeProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	out, _, err := prg.Eval(map[string]any{"capture": obj})
+	if err != nil {
+		return nil, err
+	}
+	return out.Value(), nil
+}
+
+func TestWithMaxValueSize(t *testing.T) {
+	capture := &Capture{
+		CommandLine: "curl " + strings.Repeat("a", 1<<20),
+		Buffer:      []byte("0123456789"),
+		Args:        []string{"-s", "https://example.com"},
+		Env:         map[string]string{"HOME": "/root", "PATH": "/usr/local/bin:/usr/bin:/bin"},
+	}
+
+	truncate := []xcel.Option{
+		xcel.WithMaxValueSize("command_line", 8, xcel.TruncateOversize),
+		xcel.WithMaxValueSize("buffer", 4, xcel.TruncateOversize),
+		xcel.WithMaxValueSize("args", 5, xcel.TruncateOversize),
+		xcel.WithMaxValueSize("env", 5, xcel.TruncateOversize),
+	}
+
+	tests := []struct {
+		expr string
+		opts []xcel.Option
+		want any
+		err  string
+	}{
+		{expr: "size(capture.command_line) > 1000", want: true},
+		{expr: "capture.command_line", opts: truncate, want: "curl aaa" + xcel.TruncationMarker},
+		{expr: "capture.buffer == b'0123" + xcel.TruncationMarker + "'", opts: truncate, want: true},
+		{expr: "capture.args == ['-s', 'https" + xcel.TruncationMarker + "']", opts: truncate, want: true},
+		{expr: "capture.env.HOME == '/root' && capture.env.PATH == '/usr/" + xcel.TruncationMarker + "'", opts: truncate, want: true},
+		{expr: "has(capture.command_line) && has(capture.buffer)", opts: truncate, want: true},
+		{
+			expr: "has(capture.command_line)",
+			opts: []xcel.Option{xcel.WithMaxValueSize("command_line", 8, xcel.ErrorOversize)},
+			want: true,
+		},
+		{
+			expr: "capture.command_line.matches('^curl')",
+			opts: []xcel.Option{xcel.WithMaxValueSize("command_line", 8, xcel.ErrorOversize)},
+			err:  "xcel: field 'command_line' value size 1048581 exceeds the limit of 8 bytes",
+		},
+		{
+			expr: "'-s' in capture.args",
+			opts: []xcel.Option{xcel.WithMaxValueSize("args", 5, xcel.ErrorOversize)},
+			err:  "xcel: field 'args' value size 19 exceeds the limit of 5 bytes",
+		},
+		{
+			expr: "'-s' in capture.args",
+			opts: []xcel.Option{xcel.WithMaxValueSize("args", 19, xcel.ErrorOversize)},
+			want: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			got, err := evalCapture(t, capture, test.expr, test.opts...)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q but got '%v' (%v)", test.err, err, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+			if got != test.want {
+				t.Fatalf("expected '%v' but got '%v'", test.want, got)
+			}
+		})
+	}
+}
+
+func TestWithMaxValueSizeRuneBoundary(t *testing.T) {
+	got, err := evalCapture(t, &Capture{CommandLine: "héllo"}, "capture.command_line",
+		xcel.WithMaxValueSize("command_line", 2, xcel.TruncateOversize))
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if got != types.String("h"+xcel.TruncationMarker).Value() {
+		t.Fatalf("expected the value to be truncated at a rune boundary but got %q", got)
+	}
+}
+
+func TestWithMaxValueSizeNegative(t *testing.T) {
+	obj, _ := xcel.NewObject(&Capture{})
+
+	_, err := xcel.NewFieldsE(obj, xcel.WithMaxValueSize("command_line", -1, xcel.TruncateOversize))
+	if err == nil || !strings.Contains(err.Error(), "negative maximum value size -1 of field 'command_line'") {
+		t.Fatalf("expected a negative size error but got '%v'", err)
+	}
+
+	err = xcel.RegisterAll(xcel.NewRegistry(xcel.WithMaxValueSize("buffer", -8, xcel.ErrorOversize)), []any{&Capture{}})
+	if err == nil || !strings.Contains(err.Error(), "negative maximum value size -8 of field 'buffer'") {
+		t.Fatalf("expected a negative size error but got '%v'", err)
+	}
+}
@@ -0,0 +1,53 @@
+package xcel
+
+import (
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"golang.org/x/text/cases"
+)
+
+// CaseInsensitiveStrings returns a CEL environment option declaring case
+// insensitive string comparison functions:
+//
+//	iequals(string, string) -> bool
+//	icontains(string, string) -> bool
+//	ihas_prefix(string, string) -> bool
+//	ihas_suffix(string, string) -> bool
+//
+// Both arguments are compared using full Unicode case folding, not just ASCII
+// lower casing, so "STRASSE" equals "straße" and "ſecret" equals "SECRET".
+// Folding is language independent: the Turkish dotted "İ" folds to "i" with a
+// combining dot above (U+0307), so it does not equal a plain "i", and the
+// dotless "ı" only equals itself.
+func CaseInsensitiveStrings() cel.EnvOption {
+	return cel.Lib(library{
+		foldFunction("iequals", func(s, t string) bool { return s == t }),
+		foldFunction("icontains", strings.Contains),
+		foldFunction("ihas_prefix", strings.HasPrefix),
+		foldFunction("ihas_suffix", strings.HasSuffix),
+	})
+}
+
+// foldFunction declares a function comparing two case folded strings.
+func foldFunction(name string, compare func(s, t string) bool) cel.EnvOption {
+	return cel.Function(name,
+		cel.Overload(name+"_string_string", []*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+			cel.BinaryBinding(func(lhs, rhs ref.Val) ref.Val {
+				s, ok := lhs.(types.String)
+				if !ok {
+					return types.MaybeNoSuchOverloadErr(lhs)
+				}
+				t, ok := rhs.(types.String)
+				if !ok {
+					return types.MaybeNoSuchOverloadErr(rhs)
+				}
+				// Casers are stateful, so one is created for each call.
+				fold := cases.Fold()
+				return types.Bool(compare(fold.String(string(s)), fold.String(string(t))))
+			}),
+		),
+	)
+}
@@ -0,0 +1,50 @@
+package xcel_test
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+func TestCaseInsensitiveStrings(t *testing.T) {
+	env, err := cel.NewEnv(xcel.CaseInsensitiveStrings())
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	tests := map[string]types.Bool{
+		`iequals('/USR/BIN/Curl', '/usr/bin/curl')`:        true,
+		`iequals('STRASSE', 'straße')`:                     true,
+		`iequals('ſecret', 'SECRET')`:                      true,
+		`iequals('İstanbul', 'istanbul')`:                  false,
+		`iequals('ıi', 'II')`:                              false,
+		`icontains('C:\\Windows\\System32', 'system32')`:   true,
+		`icontains('Maßnahme', 'SSN')`:                     true,
+		`ihas_prefix('EVIL.example.com', 'evil.')`:         true,
+		`ihas_suffix('login.EXAMPLE.com', '.example.COM')`: true,
+		`ihas_suffix('example.org', '.example.com')`:       false,
+	}
+
+	for expr, want := range tests {
+		ast, iss := env.Compile(expr)
+		if iss.Err() != nil {
+			t.Fatalf("failed to compile %q: %v", expr, iss.Err())
+		}
+
+		prg, err := env.Program(ast)
+		if err != nil {
+			t.Fatalf("failed to create CEL program: %v", err)
+		}
+
+		out, _, err := prg.Eval(map[string]any{})
+		if err != nil {
+			t.Fatalf("failed to evaluate %q: %v", expr, err)
+		}
+
+		if out != want {
+			t.Errorf("expected %v for %q but got '%v'", want, expr, out)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package xcel
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// TemplateParams is the name of the variable holding the parameters of a
+// template, such as params.threshold.
+const TemplateParams = "params"
+
+// Template is an expression parameterized by the fields of a Go struct
+// pointer type P, which are referenced through the params variable instead
+// of being interpolated into the expression source. The parameter fields
+// are derived with NewFields, so using a parameter with the wrong type or
+// a parameter that does not exist fails when the template is compiled.
+type Template[P any] struct {
+	reg *Registry
+	env *cel.Env
+	ast *cel.Ast
+	typ *types.Type
+}
+
+// NewTemplate registers the parameter type P with the registry and compiles
+// the expression with the registry's environment options, the params
+// variable, and the given environment options.
+func NewTemplate[P any](reg *Registry, expr string, envOpts ...cel.EnvOption) (*Template[P], error) {
+	rt := reflect.TypeOf((*P)(nil)).Elem()
+	if rt.Kind() != reflect.Pointer || rt.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("xcel: unsupported template parameter type '%s', expected a struct pointer", rt)
+	}
+
+	if err := RegisterAll(reg, []any{reflect.New(rt.Elem()).Interface()}); err != nil {
+		return nil, err
+	}
+
+	typ := objectTypeOf(reflect.Zero(rt).Interface())
+
+	env, err := cel.NewEnv(append(append(reg.EnvOptions(), cel.Variable(TemplateParams, typ)), envOpts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+
+	return &Template[P]{reg: reg, env: env, ast: ast, typ: typ}, nil
+}
+
+// Env returns the CEL environment the template was compiled with.
+func (t *Template[P]) Env() *cel.Env {
+	return t.env
+}
+
+// Ast returns the checked AST of the template, which references the
+// parameters through the params variable.
+func (t *Template[P]) Ast() *cel.Ast {
+	return t.ast
+}
+
+// Program returns a program for the template's AST, whose parameters are
+// bound for each evaluation with Bind.
+func (t *Template[P]) Program(opts ...cel.ProgramOption) (cel.Program, error) {
+	return t.env.Program(t.ast, opts...)
+}
+
+// Bind returns a copy of the variables with the params variable bound to
+// the given parameters.
+func (t *Template[P]) Bind(params P, vars map[string]any) map[string]any {
+	bound := make(map[string]any, len(vars)+1)
+	for name, v := range vars {
+		bound[name] = v
+	}
+	bound[TemplateParams] = t.reg.Adapter.NativeToValue(params)
+	return bound
+}
+
+// Specialize returns a copy of the template's AST with the set parameters
+// of primitive types (bool, int, uint, double, string, and bytes) replaced
+// by their values, and then constant folded, see FoldConstants. Parameters
+// of other types are still referenced through the params variable, so the
+// parameters must still be bound with Bind when evaluating the result.
+func (t *Template[P]) Specialize(params P) (*cel.Ast, error) {
+	obj := t.reg.Adapter.NativeToValue(params)
+	if obj.Type().TypeName() != t.typ.TypeName() {
+		return nil, fmt.Errorf("xcel: template parameters '%T' are not registered", params)
+	}
+
+	fields := t.reg.Provider.StructFieldTypes[t.typ.TypeName()]
+
+	inlined := map[string]*cel.Ast{}
+	for _, name := range sortedFieldNames(fields) {
+		field := fields[name]
+		if !field.IsSet(obj) {
+			continue
+		}
+
+		v, err := field.GetFrom(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		c, ok := constantOf(types.DefaultTypeAdapter.NativeToValue(v))
+		if !ok {
+			continue
+		}
+
+		def, iss := t.env.Check(cel.ParsedExprToAst(&exprpb.ParsedExpr{
+			Expr: &exprpb.Expr{Id: 1, ExprKind: &exprpb.Expr_ConstExpr{ConstExpr: c}},
+		}))
+		if iss.Err() != nil {
+			return nil, iss.Err()
+		}
+
+		inlined[TemplateParams+"."+name] = def
+	}
+
+	return inlineAndFold(t.env, t.ast, inlined)
+}
+
+// constantOf returns the literal form of a primitive CEL value.
+func constantOf(v ref.Val) (*exprpb.Constant, bool) {
+	switch v := v.(type) {
+	case types.Bool:
+		return &exprpb.Constant{ConstantKind: &exprpb.Constant_BoolValue{BoolValue: bool(v)}}, true
+	case types.Int:
+		return &exprpb.Constant{ConstantKind: &exprpb.Constant_Int64Value{Int64Value: int64(v)}}, true
+	case types.Uint:
+		return &exprpb.Constant{ConstantKind: &exprpb.Constant_Uint64Value{Uint64Value: uint64(v)}}, true
+	case types.Double:
+		return &exprpb.Constant{ConstantKind: &exprpb.Constant_DoubleValue{DoubleValue: float64(v)}}, true
+	case types.String:
+		return &exprpb.Constant{ConstantKind: &exprpb.Constant_StringValue{StringValue: string(v)}}, true
+	case types.Bytes:
+		return &exprpb.Constant{ConstantKind: &exprpb.Constant_BytesValue{BytesValue: []byte(v)}}, true
+	}
+	return nil, false
+}
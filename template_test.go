@@ -0,0 +1,126 @@
+package xcel_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+type ExecParams struct {
+	PathPrefix string
+	MaxArgs    int
+	Allowed    []string
+}
+
+func newExecTemplate(t *testing.T, expr string) (*xcel.Template[*ExecParams], *xcel.Object[*ExecEvent]) {
+	t.Helper()
+
+	reg := xcel.NewRegistry()
+
+	obj, typ := xcel.NewObject(&ExecEvent{ExePath: "/usr/bin/curl", Args: []string{"-s", "https://example.com"}})
+
+	xcel.RegisterObject(reg.Adapter, reg.Provider, obj, typ, xcel.NewFields(obj))
+
+	reg.Variable("event", typ)
+
+	tmpl, err := xcel.NewTemplate[*ExecParams](reg, expr)
+	if err != nil {
+		t.Fatalf("failed to create template: %v", err)
+	}
+
+	return tmpl, obj
+}
+
+func TestTemplate(t *testing.T) {
+	tmpl, obj := newExecTemplate(t, "event.exe_path.startsWith(params.path_prefix) && size(event.args) <= params.max_args")
+
+	prg, err := tmpl.Program()
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	tests := []struct {
+		params *ExecParams
+		want   bool
+	}{
+		{&ExecParams{PathPrefix: "/usr/bin/", MaxArgs: 2}, true},
+		{&ExecParams{PathPrefix: "/usr/bin/", MaxArgs: 1}, false},
+		{&ExecParams{PathPrefix: "/bin/", MaxArgs: 2}, false},
+		// Quotes are values, not expression syntax.
+		{&ExecParams{PathPrefix: "') || true || ('", MaxArgs: 2}, false},
+	}
+
+	for _, test := range tests {
+		out, _, err := prg.Eval(tmpl.Bind(test.params, map[string]any{"event": obj}))
+		if err != nil {
+			t.Fatalf("failed to evaluate program with %+v: %v", test.params, err)
+		}
+
+		if out != types.Bool(test.want) {
+			t.Fatalf("expected '%v' but got '%v' for %+v", test.want, out, test.params)
+		}
+	}
+}
+
+func TestTemplateTypeMismatch(t *testing.T) {
+	reg := xcel.NewRegistry()
+
+	for _, expr := range []string{
+		"params.max_args == 'two'",
+		"params.path_prefix > 1",
+		"params.threshold > 1",
+	} {
+		if _, err := xcel.NewTemplate[*ExecParams](reg, expr); err == nil {
+			t.Fatalf("expected a compile error for %q", expr)
+		}
+	}
+
+	if _, err := xcel.NewTemplate[ExecParams](reg, "true"); err == nil {
+		t.Fatal("expected an error for a non-pointer parameter type")
+	}
+}
+
+func TestTemplateSpecialize(t *testing.T) {
+	tmpl, obj := newExecTemplate(t, "event.exe_path.startsWith(params.path_prefix + 'bin/') && params.max_args * 2 >= size(event.args) && event.exe_path in params.allowed")
+
+	params := &ExecParams{PathPrefix: "/usr/", MaxArgs: 1, Allowed: []string{"/usr/bin/curl"}}
+
+	ast, err := tmpl.Specialize(params)
+	if errors.Is(err, xcel.ErrOptimizerUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatalf("failed to specialize template: %v", err)
+	}
+
+	src, err := cel.AstToString(ast)
+	if err != nil {
+		t.Fatalf("failed to format AST: %v", err)
+	}
+
+	if !strings.Contains(src, `"/usr/bin/"`) || !strings.Contains(src, "2 >=") || strings.Contains(src, "params.path_prefix") {
+		t.Fatalf("expected the primitive parameters to be folded but got %s", src)
+	}
+
+	if !strings.Contains(src, "params.allowed") {
+		t.Fatalf("expected the list parameter to be bound at evaluation but got %s", src)
+	}
+
+	prg, err := tmpl.Env().Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	out, _, err := prg.Eval(tmpl.Bind(params, map[string]any{"event": obj}))
+	if err != nil {
+		t.Fatalf("failed to evaluate program: %v", err)
+	}
+
+	if out != types.True {
+		t.Fatalf("expected 'true' but got '%v'", out)
+	}
+}
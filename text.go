@@ -0,0 +1,134 @@
+package xcel
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+
+	"github.com/google/cel-go/common/types"
+)
+
+// textMarshalerType is the reflect type of encoding.TextMarshaler.
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// WithTextMarshalers makes fields derived with NewFields whose types
+// implement encoding.TextMarshaler, on the type or its pointer, strings of
+// their text form, such as a UUID compared with obj.id == '...', instead of
+// objects or bytes. Types with a CEL mapping of their own, such as
+// time.Time, netip.Addr, or integer and string kinds, keep it. Errors from
+// MarshalText are errors when the field is accessed.
+func WithTextMarshalers() Option {
+	return option("WithTextMarshalers", fieldScope, func(o *options) {
+		o.textMarshalers = true
+	})
+}
+
+// isTextFallbackType reports whether the type has no CEL mapping of its own
+// other than an object or bytes, so it can be exposed in its text form.
+func isTextFallbackType(t reflect.Type) bool {
+	if isScalarStructType(t) || isDurationType(t) || t == jsonRawMessageType {
+		return false
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch k := t.Kind(); {
+	case k == reflect.String, k == reflect.Bool, k == reflect.Uint8, isNumericKind(k):
+		return false
+	}
+	return true
+}
+
+// textFieldType returns the string type and conversion for fields whose
+// type, or its pointer, implements encoding.TextMarshaler.
+func textFieldType(t reflect.Type) (*types.Type, ConvertFunc, bool) {
+	if !isTextFallbackType(t) {
+		return nil, nil, false
+	}
+	ptr := !t.Implements(textMarshalerType)
+	if ptr && !reflect.PointerTo(t).Implements(textMarshalerType) {
+		return nil, nil, false
+	}
+
+	return types.StringType, func(v reflect.Value) (any, error) {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return types.NullValue, nil
+		}
+		if ptr {
+			p := reflect.New(t)
+			p.Elem().Set(v)
+			v = p
+		}
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, fmt.Errorf("xcel: %w", err)
+		}
+		return string(text), nil
+	}, true
+}
+
+// stringerType is the reflect type of fmt.Stringer.
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// WithStringerFallback makes fields derived with NewFields whose types have
+// no CEL mapping of their own, but implement fmt.Stringer on the type or
+// its pointer, strings of their String form, such as a vendor phase type
+// compared with obj.phase == 'Running'. Structs with exported fields are
+// never converted this way, so their fields can still be selected.
+//
+// Types of the given sample values, such as time.Month(0), use their String
+// form even if they have a CEL mapping or exported fields, so obj.month is
+// 'January' rather than 1.
+func WithStringerFallback(samples ...any) Option {
+	return option("WithStringerFallback", fieldScope, func(o *options) {
+		o.stringerFallback = true
+		if o.stringers == nil {
+			o.stringers = map[reflect.Type]bool{}
+		}
+		for _, sample := range samples {
+			o.stringers[reflect.TypeOf(sample)] = true
+		}
+	})
+}
+
+// stringerFieldType returns the string type and conversion for fields whose
+// type, or its pointer, implements fmt.Stringer, if the type has no CEL
+// mapping of its own or is listed with WithStringerFallback.
+func (o *options) stringerFieldType(t reflect.Type) (*types.Type, ConvertFunc, bool) {
+	if !o.stringers[t] && (!isTextFallbackType(t) || hasExportedFields(t)) {
+		return nil, nil, false
+	}
+	ptr := !t.Implements(stringerType)
+	if ptr && !reflect.PointerTo(t).Implements(stringerType) {
+		return nil, nil, false
+	}
+
+	return types.StringType, func(v reflect.Value) (any, error) {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return types.NullValue, nil
+		}
+		if ptr {
+			p := reflect.New(t)
+			p.Elem().Set(v)
+			v = p
+		}
+		return v.Interface().(fmt.Stringer).String(), nil
+	}, true
+}
+
+// hasExportedFields reports whether the type is a struct, or pointer to a
+// struct, with exported fields.
+func hasExportedFields(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package xcel_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+// RequestID is a UUID-like identifier.
+type RequestID [4]byte
+
+func (id RequestID) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(id[:])), nil
+}
+
+// ResourceName implements encoding.TextMarshaler on its pointer.
+type ResourceName struct {
+	kind, name string
+}
+
+func (n *ResourceName) MarshalText() ([]byte, error) {
+	if n.name == "" {
+		return nil, errors.New("resource name is empty")
+	}
+	return []byte(n.kind + "/" + n.name), nil
+}
+
+type Request struct {
+	ID       RequestID
+	Parent   *RequestID
+	Resource ResourceName
+}
+
+func TestFieldsTextMarshalers(t *testing.T) {
+	req := &Request{
+		ID:       RequestID{0xde, 0xad, 0xbe, 0xef},
+		Resource: ResourceName{kind: "pods", name: "nginx"},
+	}
+
+	tests := []string{
+		"obj.id == 'deadbeef'",
+		"obj.resource == 'pods/nginx'",
+		"!has(obj.parent)",
+	}
+
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			out, err := evalFields(t, req, expr, xcel.WithTextMarshalers())
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.True {
+				t.Fatalf("expected 'true' but got '%v'", out)
+			}
+		})
+	}
+
+	// Without the option, the fields keep their default types.
+	out, err := evalFields(t, req, "obj.id == b'\\xde\\xad\\xbe\\xef'")
+	if err != nil || out != types.True {
+		t.Fatalf("expected the ID to be bytes by default, got '%v': %v", out, err)
+	}
+
+	_, err = evalFields(t, &Request{}, "obj.resource == ''", xcel.WithTextMarshalers())
+	if err == nil || !strings.Contains(err.Error(), "resource name is empty") {
+		t.Fatalf("expected a marshaling error, got: %v", err)
+	}
+}
+
+// VendorPhase is an opaque third-party enum type.
+type VendorPhase struct {
+	phase int
+}
+
+func (p VendorPhase) String() string {
+	return [...]string{"Pending", "Running"}[p.phase]
+}
+
+// Version has exported fields, so it is not converted unless listed.
+type Version struct {
+	Major, Minor int
+}
+
+func (v *Version) String() string {
+	return fmt.Sprintf("v%d.%d", v.Major, v.Minor)
+}
+
+type Rollout struct {
+	Phase   VendorPhase
+	Month   time.Month
+	Version *Version
+}
+
+func TestFieldsStringerFallback(t *testing.T) {
+	rollout := &Rollout{
+		Phase:   VendorPhase{phase: 1},
+		Month:   time.March,
+		Version: &Version{Major: 1, Minor: 2},
+	}
+
+	tests := []struct {
+		expr string
+		opts []xcel.Option
+	}{
+		{"obj.phase == 'Running'", []xcel.Option{xcel.WithStringerFallback()}},
+		{"obj.month == 3", []xcel.Option{xcel.WithStringerFallback()}},
+		{"obj.month == 'March'", []xcel.Option{xcel.WithStringerFallback(time.Month(0))}},
+		{"obj.version == 'v1.2'", []xcel.Option{xcel.WithStringerFallback(&Version{})}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, rollout, test.expr, test.opts...)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.True {
+				t.Fatalf("expected 'true' but got '%v'", out)
+			}
+		})
+	}
+
+	// Structs with exported fields are not converted unless listed.
+	obj, _ := xcel.NewObject(rollout)
+	fields := xcel.NewFields(obj, xcel.WithStringerFallback())
+	if fields["version"].Type == types.StringType {
+		t.Fatal("expected the version to not be converted to a string")
+	}
+}
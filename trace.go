@@ -0,0 +1,123 @@
+package xcel
+
+import (
+	"reflect"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// FieldAccess is a field value read during a traced evaluation.
+type FieldAccess struct {
+	// Path is the variable and field name, such as event.exe_path.
+	Path string `json:"path"`
+
+	// Value is the value of the field.
+	Value any `json:"value"`
+}
+
+// TraceRecord is the JSON serializable record of a traced evaluation.
+type TraceRecord struct {
+	// Expression is the source of the evaluated expression.
+	Expression string `json:"expression"`
+
+	// Fingerprint is the fingerprint of the registry's schema, see
+	// TypeProvider.Fingerprint.
+	Fingerprint string `json:"fingerprint"`
+
+	// Fields are the field values read during the evaluation, in the
+	// order they were first read.
+	Fields []FieldAccess `json:"fields"`
+
+	// Result is the result of the evaluation, unless it failed.
+	Result any `json:"result,omitempty"`
+
+	// Error is the error of the evaluation, if it failed.
+	Error string `json:"error,omitempty"`
+}
+
+// WithTraceValueSize limits the string and bytes field values captured by
+// Registry.Trace to n bytes, truncating larger values like
+// WithMaxValueSize with TruncateOversize.
+func WithTraceValueSize(n int) Option {
+	return option("WithTraceValueSize", registryScope, func(o *options) {
+		o.traceValueSize = n
+	})
+}
+
+// Trace evaluates the program, created from the checked AST, like Eval and
+// records the expression, the registry's schema fingerprint, the values of
+// the fields read from the objects in the variables, and the result.
+//
+// Only fields derived with NewFields of objects used directly as variables
+// are recorded. Recording happens on a copy of each object made for the
+// call, so evaluations which are not traced have no overhead.
+func (r *Registry) Trace(ast *cel.Ast, prg cel.Program, vars map[string]any) (*TraceRecord, error) {
+	expr, err := cel.AstToString(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &TraceRecord{
+		Expression:  expr,
+		Fingerprint: r.Provider.Fingerprint(),
+		Fields:      []FieldAccess{},
+	}
+
+	seen := map[string]bool{}
+
+	traced := make(map[string]any, len(vars))
+	for name, v := range vars {
+		if _, ok := v.(ref.Val); !ok {
+			if _, ok := r.Adapter[reflect.TypeOf(v)]; ok {
+				v = r.Adapter.NativeToValue(v)
+			}
+		}
+
+		if h, ok := v.(interface {
+			withAccessHook(func(string, any)) ref.Val
+		}); ok {
+			variable := name
+			v = h.withAccessHook(func(field string, value any) {
+				path := variable + "." + field
+				if seen[path] {
+					return
+				}
+				seen[path] = true
+				record.Fields = append(record.Fields, FieldAccess{Path: path, Value: r.traceValue(value)})
+			})
+		}
+
+		traced[name] = v
+	}
+
+	out, _, err := r.Eval(prg, traced)
+	if err != nil {
+		record.Error = err.Error()
+		return record, nil
+	}
+
+	record.Result = r.traceValue(out)
+
+	return record, nil
+}
+
+// traceValue returns the native form of a value for a trace record,
+// limited to the trace value size.
+func (r *Registry) traceValue(value any) any {
+	if v, ok := value.(ref.Val); ok {
+		if _, ok := v.(rawValuer); !ok {
+			value = v.Value()
+		}
+	}
+
+	if r.opts.traceValueSize <= 0 || value == nil {
+		return value
+	}
+
+	limit := valueLimit{size: r.opts.traceValueSize, mode: TruncateOversize}
+
+	v, _ := limit.apply("", reflect.ValueOf(value))
+
+	return v.Interface()
+}
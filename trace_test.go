@@ -0,0 +1,91 @@
+package xcel_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/picatz/xcel"
+)
+
+func TestRegistryTrace(t *testing.T) {
+	reg := xcel.NewRegistry(xcel.WithTraceValueSize(8))
+
+	obj, typ := xcel.NewObject(&ExecEvent{})
+
+	xcel.RegisterObject(reg.Adapter, reg.Provider, obj, typ, xcel.NewFields(obj))
+
+	reg.Variable("event", typ)
+
+	env, err := cel.NewEnv(reg.EnvOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create CEL environment: %v", err)
+	}
+
+	ast, iss := env.Compile("event.exe_path.endsWith('/curl') && size(event.args) > 1 && event.exe_path != ''")
+	if iss.Err() != nil {
+		t.Fatalf("failed to compile CEL expression: %v", iss.Err())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		t.Fatalf("failed to create CEL program: %v", err)
+	}
+
+	event := &ExecEvent{ExePath: "/usr/bin/curl", Args: []string{"-s", "https://example.com"}}
+
+	record, err := reg.Trace(ast, prg, map[string]any{"event": event})
+	if err != nil {
+		t.Fatalf("failed to trace evaluation: %v", err)
+	}
+
+	want := &xcel.TraceRecord{
+		Expression:  `event.exe_path.endsWith("/curl") && size(event.args) > 1 && event.exe_path != ""`,
+		Fingerprint: reg.Provider.Fingerprint(),
+		Fields: []xcel.FieldAccess{
+			{Path: "event.exe_path", Value: "/usr/bin" + xcel.TruncationMarker},
+			{Path: "event.args", Value: []string{"-s", "https://" + xcel.TruncationMarker}},
+		},
+		Result: true,
+	}
+
+	if !reflect.DeepEqual(record, want) {
+		t.Fatalf("expected %+v but got %+v", want, record)
+	}
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		t.Fatalf("failed to marshal trace record: %v", err)
+	}
+
+	var decoded xcel.TraceRecord
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal trace record: %v", err)
+	}
+
+	again, err := json.Marshal(&decoded)
+	if err != nil {
+		t.Fatalf("failed to marshal trace record: %v", err)
+	}
+
+	if string(again) != string(b) {
+		t.Fatalf("expected the record to round trip:\n%s\n!=\n%s", again, b)
+	}
+
+	// The traced copy does not change the registered object.
+	out, _, err := prg.Eval(map[string]any{"event": event})
+	if err != nil || out.Value() != true {
+		t.Fatalf("expected 'true' but got '%v' (%v)", out, err)
+	}
+
+	record, err = reg.Trace(ast, prg, map[string]any{})
+	if err != nil {
+		t.Fatalf("failed to trace evaluation: %v", err)
+	}
+
+	if !strings.Contains(record.Error, "no such attribute") || record.Result != nil {
+		t.Fatalf("expected an evaluation error but got %+v", record)
+	}
+}
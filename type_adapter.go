@@ -12,14 +12,23 @@ var _ types.Adapter = TypeAdapter{}
 type TypeAdapter map[reflect.Type]func(value any) ref.Val
 
 func (ta TypeAdapter) NativeToValue(value any) ref.Val {
-	for typ, fn := range ta {
-		if reflect.TypeOf(value) == typ {
-			return fn(value)
-		}
+	if fn, ok := ta[reflect.TypeOf(value)]; ok {
+		return fn(value)
+	}
+	if fn, ok := ta[protoAdapterType]; ok {
+		return fn(value)
 	}
 	return types.DefaultTypeAdapter.NativeToValue(value)
 }
 
+// protoAdapter is the key of the entry converting values of the protobuf
+// message types registered with RegisterProtoType, and values reached
+// through them, such as repeated fields. No value has this type.
+type protoAdapter struct{}
+
+// protoAdapterType is the reflect type of protoAdapter.
+var protoAdapterType = reflect.TypeOf(protoAdapter{})
+
 func NewTypeAdapter() TypeAdapter {
 	return make(TypeAdapter)
 }
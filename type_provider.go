@@ -1,7 +1,12 @@
 package xcel
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
@@ -14,6 +19,67 @@ type TypeProvider struct {
 	Types            map[string]*types.Type
 	Structs          map[string]map[string]*types.FieldType
 	StructFieldTypes map[string]map[string]*types.FieldType
+
+	// roots are the types registered directly, deps the nested types
+	// registered on behalf of each type, and refs the number of types
+	// each nested type was registered on behalf of.
+	roots map[string]bool
+	deps  map[string][]string
+	refs  map[string]int
+
+	// computed are the fields each computed field of a type is computed
+	// from, see RegisterComputedField.
+	computed map[string]map[string][]string
+
+	// frozen is set by Freeze, along with the sorted field names of each
+	// type, which are otherwise sorted on every lookup.
+	frozen     bool
+	fieldNames map[string][]string
+
+	// protos resolves the protobuf message types registered with
+	// RegisterProtoType, if any.
+	protos *types.Registry
+}
+
+// ErrFrozen is returned, or the panic value wrapped, when registering with a
+// type provider after it has been frozen, see Freeze.
+var ErrFrozen = errors.New("xcel: registration is frozen")
+
+// Freeze prevents any further registration with the type provider, such as
+// after the types of a service are registered at startup: the register and
+// unregister functions panic with an error wrapping ErrFrozen, and those
+// returning errors, such as RegisterAll and RegisterComputedField, return
+// it. A frozen type provider is only read, so it can be shared by concurrent
+// evaluations without synchronization, and its field names are sorted once
+// instead of for each lookup.
+//
+// Type adapters are only written by the functions registering types with a
+// type provider, which check the provider first, so the type adapters given
+// with a frozen type provider are frozen along with it.
+//
+// Freeze does not prevent modifying the exported maps of the type provider
+// directly.
+func (tp *TypeProvider) Freeze() {
+	if tp.frozen {
+		return
+	}
+	tp.fieldNames = make(map[string][]string, len(tp.Structs))
+	for name, fields := range tp.Structs {
+		tp.fieldNames[name] = sortedFieldNames(fields)
+	}
+	tp.frozen = true
+}
+
+// Frozen reports whether the type provider has been frozen, see Freeze.
+func (tp *TypeProvider) Frozen() bool {
+	return tp.frozen
+}
+
+// checkFrozen panics if the type provider has been frozen.
+func (tp *TypeProvider) checkFrozen(name string) {
+	if tp.frozen {
+		panic(fmt.Errorf("%w: cannot register '%s' with the type provider", ErrFrozen, name))
+	}
 }
 
 func NewTypeProvider() *TypeProvider {
@@ -22,6 +88,10 @@ func NewTypeProvider() *TypeProvider {
 		Types:            map[string]*types.Type{},
 		Structs:          map[string]map[string]*types.FieldType{},
 		StructFieldTypes: map[string]map[string]*types.FieldType{},
+		roots:            map[string]bool{},
+		deps:             map[string][]string{},
+		refs:             map[string]int{},
+		computed:         map[string]map[string][]string{},
 	}
 }
 
@@ -33,6 +103,9 @@ func (tp *TypeProvider) FindIdent(identName string) (ref.Val, bool) {
 	if v, ok := tp.Idents[identName]; ok {
 		return v, true
 	}
+	if tp.protos != nil {
+		return tp.protos.FindIdent(identName)
+	}
 	return nil, false
 }
 
@@ -40,16 +113,22 @@ func (tp *TypeProvider) FindStructType(structType string) (*types.Type, bool) {
 	if t, ok := tp.Types[structType]; ok {
 		return t, true
 	}
+	if tp.protos != nil {
+		return tp.protos.FindStructType(structType)
+	}
 	return nil, false
 }
 
 func (tp *TypeProvider) FindStructFieldNames(structType string) ([]string, bool) {
-	if t, ok := tp.Structs[structType]; ok {
-		var names []string
-		for name := range t {
-			names = append(names, name)
+	if tp.frozen {
+		if names, ok := tp.fieldNames[structType]; ok {
+			return names, true
 		}
-		return names, true
+	} else if t, ok := tp.Structs[structType]; ok {
+		return sortedFieldNames(t), true
+	}
+	if tp.protos != nil {
+		return tp.protos.FindStructFieldNames(structType)
 	}
 	return nil, false
 }
@@ -59,30 +138,177 @@ func (tp *TypeProvider) FindStructFieldType(messageType, fieldName string) (*typ
 		if ft, ok := t[fieldName]; ok {
 			return ft, true
 		}
+		return nil, false
+	}
+	if tp.protos != nil {
+		return tp.protos.FindStructFieldType(messageType, fieldName)
 	}
 	return nil, false
 }
 
+// Schema returns a text form of the registered schema: the type names in
+// sorted order, each followed by its field names in sorted order along with
+// their CEL types, and the fields computed fields are computed from.
+// Registration does not depend on map iteration order, so registering the
+// same types with the same options always produces the same schema,
+// regardless of the order or process the types were registered in.
+func (tp *TypeProvider) Schema() string {
+	var b strings.Builder
+
+	names := make([]string, 0, len(tp.Types))
+	for name := range tp.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(&b, "type %s\n", name)
+		fields := tp.StructFieldTypes[name]
+		for _, field := range sortedFieldNames(fields) {
+			fmt.Fprintf(&b, "\tfield %s %s", field, fields[field].Type)
+			if from, ok := tp.computed[name][field]; ok {
+				fmt.Fprintf(&b, " computed from %s", strings.Join(from, ", "))
+			}
+			b.WriteByte('\n')
+		}
+	}
+
+	return b.String()
+}
+
+// Fingerprint returns a stable hash of the registered schema, see Schema.
+// Processes registering the same types with the same options produce the
+// same fingerprint, which makes it suitable for keying caches of compiled
+// expressions.
+func (tp *TypeProvider) Fingerprint() string {
+	sum := sha256.Sum256([]byte(tp.Schema()))
+	return hex.EncodeToString(sum[:])
+}
+
+// sortedFieldNames returns the names of the fields in sorted order.
+func sortedFieldNames(fields map[string]*types.FieldType) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (TypeProvider) NewValue(typeName string, fields map[string]ref.Val) ref.Val {
 	return types.NewErr(fmt.Sprintf("xcel: type provider new value for %q (%d fields) not implemented", typeName, len(fields)))
 }
 
-var DefaultTypeProvider = &TypeProvider{
-	Idents:           map[string]ref.Val{},
-	Types:            map[string]*types.Type{},
-	Structs:          map[string]map[string]*types.FieldType{},
-	StructFieldTypes: map[string]map[string]*types.FieldType{},
-}
+var DefaultTypeProvider = NewTypeProvider()
 
 func RegisterIdent(tp *TypeProvider, name string, value ref.Val) {
+	tp.checkFrozen(name)
 	tp.Idents[name] = value
 }
 
 func RegisterType(tp *TypeProvider, t *types.Type) {
+	tp.checkFrozen(t.TypeName())
 	tp.Types[t.TypeName()] = t
+	if tp.roots == nil {
+		tp.roots = map[string]bool{}
+	}
+	tp.roots[t.TypeName()] = true
+}
+
+// RegisterNestedType registers a struct type on behalf of the owner type,
+// such as the type of a nested object field. Nested types are reference
+// counted, and are removed along with the last owner that registered them
+// unless they were also registered directly. The fields of a type that is
+// already registered are kept, so shared nested types are registered once.
+func RegisterNestedType(tp *TypeProvider, owner string, t *types.Type, fields map[string]*types.FieldType) {
+	tp.checkFrozen(t.TypeName())
+	name := t.TypeName()
+	for _, dep := range tp.deps[owner] {
+		if dep == name {
+			return
+		}
+	}
+	if tp.deps == nil {
+		tp.deps = map[string][]string{}
+	}
+	tp.deps[owner] = append(tp.deps[owner], name)
+	if tp.refs == nil {
+		tp.refs = map[string]int{}
+	}
+	tp.refs[name]++
+	if _, ok := tp.Structs[name]; ok {
+		return
+	}
+	tp.Types[name] = t
+	RegisterStructType(tp, name, fields)
+}
+
+// UnregisterPlan returns the sorted names of the types UnregisterType would
+// remove for the given type name, without removing anything.
+func UnregisterPlan(tp *TypeProvider, typeName string) []string {
+	if _, ok := tp.Types[typeName]; !ok {
+		if _, ok := tp.Structs[typeName]; !ok {
+			return nil
+		}
+	}
+	names := []string{typeName}
+	for _, dep := range tp.deps[typeName] {
+		if dep != typeName && tp.refs[dep] == 1 && !tp.roots[dep] {
+			names = append(names, dep)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UnregisterType removes the named type from the type provider along with
+// its fields, the nested types registered solely on its behalf, and their
+// type adapter entries. It returns the sorted names of the removed types.
+//
+// Expressions can no longer be compiled against removed types. Programs
+// created before the removal keep the field accessors resolved when they
+// were planned, so they continue to work for values that are already
+// wrapped objects, but raw Go values of a removed type are no longer
+// converted by the type adapter.
+func UnregisterType(tp *TypeProvider, ta TypeAdapter, typeName string) []string {
+	tp.checkFrozen(typeName)
+	removed := UnregisterPlan(tp, typeName)
+	if len(removed) == 0 {
+		return nil
+	}
+
+	for _, dep := range tp.deps[typeName] {
+		tp.refs[dep]--
+		if tp.refs[dep] <= 0 {
+			delete(tp.refs, dep)
+		}
+	}
+
+	for _, name := range removed {
+		delete(tp.Types, name)
+		delete(tp.Structs, name)
+		delete(tp.StructFieldTypes, name)
+		delete(tp.roots, name)
+		delete(tp.deps, name)
+		delete(tp.refs, name)
+		delete(tp.computed, name)
+		unregisterAdapter(ta, name)
+	}
+
+	return removed
+}
+
+// unregisterAdapter removes the type adapter entries for the named type.
+func unregisterAdapter(ta TypeAdapter, typeName string) {
+	for typ := range ta {
+		if typ.String() == typeName {
+			delete(ta, typ)
+		}
+	}
 }
 
 func RegisterStructType(tp *TypeProvider, name string, fields map[string]*types.FieldType) {
+	tp.checkFrozen(name)
 	tp.Structs[name] = fields
 	registerStructFieldType(tp, name, fields)
 }
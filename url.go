@@ -0,0 +1,98 @@
+package xcel
+
+import (
+	"net/url"
+	"reflect"
+
+	"github.com/google/cel-go/common/types"
+)
+
+// URL is the object exposing url.URL fields with WithURLObjects, such as
+// obj.endpoint.scheme.
+type URL struct {
+	Scheme   string
+	User     string
+	Host     string
+	Hostname string
+	Port     string
+	Path     string
+	Query    map[string]string
+	Fragment string
+}
+
+// newURL returns the object for the URL. Query parameters with more than
+// one value use the first.
+func newURL(u *url.URL) *URL {
+	obj := &URL{
+		Scheme:   u.Scheme,
+		User:     u.User.Username(),
+		Host:     u.Host,
+		Hostname: u.Hostname(),
+		Port:     u.Port(),
+		Path:     u.Path,
+		Fragment: u.Fragment,
+	}
+	if u.RawQuery != "" {
+		obj.Query = map[string]string{}
+		for k, v := range u.Query() {
+			obj.Query[k] = v[0]
+		}
+	}
+	return obj
+}
+
+// WithURLObjects makes url.URL fields derived with NewFields URL objects,
+// such as obj.endpoint.scheme == 'https', instead of their string form.
+func WithURLObjects() Option {
+	return option("WithURLObjects", fieldScope, func(o *options) {
+		o.urlObjects = true
+	})
+}
+
+// urlType is the reflect type of url.URL.
+var urlType = reflect.TypeOf(url.URL{})
+
+// isURLType reports whether the type is url.URL or a pointer to it.
+func isURLType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t == urlType
+}
+
+// urlFieldType returns the CEL type and conversion of url.URL fields: their
+// string form, or URL objects with WithURLObjects.
+func (b *fieldsBuilder) urlFieldType() (*types.Type, ConvertFunc) {
+	if !b.o.urlObjects {
+		return types.StringType, func(v reflect.Value) (any, error) {
+			u, ok := urlValue(v)
+			if !ok {
+				return types.NullValue, nil
+			}
+			return u.String(), nil
+		}
+	}
+
+	n := b.nestedObject(reflect.TypeOf(&URL{}))
+
+	return n.typ, func(v reflect.Value) (any, error) {
+		u, ok := urlValue(v)
+		if !ok {
+			return types.NullValue, nil
+		}
+		return n.wrap(newURL(u)), nil
+	}
+}
+
+// urlValue returns the URL of a url.URL or url.URL pointer value, or false
+// if it is nil.
+func urlValue(v reflect.Value) (*url.URL, bool) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	u := v.Interface().(url.URL)
+	return &u, true
+}
@@ -0,0 +1,53 @@
+package xcel_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/picatz/xcel"
+)
+
+type Upstream struct {
+	Endpoint *url.URL
+	Fallback url.URL
+}
+
+func TestFieldsURLs(t *testing.T) {
+	endpoint, _ := url.Parse("https://admin@api.example.com:8443/v1/events?limit=10&tag=a&tag=b#top")
+
+	upstream := &Upstream{
+		Endpoint: endpoint,
+		Fallback: url.URL{Scheme: "http", Host: "localhost"},
+	}
+
+	tests := []struct {
+		expr     string
+		upstream *Upstream
+		opts     []xcel.Option
+		want     bool
+	}{
+		{"obj.endpoint.startsWith('https://')", upstream, nil, true},
+		{"obj.fallback == 'http://localhost'", upstream, nil, true},
+		{"has(obj.endpoint)", &Upstream{}, nil, false},
+		{"obj.endpoint.scheme == 'https' && obj.endpoint.host == 'api.example.com:8443'", upstream, []xcel.Option{xcel.WithURLObjects()}, true},
+		{"obj.endpoint.hostname == 'api.example.com' && obj.endpoint.port == '8443'", upstream, []xcel.Option{xcel.WithURLObjects()}, true},
+		{"obj.endpoint.path == '/v1/events' && obj.endpoint.fragment == 'top' && obj.endpoint.user == 'admin'", upstream, []xcel.Option{xcel.WithURLObjects()}, true},
+		{"obj.endpoint.query['limit'] == '10' && obj.endpoint.query['tag'] == 'a'", upstream, []xcel.Option{xcel.WithURLObjects()}, true},
+		{"has(obj.fallback.query)", upstream, []xcel.Option{xcel.WithURLObjects()}, false},
+		{"has(obj.endpoint)", &Upstream{}, []xcel.Option{xcel.WithURLObjects()}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			out, err := evalFields(t, test.upstream, test.expr, test.opts...)
+			if err != nil {
+				t.Fatalf("failed to evaluate program: %v", err)
+			}
+
+			if out != types.Bool(test.want) {
+				t.Fatalf("expected '%v' but got '%v'", test.want, out)
+			}
+		})
+	}
+}